@@ -0,0 +1,131 @@
+package app
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
+	"oneimg/backend/utils/backup"
+	"oneimg/backend/utils/imagecache"
+)
+
+// RunCommand 执行命令行子命令，args[0] 不是已知子命令时返回 false（按正常方式启动服务）
+func RunCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "backup":
+		err = runBackup(args[1:])
+	case "restore":
+		err = runRestore(args[1:])
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+	return true
+}
+
+// initCommand 命令行只需要配置和数据库，不启动后台任务
+func initCommand() *database.Database {
+	if !config.EnvExists() {
+		config.CreateDefaultEnv()
+	}
+	config.NewConfig()
+	database.InitDB(config.App)
+	return database.GetDB()
+}
+
+// runBackup oneimg backup [-uploads] [-o 文件名]
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	includeUploads := fs.Bool("uploads", false, "同时备份本地存储文件")
+	output := fs.String("o", "", "备份文件路径（默认 oneimg-backup-时间.zip）")
+	fs.Parse(args)
+
+	if *output == "" {
+		*output = fmt.Sprintf("oneimg-backup-%s.zip", time.Now().Format("20060102-150405"))
+	}
+
+	db := initCommand()
+	f, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("创建备份文件失败：%v", err)
+	}
+
+	manifest, err := backup.Export(db.DB, db.DBType, f, *includeUploads)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+
+	log.Printf("备份完成：%s", *output)
+	printManifest(manifest)
+	return nil
+}
+
+// runRestore oneimg restore [-uploads] 备份文件
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreUploads := fs.Bool("uploads", false, "同时恢复本地存储文件")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法：oneimg restore [-uploads] <备份文件>")
+	}
+
+	zr, err := zip.OpenReader(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("打开备份文件失败：%v", err)
+	}
+	defer zr.Close()
+
+	db := initCommand()
+	manifest, err := backup.Import(db.DB, db.DBType, &zr.Reader, *restoreUploads)
+	if err != nil {
+		return err
+	}
+
+	// 递增会话版本，使恢复前签发的会话全部失效
+	if err := middlewares.ClearSessionStore(); err != nil {
+		return err
+	}
+
+	// 清空衍生缓存（磁盘缓存在服务进程之间共享）
+	cfg := config.App
+	imagecache.Init(cfg.DerivedCacheDir, cfg.DerivedCacheMemory, cfg.DerivedCacheDisk)
+	imagecache.Purge()
+
+	log.Printf("恢复完成（来源数据库：%s，备份时间：%s）", manifest.DBType, manifest.CreatedAt.Format(time.DateTime))
+	printManifest(manifest)
+	return nil
+}
+
+func printManifest(manifest *backup.Manifest) {
+	tables := make([]string, 0, len(manifest.Tables))
+	for table := range manifest.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		log.Printf("  %s: %d 行", table, manifest.Tables[table])
+	}
+	if manifest.Uploads {
+		log.Printf("  本地存储文件: %d 个", manifest.UploadFiles)
+	}
+}
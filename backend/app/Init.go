@@ -2,11 +2,20 @@ package app
 
 import (
 	"log"
+	"time"
 
 	"oneimg/backend/config"
 	"oneimg/backend/database"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/chunkupload"
+	"oneimg/backend/utils/imagecache"
 	"oneimg/backend/utils/images"
+	"oneimg/backend/utils/jobs"
+	"oneimg/backend/utils/loginguard"
+	"oneimg/backend/utils/migration"
+	"oneimg/backend/utils/pow"
+	"oneimg/backend/utils/ratelimit"
+	"oneimg/backend/utils/webhooks"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -32,12 +41,36 @@ func Init() *System {
 	// 初始化图片服务
 	images.InitImageService()
 
+	// 初始化衍生图片缓存
+	imagecache.Init(cfg.DerivedCacheDir, cfg.DerivedCacheMemory, cfg.DerivedCacheDisk)
+
 	// 初始化默认用户
 	InitDefaultUser(cfg, db)
 
 	// 初始化默认存储配置
 	InitDefaultStorage(db)
 
+	// 初始化分片上传暂存目录（依赖数据库，启动后台过期清理）
+	chunkupload.Init(cfg.ChunkUploadDir, time.Duration(cfg.ChunkUploadExpireHours)*time.Hour)
+
+	// 登录防暴力破解策略
+	loginguard.Init(cfg.LoginMaxFailures, time.Duration(cfg.LoginLockoutSeconds)*time.Second, time.Duration(cfg.LoginLockoutMax)*time.Second)
+
+	// 上传限流计数清理
+	ratelimit.Init()
+
+	// 工作量证明挑战签名密钥
+	pow.Init(cfg.SessionSecret)
+
+	// 注册Webhook投递任务
+	webhooks.Init()
+
+	// 启动后台任务队列（继续执行上次未完成的任务）
+	jobs.Init(cfg.JobWorkers, cfg.JobMaxAttempts)
+
+	// 继续上次未完成的存储迁移任务
+	migration.ResumeInterrupted()
+
 	r := &System{
 		Config:   cfg,
 		Database: db,
@@ -76,7 +109,7 @@ func InitDefaultUser(cfg *config.Config, db *database.Database) {
 	// 创建默认用户
 	defaultUser := models.User{
 		Username: defaultUsername,
-		Role:     1,
+		Role:     models.RoleAdmin,
 		Password: hashedPassword,
 	}
 
@@ -48,6 +48,46 @@ type Config struct {
 
 	// Session配置
 	SessionSecret string
+	SessionStore  string // Session存储后端：memory/database/cookie/redis
+
+	// Redis配置（SessionStore=redis 时使用，兼容Redis协议的服务均可）
+	RedisAddr     string
+	RedisUsername string
+	RedisPassword string
+	RedisDB       int
+
+	// 衍生图片缓存（水印/变换结果），大小为0表示禁用对应层
+	DerivedCacheDir    string
+	DerivedCacheMemory int64 // 内存缓存上限（字节）
+	DerivedCacheDisk   int64 // 磁盘缓存上限（字节）
+
+	// 签名链接密钥（私有图片的限时访问链接）
+	SignedURLSecret string
+
+	// 分片上传配置
+	ChunkUploadDir         string // 分片暂存目录
+	ChunkUploadExpireHours int    // 未完成的上传会话保留时间（小时）
+
+	// WebDAV服务端（将图库挂载为网络驱动器）
+	WebDAVServerEnabled bool
+	WebDAVServerPath    string // 挂载路径，如 /dav
+
+	// 后台任务队列（缩略图生成、通知等上传后处理）
+	JobWorkers     int // 并发执行的任务数
+	JobMaxAttempts int // 单个任务最多尝试次数
+
+	// 系统设置中密钥类字段的加密主密钥（32字节，base64或hex编码），为空时不加密
+	SettingsEncryptionKey     string
+	SettingsEncryptionOldKeys []string // 更换主密钥前使用的旧密钥，仅用于解密和重新加密
+
+	// 登录防暴力破解：同一用户名连续失败次数达到阈值后临时锁定（同一IP阈值为4倍），之后每次失败锁定时长翻倍
+	LoginMaxFailures    int
+	LoginLockoutSeconds int // 首次锁定时长（秒）
+	LoginLockoutMax     int // 最长锁定时长（秒）
+
+	// 受信任的反向代理（IP或CIDR），仅来自这些地址的请求才采用 X-Forwarded-For / X-Real-IP 作为客户端IP；
+	// 为空时直接使用连接地址，避免伪造请求头绕过按IP的登录锁定和上传限流
+	TrustedProxies []string
 }
 
 // 全局配置实例
@@ -102,10 +142,53 @@ DEFAULT_PASS=123456
 
 # Session配置
 SESSION_SECRET=
+# Session存储后端：memory（默认）/ database / cookie / redis
+SESSION_STORE=memory
+
+# Redis配置（SESSION_STORE=redis 时使用）
+REDIS_ADDR=localhost:6379
+REDIS_USERNAME=
+REDIS_PASSWORD=
+REDIS_DB=0
+
+# 衍生图片缓存（水印/变换结果，单位MB，0表示禁用）
+DERIVED_CACHE_DIR=./data/cache
+DERIVED_CACHE_MEMORY_MB=64
+DERIVED_CACHE_DISK_MB=1024
+
+# 签名链接密钥（私有图片的限时访问链接，修改后已签发的链接全部失效）
+SIGNED_URL_SECRET=
+
+# 分片上传（断点续传）暂存目录及未完成会话的保留时间（小时）
+CHUNK_UPLOAD_DIR=./data/chunks
+CHUNK_UPLOAD_EXPIRE_HOURS=24
+
+# WebDAV服务端（将图库挂载为网络驱动器，Basic认证密码填写API令牌，默认关闭）
+WEBDAV_SERVER_ENABLED=false
+WEBDAV_SERVER_PATH=/dav
+
+# 后台任务队列（水印、格式转换、缩略图生成、Telegram通知等上传后处理）并发数及失败重试次数
+JOB_WORKERS=4
+JOB_MAX_ATTEMPTS=5
+
+# 系统设置及存储配置方案中的存储凭据、Bot Token、用户两步验证密钥、S3访问密钥及Webhook签名密钥的加密主密钥（32字节，base64或hex编码，丢失后已加密的密钥无法恢复）
+# 更换主密钥时将旧密钥填入 SETTINGS_ENCRYPTION_OLD_KEYS（逗号分隔），启动时自动重新加密
+SETTINGS_ENCRYPTION_KEY=
+SETTINGS_ENCRYPTION_OLD_KEYS=
+
+# 登录防暴力破解：同一用户名连续失败次数达到阈值后临时锁定（同一IP阈值为4倍），之后每次失败锁定时长翻倍（单位秒）
+LOGIN_MAX_FAILURES=5
+LOGIN_LOCKOUT_SECONDS=60
+LOGIN_LOCKOUT_MAX_SECONDS=3600
+
+# 受信任的反向代理（IP或CIDR，逗号分隔），仅信任这些地址转发的 X-Forwarded-For / X-Real-IP；为空时使用连接地址作为客户端IP
+TRUSTED_PROXIES=
 `
 
 	// 4. 替换模板中的SESSION_SECRET占位符
 	envContent := strings.Replace(envTemplate, "SESSION_SECRET=", "SESSION_SECRET="+sessionSecret, 1)
+	envContent = strings.Replace(envContent, "SIGNED_URL_SECRET=", "SIGNED_URL_SECRET="+generateRandomSecret(32), 1)
+	envContent = strings.Replace(envContent, "SETTINGS_ENCRYPTION_KEY=", "SETTINGS_ENCRYPTION_KEY="+generateRandomSecret(32), 1)
 
 	// 5. 写入.env文件
 	wd, err := os.Getwd()
@@ -181,6 +264,76 @@ func NewConfig() {
 
 	// Session配置（读取.env中的值，无则生成）
 	sessionSecret := getEnv("SESSION_SECRET", generateRandomSecret(32))
+	sessionStore := strings.ToLower(getEnv("SESSION_STORE", "memory"))
+
+	// Redis配置
+	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
+	redisUsername := getEnv("REDIS_USERNAME", "")
+	redisPassword := getEnv("REDIS_PASSWORD", "")
+	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
+
+	// 衍生图片缓存配置
+	derivedCacheDir := getEnv("DERIVED_CACHE_DIR", "./data/cache")
+	derivedCacheMemoryMB, _ := strconv.ParseInt(getEnv("DERIVED_CACHE_MEMORY_MB", "64"), 10, 64)
+	derivedCacheDiskMB, _ := strconv.ParseInt(getEnv("DERIVED_CACHE_DISK_MB", "1024"), 10, 64)
+
+	// 签名链接密钥（旧版.env未配置时沿用SESSION_SECRET，保证重启后已签发的链接仍然有效）
+	signedURLSecret := getEnv("SIGNED_URL_SECRET", sessionSecret)
+
+	// 分片上传配置
+	chunkUploadDir := getEnv("CHUNK_UPLOAD_DIR", "./data/chunks")
+	chunkUploadExpireHours, _ := strconv.Atoi(getEnv("CHUNK_UPLOAD_EXPIRE_HOURS", "24"))
+	if chunkUploadExpireHours <= 0 {
+		chunkUploadExpireHours = 24
+	}
+
+	// WebDAV服务端配置
+	webdavServerEnabled := getEnv("WEBDAV_SERVER_ENABLED", "false") == "true"
+	webdavServerPath := "/" + strings.Trim(getEnv("WEBDAV_SERVER_PATH", "/dav"), "/")
+	if webdavServerPath == "/" || webdavServerPath == "/api" || webdavServerPath == "/s3" || webdavServerPath == "/uploads" {
+		log.Printf("WEBDAV_SERVER_PATH 不能为 %s，已使用默认值 /dav", webdavServerPath)
+		webdavServerPath = "/dav"
+	}
+
+	// 后台任务队列配置
+	jobWorkers, _ := strconv.Atoi(getEnv("JOB_WORKERS", "4"))
+	if jobWorkers <= 0 {
+		jobWorkers = 4
+	}
+	jobMaxAttempts, _ := strconv.Atoi(getEnv("JOB_MAX_ATTEMPTS", "5"))
+	if jobMaxAttempts <= 0 {
+		jobMaxAttempts = 5
+	}
+
+	// 设置加密密钥
+	var settingsEncryptionOldKeys []string
+	for _, key := range strings.Split(getEnv("SETTINGS_ENCRYPTION_OLD_KEYS", ""), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			settingsEncryptionOldKeys = append(settingsEncryptionOldKeys, key)
+		}
+	}
+
+	// 登录防暴力破解配置
+	loginMaxFailures, _ := strconv.Atoi(getEnv("LOGIN_MAX_FAILURES", "5"))
+	if loginMaxFailures <= 0 {
+		loginMaxFailures = 5
+	}
+	loginLockoutSeconds, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_SECONDS", "60"))
+	if loginLockoutSeconds <= 0 {
+		loginLockoutSeconds = 60
+	}
+	loginLockoutMax, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_MAX_SECONDS", "3600"))
+	if loginLockoutMax < loginLockoutSeconds {
+		loginLockoutMax = max(loginLockoutSeconds, 3600)
+	}
+
+	// 受信任的反向代理
+	var trustedProxies []string
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
 
 	// 初始化全局配置
 	App = &Config{
@@ -204,6 +357,35 @@ func NewConfig() {
 		DefaultPass:      defaultPass,
 		JWTSecret:        jwtSecret,
 		SessionSecret:    sessionSecret,
+		SessionStore:     sessionStore,
+		RedisAddr:        redisAddr,
+		RedisUsername:    redisUsername,
+		RedisPassword:    redisPassword,
+		RedisDB:          redisDB,
+
+		DerivedCacheDir:    derivedCacheDir,
+		DerivedCacheMemory: derivedCacheMemoryMB * 1024 * 1024,
+		DerivedCacheDisk:   derivedCacheDiskMB * 1024 * 1024,
+
+		SignedURLSecret: signedURLSecret,
+
+		ChunkUploadDir:         chunkUploadDir,
+		ChunkUploadExpireHours: chunkUploadExpireHours,
+
+		WebDAVServerEnabled: webdavServerEnabled,
+		WebDAVServerPath:    webdavServerPath,
+
+		JobWorkers:     jobWorkers,
+		JobMaxAttempts: jobMaxAttempts,
+
+		SettingsEncryptionKey:     strings.TrimSpace(getEnv("SETTINGS_ENCRYPTION_KEY", "")),
+		SettingsEncryptionOldKeys: settingsEncryptionOldKeys,
+
+		LoginMaxFailures:    loginMaxFailures,
+		LoginLockoutSeconds: loginLockoutSeconds,
+		LoginLockoutMax:     loginLockoutMax,
+
+		TrustedProxies: trustedProxies,
 	}
 
 	log.Println("✅ 配置初始化完成")
@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -77,6 +79,9 @@ func ChangeAccountInfo(c *gin.Context) {
 		return
 	}
 
+	// 记录修改前的状态（Model(&user).Update 会同步修改 user）
+	before := user
+
 	if req.NewUsername == "" && req.NewPassword == "" {
 		c.JSON(http.StatusBadRequest, AccountResponse{
 			Code:    400,
@@ -168,6 +173,9 @@ func ChangeAccountInfo(c *gin.Context) {
 		return
 	}
 
+	db.First(&user, user.Id)
+	audit.Record(c, models.AuditAccountChange, "user", user.Id, before, user)
+
 	// 退出登录
 	session.Clear()
 	session.Save()
@@ -195,6 +203,18 @@ func isTouristUsername(username string) bool {
 
 // ClearAllSessions 清除所有会话
 func ClearAllSessions(c *gin.Context) {
+	// 使所有后端中的会话失效
+	if err := middlewares.ClearSessionStore(); err != nil {
+		c.JSON(http.StatusInternalServerError, AccountResponse{
+			Code:    500,
+			Message: "清除会话失败: " + err.Error(),
+			Success: false,
+		})
+		return
+	}
+
+	audit.Record(c, models.AuditSessionsClear, "session", nil, nil, nil)
+
 	// 获取当前session
 	session := sessions.Default(c)
 
@@ -0,0 +1,684 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateAlbumRequest 创建相册请求
+type CreateAlbumRequest struct {
+	Name        string `json:"name" binding:"required,max=128"`
+	Description string `json:"description" binding:"max=512"`
+	IsPublic    bool   `json:"is_public"`
+}
+
+// UpdateAlbumRequest 更新相册请求（字段为空表示不修改）
+type UpdateAlbumRequest struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	CoverImageId *int    `json:"cover_image_id"`
+	IsPublic     *bool   `json:"is_public"`
+}
+
+// AlbumImagesRequest 相册图片操作请求
+type AlbumImagesRequest struct {
+	ImageIds      []int `json:"image_ids" binding:"required"`
+	TargetAlbumId int   `json:"target_album_id"` // 移动/复制时的目标相册
+}
+
+// AlbumItem 相册信息（含图片数量与封面）
+type AlbumItem struct {
+	models.Album
+	ImageCount int64  `json:"image_count"`
+	CoverUrl   string `json:"cover_url"`
+}
+
+// ListAlbums 获取相册列表
+func ListAlbums(c *gin.Context) {
+	if !requireRegisteredUser(c) {
+		return
+	}
+
+	db := database.GetDB().DB
+	query := db.Model(&models.Album{})
+
+	// 管理员/编辑可查看指定用户或全部相册
+	if models.CanManageAllImages(c.GetInt("user_role")) && c.Query("user_id") != "" {
+		if c.Query("user_id") != "all" {
+			userId, err := strconv.Atoi(c.Query("user_id"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, result.Error(400, "用户ID无效"))
+				return
+			}
+			query = query.Where("user_id = ?", userId)
+		}
+	} else {
+		query = query.Where("user_id = ?", c.GetInt("user_id"))
+	}
+
+	var albums []models.Album
+	if err := query.Order("id DESC").Find(&albums).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取相册列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", toAlbumItems(db, albums)))
+}
+
+// GetAlbum 获取相册详情
+func GetAlbum(c *gin.Context) {
+	album, ok := loadAccessibleAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", toAlbumItem(database.GetDB().DB, *album)))
+}
+
+// CreateAlbum 创建相册
+func CreateAlbum(c *gin.Context) {
+	if !requireRegisteredUser(c) {
+		return
+	}
+
+	var req CreateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, result.Error(400, "相册名称不能为空"))
+		return
+	}
+
+	album := models.Album{
+		UserId:      c.GetInt("user_id"),
+		Name:        name,
+		Description: strings.TrimSpace(req.Description),
+		IsPublic:    req.IsPublic,
+	}
+	if req.IsPublic {
+		album.ShareToken = generateShareToken()
+	}
+
+	db := database.GetDB().DB
+	if err := db.Create(&album).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建相册失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("创建成功", toAlbumItem(db, album)))
+}
+
+// UpdateAlbum 更新相册信息、封面和公开分享状态
+func UpdateAlbum(c *gin.Context) {
+	album, ok := loadAccessibleAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req UpdateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	db := database.GetDB().DB
+	updates := map[string]any{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 128 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "相册名称长度需在1-128之间"))
+			return
+		}
+		updates["name"] = name
+	}
+	if req.Description != nil {
+		if len(*req.Description) > 512 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "相册描述过长"))
+			return
+		}
+		updates["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.CoverImageId != nil {
+		// 封面必须是相册中的图片，0 表示自动选择
+		if *req.CoverImageId != 0 {
+			var count int64
+			db.Model(&models.AlbumImage{}).
+				Where("album_id = ? AND image_id = ?", album.Id, *req.CoverImageId).
+				Count(&count)
+			if count == 0 {
+				c.JSON(http.StatusBadRequest, result.Error(400, "封面图片不在该相册中"))
+				return
+			}
+		}
+		updates["cover_image_id"] = *req.CoverImageId
+	}
+	if req.IsPublic != nil {
+		updates["is_public"] = *req.IsPublic
+		if *req.IsPublic && album.ShareToken == "" {
+			updates["share_token"] = generateShareToken()
+		} else if !*req.IsPublic {
+			// 关闭分享后旧链接立即失效
+			updates["share_token"] = ""
+		}
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "没有要更新的内容"))
+		return
+	}
+
+	if err := db.Model(album).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "更新相册失败"))
+		return
+	}
+
+	db.First(album, album.Id)
+	c.JSON(http.StatusOK, result.Success("更新成功", toAlbumItem(db, *album)))
+}
+
+// DeleteAlbum 删除相册（仅删除相册及关联，不删除图片）
+func DeleteAlbum(c *gin.Context) {
+	album, ok := loadAccessibleAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := deleteAlbum(database.GetDB().DB, album); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "删除相册失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("删除成功", nil))
+}
+
+// AddAlbumImages 将图片加入相册
+func AddAlbumImages(c *gin.Context) {
+	album, ok := loadAccessibleAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	req, ok := bindAlbumImagesRequest(c)
+	if !ok {
+		return
+	}
+
+	imageIds, ok := loadAccessibleImageIds(c, req.ImageIds)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB().DB
+	if err := addImagesToAlbum(db, album.Id, imageIds); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "添加图片失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("添加成功", gin.H{"count": len(imageIds)}))
+}
+
+// RemoveAlbumImages 从相册移除图片（不删除图片本身）
+func RemoveAlbumImages(c *gin.Context) {
+	album, ok := loadAccessibleAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	req, ok := bindAlbumImagesRequest(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB().DB
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return removeImagesFromAlbum(tx, album, req.ImageIds)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "移除图片失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("移除成功", nil))
+}
+
+// MoveAlbumImages 将图片从当前相册移动到目标相册
+func MoveAlbumImages(c *gin.Context) {
+	transferAlbumImages(c, true)
+}
+
+// CopyAlbumImages 将图片复制到目标相册（保留在当前相册）
+func CopyAlbumImages(c *gin.Context) {
+	transferAlbumImages(c, false)
+}
+
+// transferAlbumImages 在相册间移动或复制图片
+func transferAlbumImages(c *gin.Context, move bool) {
+	album, ok := loadAccessibleAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	req, ok := bindAlbumImagesRequest(c)
+	if !ok {
+		return
+	}
+	if req.TargetAlbumId == 0 || req.TargetAlbumId == album.Id {
+		c.JSON(http.StatusBadRequest, result.Error(400, "目标相册无效"))
+		return
+	}
+
+	target, ok := loadAccessibleAlbum(c, strconv.Itoa(req.TargetAlbumId))
+	if !ok {
+		return
+	}
+
+	db := database.GetDB().DB
+
+	// 只处理确实属于源相册的图片
+	var imageIds []int
+	db.Model(&models.AlbumImage{}).
+		Where("album_id = ? AND image_id IN ?", album.Id, req.ImageIds).
+		Pluck("image_id", &imageIds)
+	if len(imageIds) == 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "所选图片不在该相册中"))
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := addImagesToAlbum(tx, target.Id, imageIds); err != nil {
+			return err
+		}
+		if move {
+			return removeImagesFromAlbum(tx, album, imageIds)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "操作失败"))
+		return
+	}
+
+	message := "复制成功"
+	if move {
+		message = "移动成功"
+	}
+	c.JSON(http.StatusOK, result.Success(message, gin.H{"count": len(imageIds)}))
+}
+
+// GetSharedAlbum 公开获取分享相册的图片列表（无需认证）
+func GetSharedAlbum(c *gin.Context) {
+	album, images, total, page, limit, err := loadSharedAlbum(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "相册不存在或未公开"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"album": gin.H{
+			"name":        album.Name,
+			"description": album.Description,
+			"created_at":  album.CreatedAt,
+		},
+		"images":      toSharedImages(images),
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	}))
+}
+
+// AlbumSharePage 公开相册分享页（图片经由 /uploads 代理访问）
+func AlbumSharePage(c *gin.Context) {
+	album, images, total, page, limit, err := loadSharedAlbum(c)
+	if err != nil {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.String(http.StatusNotFound, "相册不存在或未公开")
+		return
+	}
+
+	totalPages := int((total + int64(limit) - 1) / int64(limit))
+	data := gin.H{
+		"Album":    album,
+		"Images":   images,
+		"Total":    total,
+		"Page":     page,
+		"PrevPage": page - 1,
+		"NextPage": 0,
+	}
+	if page < totalPages {
+		data["NextPage"] = page + 1
+	}
+
+	var buf bytes.Buffer
+	if err := albumShareTemplate.Execute(&buf, data); err != nil {
+		c.String(http.StatusInternalServerError, "渲染页面失败")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// albumShareTemplate 分享页模板
+var albumShareTemplate = template.Must(template.New("album_share").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Album.Name}}</title>
+<style>
+body{margin:0;font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;background:#f5f5f5;color:#333}
+header{padding:24px 16px;background:#fff;border-bottom:1px solid #eee}
+header h1{margin:0 0 8px;font-size:22px}
+header p{margin:0;color:#888;font-size:14px}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(200px,1fr));gap:12px;padding:16px}
+.grid a{display:block;background:#fff;border-radius:6px;overflow:hidden}
+.grid img{width:100%;height:200px;object-fit:cover;display:block}
+.pager{text-align:center;padding:16px}
+.pager a{margin:0 8px;color:#3b82f6}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Album.Name}}</h1>
+<p>{{if .Album.Description}}{{.Album.Description}} · {{end}}共 {{.Total}} 张图片</p>
+</header>
+<div class="grid">
+{{range .Images}}<a href="{{.Url}}" target="_blank"><img src="{{if .Thumbnail}}{{.Thumbnail}}{{else}}{{.Url}}{{end}}" alt="{{.FileName}}" loading="lazy"></a>
+{{end}}</div>
+<div class="pager">
+{{if gt .PrevPage 0}}<a href="?page={{.PrevPage}}">上一页</a>{{end}}
+{{if gt .NextPage 0}}<a href="?page={{.NextPage}}">下一页</a>{{end}}
+</div>
+</body>
+</html>`))
+
+// loadSharedAlbum 根据分享标识加载公开相册及分页图片
+func loadSharedAlbum(c *gin.Context) (*models.Album, []models.Image, int64, int, int, error) {
+	token := c.Param("token")
+	if token == "" {
+		return nil, nil, 0, 0, 0, errors.New("分享标识为空")
+	}
+
+	db := database.GetDB().DB
+	var album models.Album
+	if err := db.Where("share_token = ? AND is_public = ?", token, true).First(&album).Error; err != nil {
+		return nil, nil, 0, 0, 0, err
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	// 隐藏和私有的图片不对外展示
+	query := db.Model(&models.Image{}).
+		Where("id IN (?)", albumImageIds(db, album.Id)).
+		Where("hidden = ? AND private = ?", false, false)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, nil, 0, 0, 0, err
+	}
+
+	var images []models.Image
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&images).Error; err != nil {
+		return nil, nil, 0, 0, 0, err
+	}
+
+	return &album, images, total, page, limit, nil
+}
+
+// toSharedImages 转换为公开展示的图片信息（不暴露归属信息）
+func toSharedImages(images []models.Image) []gin.H {
+	items := make([]gin.H, 0, len(images))
+	for _, image := range images {
+		items = append(items, gin.H{
+			"url":       image.Url,
+			"thumbnail": image.Thumbnail,
+			"filename":  image.FileName,
+			"width":     image.Width,
+			"height":    image.Height,
+		})
+	}
+	return items
+}
+
+// RemoveImageFromAlbums 图片被删除后清理相册关联和封面
+func RemoveImageFromAlbums(db *gorm.DB, imageId int) {
+	db.Where("image_id = ?", imageId).Delete(&models.AlbumImage{})
+	db.Model(&models.Album{}).Where("cover_image_id = ?", imageId).Update("cover_image_id", 0)
+}
+
+// requireRegisteredUser 相册功能仅对注册用户开放
+func requireRegisteredUser(c *gin.Context) bool {
+	if c.GetInt("user_role") == models.RoleTourist {
+		c.JSON(http.StatusForbidden, result.Error(403, "游客无法使用相册功能"))
+		return false
+	}
+	return true
+}
+
+// loadAccessibleAlbum 加载当前用户有权操作的相册
+func loadAccessibleAlbum(c *gin.Context, idStr string) (*models.Album, bool) {
+	if !requireRegisteredUser(c) {
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "相册ID无效"))
+		return nil, false
+	}
+
+	var album models.Album
+	if err := database.GetDB().DB.First(&album, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "相册不存在"))
+		return nil, false
+	}
+
+	if album.UserId != c.GetInt("user_id") && !models.CanManageAllImages(c.GetInt("user_role")) {
+		c.JSON(http.StatusForbidden, result.Error(403, "无权访问该相册"))
+		return nil, false
+	}
+
+	return &album, true
+}
+
+// bindAlbumImagesRequest 解析图片ID列表
+func bindAlbumImagesRequest(c *gin.Context) (*AlbumImagesRequest, bool) {
+	var req AlbumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return nil, false
+	}
+	if len(req.ImageIds) == 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请选择图片"))
+		return nil, false
+	}
+	if len(req.ImageIds) > 500 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "单次最多操作500张图片"))
+		return nil, false
+	}
+	return &req, true
+}
+
+// loadAccessibleImageIds 过滤出当前用户有权操作的图片ID
+func loadAccessibleImageIds(c *gin.Context, ids []int) ([]int, bool) {
+	var images []models.Image
+	if err := database.GetDB().DB.Where("id IN ?", ids).Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "查询图片失败"))
+		return nil, false
+	}
+
+	imageIds := make([]int, 0, len(images))
+	for _, image := range images {
+		if !CheckImageAccessPermission(c, image) {
+			c.JSON(http.StatusForbidden, result.Error(403, "无权操作图片："+image.FileName))
+			return nil, false
+		}
+		imageIds = append(imageIds, image.Id)
+	}
+	if len(imageIds) == 0 {
+		c.JSON(http.StatusNotFound, result.Error(404, "图片不存在"))
+		return nil, false
+	}
+	return imageIds, true
+}
+
+// addImagesToAlbum 批量加入相册（已存在的关联忽略）
+func addImagesToAlbum(db *gorm.DB, albumId int, imageIds []int) error {
+	relations := make([]models.AlbumImage, 0, len(imageIds))
+	for _, imageId := range imageIds {
+		relations = append(relations, models.AlbumImage{AlbumId: albumId, ImageId: imageId})
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&relations).Error
+}
+
+// removeImagesFromAlbum 批量移出相册，封面被移除时恢复自动封面
+func removeImagesFromAlbum(db *gorm.DB, album *models.Album, imageIds []int) error {
+	if err := db.Where("album_id = ? AND image_id IN ?", album.Id, imageIds).Delete(&models.AlbumImage{}).Error; err != nil {
+		return err
+	}
+	for _, imageId := range imageIds {
+		if album.CoverImageId == imageId {
+			return db.Model(album).Update("cover_image_id", 0).Error
+		}
+	}
+	return nil
+}
+
+// deleteAlbum 删除相册及其图片关联
+func deleteAlbum(db *gorm.DB, album *models.Album) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("album_id = ?", album.Id).Delete(&models.AlbumImage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(album).Error
+	})
+}
+
+// toAlbumItem 补充相册图片数量和封面地址
+func toAlbumItem(db *gorm.DB, album models.Album) AlbumItem {
+	return toAlbumItems(db, []models.Album{album})[0]
+}
+
+// toAlbumItems 批量补充相册图片数量和封面地址，查询次数与相册数量无关
+func toAlbumItems(db *gorm.DB, albums []models.Album) []AlbumItem {
+	items := make([]AlbumItem, len(albums))
+	if len(albums) == 0 {
+		return items
+	}
+	albumIds := make([]int, len(albums))
+	for i, album := range albums {
+		items[i].Album = album
+		albumIds[i] = album.Id
+	}
+
+	// 按相册汇总图片数量
+	var counts []struct {
+		AlbumId int
+		Count   int64
+	}
+	db.Model(&models.AlbumImage{}).
+		Select("album_images.album_id AS album_id, COUNT(*) AS count").
+		Joins("JOIN images ON images.id = album_images.image_id AND images.deleted_at IS NULL").
+		Where("album_images.album_id IN ?", albumIds).
+		Group("album_images.album_id").
+		Scan(&counts)
+	countMap := make(map[int]int64, len(counts))
+	for _, row := range counts {
+		countMap[row.AlbumId] = row.Count
+	}
+
+	// 各相册最新的图片，用于未设置封面或封面已删除时
+	var latest []struct {
+		AlbumId int
+		ImageId int
+	}
+	latestCreatedAt := db.Table("album_images AS latest").
+		Select("MAX(li.created_at)").
+		Joins("JOIN images AS li ON li.id = latest.image_id AND li.deleted_at IS NULL").
+		Where("latest.album_id = album_images.album_id")
+	db.Model(&models.AlbumImage{}).
+		Select("album_images.album_id AS album_id, album_images.image_id AS image_id").
+		Joins("JOIN images ON images.id = album_images.image_id AND images.deleted_at IS NULL").
+		Where("album_images.album_id IN ?", albumIds).
+		Where("images.created_at = (?)", latestCreatedAt).
+		Scan(&latest)
+	latestMap := make(map[int]int, len(latest))
+	for _, row := range latest {
+		if _, ok := latestMap[row.AlbumId]; !ok {
+			latestMap[row.AlbumId] = row.ImageId
+		}
+	}
+
+	// 一次加载所有候选封面
+	coverIds := make([]int, 0, len(albums)*2)
+	for _, album := range albums {
+		if album.CoverImageId != 0 {
+			coverIds = append(coverIds, album.CoverImageId)
+		}
+		if id, ok := latestMap[album.Id]; ok {
+			coverIds = append(coverIds, id)
+		}
+	}
+	coverMap := make(map[int]models.Image)
+	if len(coverIds) > 0 {
+		var covers []models.Image
+		db.Where("id IN ?", coverIds).Find(&covers)
+		for _, cover := range covers {
+			coverMap[cover.Id] = cover
+		}
+	}
+
+	for i, album := range albums {
+		items[i].ImageCount = countMap[album.Id]
+		cover, found := coverMap[album.CoverImageId]
+		if !found {
+			cover, found = coverMap[latestMap[album.Id]]
+		}
+		if found {
+			items[i].CoverUrl = cover.Thumbnail
+			if items[i].CoverUrl == "" {
+				items[i].CoverUrl = cover.Url
+			}
+		}
+	}
+
+	return items
+}
+
+// albumImageIds 相册内图片ID子查询
+func albumImageIds(db *gorm.DB, albumId int) *gorm.DB {
+	return db.Model(&models.AlbumImage{}).Select("image_id").Where("album_id = ?", albumId)
+}
+
+// generateShareToken 生成相册分享标识
+func generateShareToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/apitoken"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateApiTokenRequest 创建API令牌请求
+type CreateApiTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=64"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 有效天数，0表示永不过期
+	UserId        int      `json:"user_id"`         // 仅管理员接口可用：为指定用户创建
+	S3            bool     `json:"s3"`              // 同时生成S3访问密钥对
+}
+
+// ListApiTokens 获取当前用户的API令牌列表
+func ListApiTokens(c *gin.Context) {
+	if middlewares.IsTokenAuth(c) {
+		c.JSON(http.StatusForbidden, result.Error(403, "API令牌不能用于管理令牌"))
+		return
+	}
+
+	db := database.GetDB().DB
+	var tokens []models.ApiToken
+	if err := db.Where("user_id = ?", c.GetInt("user_id")).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取令牌列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", tokens))
+}
+
+// CreateApiToken 为当前用户创建API令牌
+func CreateApiToken(c *gin.Context) {
+	if middlewares.IsTokenAuth(c) {
+		c.JSON(http.StatusForbidden, result.Error(403, "API令牌不能用于管理令牌"))
+		return
+	}
+
+	var req CreateApiTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	createApiToken(c, c.GetInt("user_id"), req)
+}
+
+// RevokeApiToken 撤销当前用户的API令牌
+func RevokeApiToken(c *gin.Context) {
+	if middlewares.IsTokenAuth(c) {
+		c.JSON(http.StatusForbidden, result.Error(403, "API令牌不能用于管理令牌"))
+		return
+	}
+
+	revokeApiToken(c, c.GetInt("user_id"))
+}
+
+// AdminListApiTokens 管理员获取全部API令牌（可按 user_id 过滤）
+func AdminListApiTokens(c *gin.Context) {
+	db := database.GetDB().DB
+	query := db.Model(&models.ApiToken{})
+	if userIdStr := c.Query("user_id"); userIdStr != "" {
+		userId, err := strconv.Atoi(userIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, result.Error(400, "用户ID无效"))
+			return
+		}
+		query = query.Where("user_id = ?", userId)
+	}
+
+	var tokens []models.ApiToken
+	if err := query.Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取令牌列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", tokens))
+}
+
+// AdminCreateApiToken 管理员为指定用户创建API令牌
+func AdminCreateApiToken(c *gin.Context) {
+	var req CreateApiTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	userId := req.UserId
+	if userId == 0 {
+		userId = c.GetInt("user_id")
+	}
+
+	createApiToken(c, userId, req)
+}
+
+// AdminRevokeApiToken 管理员撤销任意API令牌
+func AdminRevokeApiToken(c *gin.Context) {
+	revokeApiToken(c, 0)
+}
+
+// createApiToken 创建令牌（明文只返回一次）
+func createApiToken(c *gin.Context, userId int, req CreateApiTokenRequest) {
+	db := database.GetDB().DB
+
+	// 令牌必须归属于真实用户（游客没有数据库记录）
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "用户不存在，游客无法创建API令牌"))
+		return
+	}
+
+	scopes, err := apitoken.NormalizeScopes(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	// 令牌权限不能超出用户角色本身的权限
+	for _, s := range scopes {
+		if !models.RoleHasPermission(user.Role, s) {
+			c.JSON(http.StatusForbidden, result.Error(403, "当前用户角色不能授予权限："+s))
+			return
+		}
+	}
+
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "有效天数不能为负数"))
+		return
+	}
+
+	plain, hash, err := apitoken.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+		return
+	}
+
+	token := models.ApiToken{
+		UserId:    user.Id,
+		Name:      strings.TrimSpace(req.Name),
+		TokenHash: hash,
+		Prefix:    apitoken.DisplayPrefix(plain),
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if req.S3 {
+		token.AccessKey, token.SecretKey, err = apitoken.GenerateS3Credentials()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+			return
+		}
+	}
+
+	if err := db.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建令牌失败"))
+		return
+	}
+
+	data := map[string]any{
+		"token": plain,
+		"info":  token,
+	}
+	if req.S3 {
+		data["access_key"] = token.AccessKey
+		data["secret_key"] = token.SecretKey
+	}
+	c.JSON(http.StatusOK, result.Success("创建成功，令牌仅显示一次，请妥善保存", data))
+}
+
+// revokeApiToken 撤销令牌，ownerId 为0时不校验归属
+func revokeApiToken(c *gin.Context, ownerId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "令牌ID无效"))
+		return
+	}
+
+	db := database.GetDB().DB
+	query := db.Where("id = ?", id)
+	if ownerId != 0 {
+		query = query.Where("user_id = ?", ownerId)
+	}
+
+	var token models.ApiToken
+	if err := query.First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "令牌不存在"))
+		return
+	}
+
+	if err := db.Delete(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "撤销令牌失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("令牌已撤销", nil))
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// auditExportBatch 导出时每批读取的行数
+const auditExportBatch = 500
+
+// ListAuditLogs 分页获取审计日志
+// 筛选参数：action（可逗号分隔多个）、actor_id、target_type、target_id、ip、from、to（YYYY-MM-DD 或 RFC3339）
+func ListAuditLogs(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query, err := auditLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取审计日志失败"))
+		return
+	}
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取审计日志失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"logs":        logs,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	}))
+}
+
+// ExportAuditLogs 按筛选条件导出审计日志，format=csv（默认）或 jsonl
+func ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, result.Error(400, "导出格式仅支持 csv、jsonl"))
+		return
+	}
+
+	query, err := auditLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	filename := fmt.Sprintf("oneimg-audit-%s.%s", time.Now().Format("20060102-150405"), format)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	var write func(models.AuditLog) error
+	var flush func() error
+	if format == "csv" {
+		// BOM 便于 Excel 正确识别 UTF-8
+		c.Writer.WriteString("\xEF\xBB\xBF")
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"id", "created_at", "actor_id", "actor_name", "token_id", "ip", "action", "target_type", "target_id", "diff"})
+		write = func(l models.AuditLog) error {
+			return w.Write([]string{
+				strconv.Itoa(l.Id),
+				l.CreatedAt.Format(time.RFC3339),
+				strconv.Itoa(l.ActorId),
+				l.ActorName,
+				strconv.Itoa(l.TokenId),
+				l.IP,
+				l.Action,
+				l.TargetType,
+				l.TargetId,
+				l.Diff,
+			})
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		write = func(l models.AuditLog) error { return enc.Encode(l) }
+		flush = func() error { return nil }
+	}
+
+	// 边查询边输出，响应头已发送，出错时只能中断连接
+	var batch []models.AuditLog
+	err = query.Order("id ASC").FindInBatches(&batch, auditExportBatch, func(tx *gorm.DB, n int) error {
+		for _, l := range batch {
+			if err := write(l); err != nil {
+				return err
+			}
+		}
+		return flush()
+	}).Error
+	if err != nil {
+		log.Printf("导出审计日志失败：%v", err)
+		c.Abort()
+	}
+}
+
+// auditLogQuery 根据请求参数构造审计日志查询
+func auditLogQuery(c *gin.Context) (*gorm.DB, error) {
+	query := database.GetDB().DB.Model(&models.AuditLog{})
+
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action IN ?", strings.Split(action, ","))
+	}
+	if actorId := c.Query("actor_id"); actorId != "" {
+		id, err := strconv.Atoi(actorId)
+		if err != nil {
+			return nil, fmt.Errorf("无效的操作者ID")
+		}
+		query = query.Where("actor_id = ?", id)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetId := c.Query("target_id"); targetId != "" {
+		query = query.Where("target_id = ?", targetId)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if from := c.Query("from"); from != "" {
+		start, _, err := parseAuditTime(from)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if to := c.Query("to"); to != "" {
+		_, end, err := parseAuditTime(to)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ?", end)
+	}
+	return query, nil
+}
+
+// parseAuditTime 解析时间筛选参数，返回 [start, end)：日期表示整天，RFC3339 表示具体时刻
+func parseAuditTime(value string) (time.Time, time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t.Add(time.Second), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("时间格式无效：%s（支持 YYYY-MM-DD 或 RFC3339）", value)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/backup"
+	"oneimg/backend/utils/imagecache"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportBackup 下载备份包（数据库全部数据，uploads=true 时包含本地存储文件）
+func ExportBackup(c *gin.Context) {
+	db := database.GetDB()
+	includeUploads := c.Query("uploads") == "true"
+
+	filename := fmt.Sprintf("oneimg-backup-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// 边生成边输出，响应头已发送，出错时只能中断连接
+	if _, err := backup.Export(db.DB, db.DBType, c.Writer, includeUploads); err != nil {
+		log.Printf("生成备份失败：%v", err)
+		c.Abort()
+	}
+}
+
+// RestoreBackup 上传备份包并恢复，会覆盖当前全部数据
+func RestoreBackup(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请上传备份文件"))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "读取备份文件失败"))
+		return
+	}
+	defer file.Close()
+
+	zr, err := zip.NewReader(file, fileHeader.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "备份文件不是有效的zip文件"))
+		return
+	}
+
+	db := database.GetDB()
+	manifest, err := backup.Import(db.DB, db.DBType, zr, c.PostForm("uploads") == "true")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	// 图片ID可能已对应不同的图片，清空衍生缓存
+	imagecache.Purge()
+	audit.Record(c, models.AuditBackupRestore, "backup", fileHeader.Filename, nil, gin.H{
+		"backup_created_at": manifest.CreatedAt,
+		"tables":            manifest.Tables,
+		"uploads":           manifest.Uploads && c.PostForm("uploads") == "true",
+	})
+
+	// 用户ID可能已对应不同的用户，使全部会话失效
+	if err := middlewares.ClearSessionStore(); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "数据已恢复，但清除会话失败: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("恢复成功，请重新登录", manifest))
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/interfaces"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/chunkupload"
+	"oneimg/backend/utils/quota"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitChunkUploadRequest 创建分片上传会话请求
+type InitChunkUploadRequest struct {
+	FileName         string `json:"filename" binding:"required"`
+	FileSize         int64  `json:"file_size" binding:"required"`
+	ChunkSize        int64  `json:"chunk_size"`         // 分片大小（字节，可选，默认5MB）
+	StorageProfileId int    `json:"storage_profile_id"` // 存储配置方案ID（可选，0表示系统默认存储）
+	Hidden           bool   `json:"hidden"`
+}
+
+// ChunkUploadStatus 上传会话状态，客户端据此跳过已上传的分片
+type ChunkUploadStatus struct {
+	models.UploadSession
+	ReceivedChunks []int `json:"received_chunks"`
+}
+
+// InitChunkUpload 创建分片上传会话
+func InitChunkUpload(c *gin.Context) {
+	var req InitChunkUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	req.FileName = filepath.Base(strings.TrimSpace(req.FileName))
+	if req.FileName == "" || req.FileName == "." || req.FileName == string(filepath.Separator) {
+		c.JSON(http.StatusBadRequest, result.Error(400, "文件名无效"))
+		return
+	}
+	if req.FileSize <= 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "文件大小无效"))
+		return
+	}
+
+	chunkSize := req.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = chunkupload.DefaultChunkSize
+	}
+	if chunkSize < chunkupload.MinChunkSize || chunkSize > chunkupload.MaxChunkSize {
+		c.JSON(http.StatusBadRequest, result.Error(400, fmt.Sprintf("分片大小需在 %d KB 到 %d MB 之间", chunkupload.MinChunkSize/1024, chunkupload.MaxChunkSize/1024/1024)))
+		return
+	}
+
+	setting, err := settings.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取上传配置失败"))
+		return
+	}
+	cfg := c.MustGet("config").(*config.Config)
+
+	// 提前校验大小、配额和存储配置方案，避免上传完才发现失败
+	user := quota.GetUser(c.GetInt("user_id"), c.GetInt("user_role"))
+	maxSize := quota.EffectiveMaxFileSize(user, setting.MaxFileSize, cfg.MaxFileSize)
+	if req.FileSize > maxSize {
+		c.JSON(http.StatusBadRequest, result.Error(400, fmt.Sprintf("文件大小超过限制 (最大 %d MB)", maxSize/1024/1024)))
+		return
+	}
+	if err := quota.CheckStorageQuota(user, req.FileSize); err != nil {
+		c.JSON(http.StatusForbidden, result.Error(403, err.Error()))
+		return
+	}
+	if err := settings.ApplyUploadProfile(&setting, req.StorageProfileId, c.GetInt("user_role")); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB().DB
+	var active int64
+	db.Model(&models.UploadSession{}).
+		Where("user_id = ? AND uuid = ? AND expires_at > ?", c.GetInt("user_id"), GetUUID(c), time.Now()).
+		Count(&active)
+	if active >= chunkupload.MaxActiveSessions {
+		c.JSON(http.StatusTooManyRequests, result.Error(429, fmt.Sprintf("同时进行的分片上传不能超过 %d 个", chunkupload.MaxActiveSessions)))
+		return
+	}
+
+	id, err := chunkupload.NewId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建上传会话失败"))
+		return
+	}
+	session := models.UploadSession{
+		Id:               id,
+		UserId:           c.GetInt("user_id"),
+		UUID:             GetUUID(c),
+		FileName:         req.FileName,
+		FileSize:         req.FileSize,
+		ChunkSize:        chunkSize,
+		TotalChunks:      int((req.FileSize + chunkSize - 1) / chunkSize),
+		StorageProfileId: req.StorageProfileId,
+		Hidden:           req.Hidden,
+		Status:           models.UploadSessionUploading,
+		ExpiresAt:        time.Now().Add(chunkupload.Expire()),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建上传会话失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("创建成功", ChunkUploadStatus{UploadSession: session, ReceivedChunks: []int{}}))
+}
+
+// GetChunkUpload 查询上传会话及已接收的分片，用于断点续传
+func GetChunkUpload(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", ChunkUploadStatus{
+		UploadSession:  session,
+		ReceivedChunks: chunkupload.ReceivedParts(session.Id, session.TotalChunks),
+	}))
+}
+
+// UploadChunk 上传单个分片，请求体为分片的原始字节
+// 同一分片可重复上传，后一次覆盖前一次
+func UploadChunk(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.UploadSessionUploading {
+		c.JSON(http.StatusConflict, result.Error(409, "上传会话正在合并，不能继续上传分片"))
+		return
+	}
+
+	index, err := chunkupload.ParseIndex(c.Param("index"), session.TotalChunks)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	size := session.ChunkLength(index)
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, size+1)
+	if err := chunkupload.SavePart(session.Id, index, body, size); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	// 有进展的会话顺延过期时间
+	database.GetDB().DB.Model(&session).Update("expires_at", time.Now().Add(chunkupload.Expire()))
+
+	c.JSON(http.StatusOK, result.Success("分片上传成功", gin.H{
+		"index":           index,
+		"received_chunks": chunkupload.ReceivedParts(session.Id, session.TotalChunks),
+	}))
+}
+
+// CompleteChunkUpload 合并全部分片并交给存储上传器处理
+func CompleteChunkUpload(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+
+	received := chunkupload.ReceivedParts(session.Id, session.TotalChunks)
+	if len(received) != session.TotalChunks {
+		c.JSON(http.StatusBadRequest, result.Error(400, fmt.Sprintf("分片未全部上传（%d/%d）", len(received), session.TotalChunks)))
+		return
+	}
+
+	// 标记为合并中，防止重复提交
+	db := database.GetDB().DB
+	claim := db.Model(&models.UploadSession{}).
+		Where("id = ? AND status = ?", session.Id, models.UploadSessionUploading).
+		Update("status", models.UploadSessionCompleting)
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, result.Error(409, "上传会话正在合并中"))
+		return
+	}
+	// 失败时恢复状态，客户端可重新上传出错的分片后再次提交
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			db.Model(&models.UploadSession{}).Where("id = ?", session.Id).Update("status", models.UploadSessionUploading)
+		}
+	}()
+
+	setting, err := settings.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取上传配置失败"))
+		return
+	}
+	cfg := c.MustGet("config").(*config.Config)
+
+	user := quota.GetUser(c.GetInt("user_id"), c.GetInt("user_role"))
+	uploadCfg := *cfg
+	uploadCfg.MaxFileSize = quota.EffectiveMaxFileSize(user, setting.MaxFileSize, cfg.MaxFileSize)
+	if err := quota.CheckStorageQuota(user, session.FileSize); err != nil {
+		c.JSON(http.StatusForbidden, result.Error(403, err.Error()))
+		return
+	}
+
+	if err := settings.ApplyProfile(&setting, session.StorageProfileId); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+	uploader, err := getStorageUploader(&setting)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	// 按文件内容识别类型，不信任客户端声明
+	contentType := http.DetectContentType(chunkupload.ReadHead(session.Id, 512))
+	fileHeader, form, err := chunkupload.FileHeader(session, contentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+		return
+	}
+	defer form.RemoveAll()
+
+	uploadSetting := deferUploadProcessing(setting)
+	fileResult, err := uploader.Upload(c, &uploadCfg, &uploadSetting, fileHeader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "上传失败: "+err.Error()))
+		return
+	}
+
+	// 记录保存失败时保留会话和分片，客户端可再次提交
+	if image := saveUploadedImage(c, setting, fileResult, session.Hidden); image.Id == 0 {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "保存图片记录失败"))
+		return
+	}
+
+	succeeded = true
+	db.Delete(&session)
+	chunkupload.Remove(session.Id)
+
+	c.JSON(http.StatusOK, result.Success("上传成功", map[string]any{
+		"files": []interfaces.ImageUploadResult{*fileResult},
+		"count": 1,
+	}))
+}
+
+// AbortChunkUpload 取消上传会话并删除已上传的分片
+func AbortChunkUpload(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.UploadSessionUploading {
+		c.JSON(http.StatusConflict, result.Error(409, "上传会话正在合并，无法取消"))
+		return
+	}
+
+	database.GetDB().DB.Delete(&session)
+	chunkupload.Remove(session.Id)
+
+	c.JSON(http.StatusOK, result.Success("已取消上传", nil))
+}
+
+// loadUploadSession 加载当前用户未过期的上传会话
+func loadUploadSession(c *gin.Context) (models.UploadSession, bool) {
+	var session models.UploadSession
+	err := database.GetDB().DB.
+		Where("id = ? AND user_id = ? AND uuid = ? AND expires_at > ?", c.Param("id"), c.GetInt("user_id"), GetUUID(c), time.Now()).
+		First(&session).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "上传会话不存在或已过期"))
+		return session, false
+	}
+	return session, true
+}
@@ -7,22 +7,28 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"oneimg/backend/database"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
 	"oneimg/backend/utils/customapi"
 	"oneimg/backend/utils/ftp"
+	"oneimg/backend/utils/imagecache"
 	"oneimg/backend/utils/md5"
 	"oneimg/backend/utils/result"
 	"oneimg/backend/utils/s3"
 	"oneimg/backend/utils/settings"
 	"oneimg/backend/utils/telegram"
 	"oneimg/backend/utils/webdav"
+	"oneimg/backend/utils/webhooks"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DeleteImage 删除图片
@@ -67,17 +73,16 @@ func DeleteImage(c *gin.Context) {
 		return
 	}
 
-	// 删除存储文件
-	deleteStatus := DeleteImageFile(image)
-
-	// 删除数据库记录
-	if err := db.Unscoped().Delete(&image).Error; err != nil {
+	// 删除存储文件和数据库记录
+	deleteStatus, err := removeImage(db, image)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
 			"msg":  "删除图片记录失败",
 		})
 		return
 	}
+	audit.Record(c, models.AuditImageDelete, "image", image.Id, image, nil)
 
 	if !deleteStatus {
 		c.JSON(http.StatusOK, result.Success(
@@ -90,6 +95,21 @@ func DeleteImage(c *gin.Context) {
 	c.JSON(http.StatusOK, result.Success("删除成功", nil))
 }
 
+// removeImage 删除图片的存储文件和数据库记录，并清理相册、标签及S3对象关联
+// 返回值表示物理文件是否删除成功
+func removeImage(db *gorm.DB, image models.Image) (bool, error) {
+	deleteStatus, err := deleteImageObject(db, image)
+	if err != nil {
+		return deleteStatus, err
+	}
+
+	RemoveImageFromAlbums(db, image.Id)
+	RemoveImageTags(db, image.Id)
+	RemoveImageS3Objects(db, image.Id)
+	webhooks.Dispatch(models.EventImageDeleted, image)
+	return deleteStatus, nil
+}
+
 // DeleteImageRecord 仅删除图片记录（不删除存储文件）
 // 用于首页"最近上传"批量删除记录，图片仍保留在画廊
 func DeleteImageRecord(c *gin.Context) {
@@ -133,6 +153,7 @@ func DeleteImageRecord(c *gin.Context) {
 		return
 	}
 
+	before := image
 	// 仅删除数据库记录（软删除/隐藏），不删除存储文件
 	if err := db.Model(&image).Update("hidden", true).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -141,6 +162,9 @@ func DeleteImageRecord(c *gin.Context) {
 		})
 		return
 	}
+	image.Hidden = true
+	webhooks.Dispatch(models.EventImageHidden, image)
+	audit.Record(c, models.AuditImageHide, "image", image.Id, before, image)
 
 	c.JSON(http.StatusOK, result.Success("记录删除成功", nil))
 }
@@ -227,8 +251,8 @@ func DeleteDefaultStorageImage(image models.Image) (deleteStatus bool) {
 
 // 删除S3存储的图片
 func DeleteS3StorageImage(image models.Image) (deleteStatus bool) {
-	// 获取系统配置
-	setting, err := settings.GetSettings()
+	// 获取图片所属存储配置
+	setting, err := settings.ForImage(image)
 	if err != nil {
 		return false
 	}
@@ -239,6 +263,9 @@ func DeleteS3StorageImage(image models.Image) (deleteStatus bool) {
 	}
 	objectKey := strings.TrimPrefix(image.Url, "/")
 	bucket := setting.S3Bucket
+	if image.Storage == "r2" {
+		bucket = setting.R2Bucket
+	}
 	if bucket == "" || objectKey == "" {
 		return false
 	}
@@ -270,8 +297,8 @@ func DeleteS3StorageImage(image models.Image) (deleteStatus bool) {
 
 // 删除WebDAV存储的图片
 func DeleteWebDavStorageImage(image models.Image) (deleteStatus bool) {
-	// 获取系统配置
-	setting, err := settings.GetSettings()
+	// 获取图片所属存储配置
+	setting, err := settings.ForImage(image)
 	if err != nil {
 		return false
 	}
@@ -303,8 +330,8 @@ func DeleteWebDavStorageImage(image models.Image) (deleteStatus bool) {
 
 // 删除FTP存储的图片
 func DeleteFtpStorageImage(image models.Image) (deleteStatus bool) {
-	// 获取系统配置
-	setting, err := settings.GetSettings()
+	// 获取图片所属存储配置
+	setting, err := settings.ForImage(image)
 	if err != nil {
 		return false
 	}
@@ -334,8 +361,8 @@ func DeleteFtpStorageImage(image models.Image) (deleteStatus bool) {
 
 // 删除TG存储的图片
 func DeleteTelegramStorageImage(image models.Image) (deleteStatus bool) {
-	// 获取系统配置
-	setting, err := settings.GetSettings()
+	// 获取图片所属存储配置
+	setting, err := settings.ForImage(image)
 	if err != nil {
 		return false
 	}
@@ -370,8 +397,8 @@ func DeleteTelegramStorageImage(image models.Image) (deleteStatus bool) {
 
 // 删除Custom API存储的图片
 func DeleteCustomApiStorageImage(image models.Image) (deleteStatus bool) {
-	// 获取配置
-	setting, err := settings.GetSettings()
+	// 获取图片所属存储配置
+	setting, err := settings.ForImage(image)
 	if err != nil {
 		return false
 	}
@@ -394,6 +421,44 @@ func DeleteCustomApiStorageImage(image models.Image) (deleteStatus bool) {
 	return true
 }
 
+// deleteImageMu 串行化本实例内的删除（SQLite 不支持行锁，只能单实例运行）
+var deleteImageMu sync.Mutex
+
+// deleteImageObject 删除图片记录，并在没有其他记录引用同一存储对象时删除物理文件
+// 去重后多条记录可能引用同一存储对象，删除记录与统计剩余引用在同一事务中完成，
+// 并先锁定引用同一对象的全部记录，避免并发删除时双方都看到对方的记录而跳过物理删除
+// 返回值表示物理文件是否删除成功
+func deleteImageObject(db *gorm.DB, image models.Image) (bool, error) {
+	deleteImageMu.Lock()
+	var remaining int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// SQLite 事务中先读后写会与其他写入互相等待而报 database is locked
+		if tx.Dialector.Name() != "sqlite" {
+			var ids []int
+			if err := objectReferences(tx, image).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Order("id").Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Delete(&image).Error; err != nil {
+			return err
+		}
+		return objectReferences(tx, image).Count(&remaining).Error
+	})
+	deleteImageMu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	// 清理该图片的水印/变换缓存
+	imagecache.InvalidateImage(image.Id)
+
+	if remaining > 0 {
+		return true, nil
+	}
+	return DeleteImageFile(image), nil
+}
+
 // DeleteImageFile 删除图片文件（根据存储类型分发）
 func DeleteImageFile(image models.Image) bool {
 	var deleteStatus bool
@@ -422,8 +487,12 @@ func DeleteImageFile(image models.Image) bool {
 func CheckImageAccessPermission(c *gin.Context, image models.Image) bool {
 	currentUserUUID := GetUUID(c)
 	currentUsername := c.GetString("username")
-	// 如果是管理员直接通过
-	if c.GetInt("user_role") == 1 {
+	// 如果是管理员/编辑直接通过
+	if models.CanManageAllImages(c.GetInt("user_role")) {
+		return true
+	}
+	// 注册用户按用户ID校验归属
+	if c.GetInt("user_role") != models.RoleTourist && image.UserId == c.GetInt("user_id") {
 		return true
 	}
 	// 如果是游客则需要同时满足md5校验和UUID校验
@@ -432,3 +501,20 @@ func CheckImageAccessPermission(c *gin.Context, image models.Image) bool {
 	}
 	return false
 }
+
+// countObjectReferences 统计除自身外仍引用同一存储对象的图片记录数
+func countObjectReferences(db *gorm.DB, image models.Image) int64 {
+	var count int64
+	objectReferences(db, image).Where("id <> ?", image.Id).Count(&count)
+	return count
+}
+
+// objectReferences 引用同一存储对象的图片记录（含已隐藏的记录）
+func objectReferences(db *gorm.DB, image models.Image) *gorm.DB {
+	query := db.Unscoped().Model(&models.Image{})
+	if image.ContentHash == "" {
+		return query.Where("id = ?", image.Id)
+	}
+	return query.Where("content_hash = ? AND storage = ? AND storage_profile_id = ? AND url = ?",
+		image.ContentHash, image.Storage, image.StorageProfileId, image.Url)
+}
@@ -43,6 +43,10 @@ func GetImageDetail(c *gin.Context) {
 		return
 	}
 
+	images := []models.Image{image}
+	attachImageTags(db, images)
+	image = images[0]
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "获取图片详情成功",
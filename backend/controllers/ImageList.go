@@ -7,8 +7,10 @@ import (
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 	"oneimg/backend/utils/result"
+	imagesearch "oneimg/backend/utils/search"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetImageList 获取图片列表
@@ -56,8 +58,16 @@ func GetImageList(c *gin.Context) {
 		}
 	}
 
-	if c.GetInt("user_role") != 1 || role == "" {
-		query = query.Where("uuid = ?", GetUUID(c))
+	// 按相册过滤（相册内的图片对有权访问相册的用户可见）
+	albumIdStr := c.Query("album_id")
+	if albumIdStr != "" {
+		album, ok := loadAccessibleAlbum(c, albumIdStr)
+		if !ok {
+			return
+		}
+		query = query.Where("id IN (?)", albumImageIds(db, album.Id))
+	} else if !models.CanManageAllImages(c.GetInt("user_role")) || role == "" {
+		query = scopeOwnImages(c, query)
 	}
 
 	// 过滤最近上传
@@ -84,6 +94,16 @@ func GetImageList(c *gin.Context) {
 		query = query.Where("file_name LIKE ?", "%"+search+"%")
 	}
 
+	// 高级查询（标签、类型、大小、尺寸、存储、日期、上传者）
+	if q := c.Query("q"); q != "" {
+		parsed, err := imagesearch.Parse(q)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, result.Error(400, "查询语法错误: "+err.Error()))
+			return
+		}
+		query = parsed.Apply(query)
+	}
+
 	// 获取总数
 	if err := query.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -130,6 +150,8 @@ func GetImageList(c *gin.Context) {
 		return
 	}
 
+	attachImageTags(db, images)
+
 	// 计算总页数
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 
@@ -141,3 +163,11 @@ func GetImageList(c *gin.Context) {
 		"total_pages": totalPages,
 	}))
 }
+
+// scopeOwnImages 限定为当前用户自己的图片（游客按UUID，注册用户按用户ID）
+func scopeOwnImages(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if c.GetInt("user_role") == models.RoleTourist {
+		return query.Where("uuid = ?", GetUUID(c))
+	}
+	return query.Where("user_id = ?", c.GetInt("user_id"))
+}
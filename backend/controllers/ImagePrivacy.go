@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/imagecache"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/signurl"
+	"oneimg/backend/utils/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SignedURLRequest 生成签名链接请求
+type SignedURLRequest struct {
+	ExpiresIn int `json:"expires_in"` // 有效期（秒），默认1小时，最长7天
+}
+
+// SignedURLResponse 签名链接
+type SignedURLResponse struct {
+	Url       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SetImagePrivateRequest 设置私有图片请求
+type SetImagePrivateRequest struct {
+	Private bool `json:"private"`
+}
+
+// CreateSignedURL 为图片生成限时访问的签名链接
+func CreateSignedURL(c *gin.Context) {
+	image, ok := loadAccessibleImage(c)
+	if !ok {
+		return
+	}
+
+	var req SignedURLRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+			return
+		}
+	}
+
+	ttl := signurl.DefaultTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > signurl.MaxTTL {
+		c.JSON(http.StatusBadRequest, result.Error(400, "有效期需在1秒到"+strconv.Itoa(int(signurl.MaxTTL.Hours()/24))+"天之间"))
+		return
+	}
+
+	if !isProxiedPath(image.Url) {
+		c.JSON(http.StatusBadRequest, result.Error(400, "该图片由外部地址直接访问，无法生成签名链接"))
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	resp := SignedURLResponse{
+		Url:       signurl.SignURL(image.Url, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	if isProxiedPath(image.Thumbnail) {
+		resp.Thumbnail = signurl.SignURL(image.Thumbnail, expiresAt)
+	}
+
+	c.JSON(http.StatusOK, result.Success("生成成功", resp))
+}
+
+// SetImagePrivate 设置或取消私有图片，私有图片只能通过签名链接访问
+func SetImagePrivate(c *gin.Context) {
+	image, ok := loadAccessibleImage(c)
+	if !ok {
+		return
+	}
+
+	var req SetImagePrivateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	if req.Private && !isProxiedPath(image.Url) {
+		c.JSON(http.StatusBadRequest, result.Error(400, "该图片由外部地址直接访问，无法设为私有"))
+		return
+	}
+
+	db := database.GetDB().DB
+
+	// 去重后的文件可能被其他记录共用，设为私有前先复制为独立文件，避免影响其他记录的公开访问
+	if req.Private && !image.Private && countObjectReferences(db, image) > 0 {
+		detached, err := detachSharedObject(c.Request.Context(), db, image)
+		if err != nil {
+			c.JSON(http.StatusConflict, result.Error(409, "该图片与其他记录共用同一文件，复制失败: "+err.Error()))
+			return
+		}
+		image = detached
+	}
+
+	if err := db.Model(&image).Update("private", req.Private).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "更新失败"))
+		return
+	}
+	image.Private = req.Private
+
+	c.JSON(http.StatusOK, result.Success("更新成功", image))
+}
+
+// detachSharedObject 将图片当前的文件复制为独立的新文件并更新该记录的地址，其他记录仍使用原文件
+func detachSharedObject(ctx context.Context, db *gorm.DB, image models.Image) (models.Image, error) {
+	// Telegram 文件按文件名关联，复制后需要改名，会影响游客图片的权限校验
+	if image.Storage == storage.TypeTelegram || !storage.CanWrite(image.Storage) {
+		return image, errors.New("当前存储不支持复制文件")
+	}
+
+	setting, err := settings.ForStorage(image.Storage, image.StorageProfileId)
+	if err != nil {
+		return image, err
+	}
+	backend, err := storage.New(image.Storage, setting)
+	if err != nil {
+		return image, err
+	}
+
+	obj, err := backend.Read(ctx, image)
+	if err != nil {
+		return image, err
+	}
+	obj.Key = path.Join(path.Dir(obj.Key), fmt.Sprintf("%d_%s%s", time.Now().UnixMilli(), uuid.New().String()[:8], path.Ext(obj.Key)))
+	loc, err := backend.Write(ctx, obj)
+	if err != nil {
+		return image, err
+	}
+	if err := backend.Verify(ctx, obj, loc); err != nil {
+		return image, err
+	}
+
+	// 原记录没有独立缩略图时沿用原图地址
+	if image.Thumbnail == image.Url || loc.Thumbnail == "" {
+		loc.Thumbnail = loc.Url
+	}
+	if image.Thumbnail == "" {
+		loc.Thumbnail = ""
+	}
+
+	original := image
+	deleteImageMu.Lock()
+	defer deleteImageMu.Unlock()
+	if err := db.Model(&image).Updates(map[string]interface{}{"url": loc.Url, "thumbnail": loc.Thumbnail}).Error; err != nil {
+		return original, err
+	}
+	image.Url = loc.Url
+	image.Thumbnail = loc.Thumbnail
+	imagecache.InvalidateImage(image.Id)
+
+	// 复制期间其他记录可能已被删除，原文件不再被引用时一并清理
+	if countObjectReferences(db, original) == 0 {
+		DeleteImageFile(original)
+	}
+	return image, nil
+}
+
+// loadAccessibleImage 根据路径参数加载当前用户有权操作的图片
+func loadAccessibleImage(c *gin.Context) (models.Image, bool) {
+	var image models.Image
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "图片ID无效"))
+		return image, false
+	}
+
+	if err := database.GetDB().DB.First(&image, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "图片不存在"))
+		return image, false
+	}
+
+	if !CheckImageAccessPermission(c, image) {
+		c.JSON(http.StatusForbidden, result.Error(403, "无权访问"))
+		return image, false
+	}
+	return image, true
+}
+
+// isProxiedPath 是否为经由本站图片代理访问的路径
+func isProxiedPath(path string) bool {
+	return strings.HasPrefix(path, "/uploads/")
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+
+	"oneimg/backend/models"
+	"oneimg/backend/utils/imagecache"
+	"oneimg/backend/utils/images"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/watermark"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedResponseWriter 缓存代理函数的输出，用于处理后再返回给客户端
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int { return w.body.Len() }
+
+func (w *bufferedResponseWriter) Written() bool { return w.status != 0 }
+
+func (w *bufferedResponseWriter) Flush() {}
+
+// serveDerivedImage 返回水印/变换后的衍生图片
+// 结果按图片ID、访问路径和规范化参数缓存；未命中时执行 fetch 取回代理输出再处理
+// 取回失败（非200）时原样返回代理函数的错误响应，且不缓存
+func serveDerivedImage(c *gin.Context, imageModel models.Image, path string, watermarkCfg watermark.WatermarkConfig, opts images.TransformOptions, fetch func()) {
+	key := imagecache.Key(imageModel.Id, path, watermarkCfg.CacheKey(), opts.CacheKey())
+	if entry, ok := imagecache.Get(imageModel.Id, key); ok {
+		serveCachedEntry(c, entry, "HIT")
+		return
+	}
+
+	// 处理需要完整原图，忽略分段和条件请求
+	rangeHeader := c.Request.Header.Get("Range")
+	c.Request.Header.Del("Range")
+	c.Request.Header.Del("If-Modified-Since")
+	c.Request.Header.Del("If-None-Match")
+
+	original := c.Writer
+	buffered := &bufferedResponseWriter{ResponseWriter: original}
+	c.Writer = buffered
+	fetch()
+	c.Writer = original
+
+	if rangeHeader != "" {
+		c.Request.Header.Set("Range", rangeHeader)
+	}
+
+	header := original.Header()
+	header.Del("Transfer-Encoding")
+
+	if buffered.Status() != http.StatusOK {
+		header.Set("Content-Length", strconv.Itoa(buffered.body.Len()))
+		original.WriteHeader(buffered.Status())
+		original.Write(buffered.body.Bytes())
+		return
+	}
+
+	data := buffered.body.Bytes()
+	// 水印处理会重新编码，按实际内容识别类型
+	mimeType := http.DetectContentType(data)
+	if !opts.IsEmpty() {
+		var err error
+		data, mimeType, err = images.Transform(data, opts)
+		if err != nil {
+			log.Printf("图片变换失败 [%s]: %v", c.Request.URL.Path, err)
+			header.Del("Content-Length")
+			header.Del("Content-Type")
+			c.JSON(http.StatusUnprocessableEntity, result.Error(422, "图片变换失败: "+err.Error()))
+			return
+		}
+	}
+
+	entry := imagecache.Set(imageModel.Id, key, data, mimeType)
+	serveCachedEntry(c, entry, "MISS")
+}
+
+// serveCachedEntry 返回缓存条目，支持 ETag/Last-Modified 条件请求
+func serveCachedEntry(c *gin.Context, entry *imagecache.Entry, status string) {
+	header := c.Writer.Header()
+	header.Del("Transfer-Encoding")
+	header.Del("Content-Length")
+	header.Set("Content-Type", entry.ContentType)
+	header.Set("ETag", entry.ETag)
+	header.Set("Cache-Control", proxyCacheControl(c))
+	header.Set("Access-Control-Allow-Origin", "*")
+	header.Set("X-Cache", status)
+	header.Add("Vary", "Accept")
+
+	http.ServeContent(c.Writer, c.Request, "", entry.ModTime, bytes.NewReader(entry.Data))
+}
@@ -1,15 +1,22 @@
 package controllers
 
 import (
+	"fmt"
 	"log"
+	"net/http"
 	"oneimg/backend/config"
 	"oneimg/backend/database"
 	"oneimg/backend/interfaces"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/jobs"
 	"oneimg/backend/utils/md5"
+	"oneimg/backend/utils/quota"
+	"oneimg/backend/utils/ratelimit"
 	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/storage"
 	"oneimg/backend/utils/telegram"
 	"oneimg/backend/utils/uploads"
+	"oneimg/backend/utils/webhooks"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -35,15 +42,17 @@ func UploadImages(c *gin.Context) {
 	}
 
 	// 解析并校验上传文件
-	// 优先使用数据库配置的最大文件大小
-	maxSize := setting.MaxFileSize
-	if maxSize <= 0 {
-		maxSize = cfg.MaxFileSize
-	}
+	// 优先使用用户单独配置的大小上限，其次数据库配置，最后环境变量
+	user := quota.GetUser(c.GetInt("user_id"), c.GetInt("user_role"))
+	maxSize := quota.EffectiveMaxFileSize(user, setting.MaxFileSize, cfg.MaxFileSize)
+
+	// 上传器内部按 cfg.MaxFileSize 校验，这里传入按用户调整后的副本
+	uploadCfg := *cfg
+	uploadCfg.MaxFileSize = maxSize
 
 	files, err := uc.ParseAndValidateFiles(maxSize)
 	if err != nil {
-		uc.Fail(400, "文件解析失败: "+err.Error())
+		uc.Fail(400, "文件解析失败: %v", err)
 		return
 	}
 
@@ -54,12 +63,21 @@ func UploadImages(c *gin.Context) {
 		return
 	}
 
+	// 缩略图、水印和格式转换交由后台任务处理
+	uploadSetting := deferUploadProcessing(setting)
+
 	// 批量处理文件上传（参数匹配接口定义）
 	uploadResults := make([]interfaces.ImageUploadResult, 0, len(files))
 	successCount := 0
 
 	for _, file := range files {
-		fileResult, err := uploader.Upload(c, cfg, &setting, file)
+		// 校验用户存储配额
+		if err := quota.CheckStorageQuota(user, file.Size); err != nil {
+			uc.Fail(403, "文件[%s]上传失败：%v", file.Filename, err)
+			return
+		}
+
+		fileResult, err := uploader.Upload(c, &uploadCfg, &uploadSetting, file)
 		if err != nil {
 			// 单个文件上传失败不影响其他文件
 			uc.Fail(500, "文件[%s]上传失败：%v", file.Filename, err)
@@ -67,50 +85,9 @@ func UploadImages(c *gin.Context) {
 		}
 
 		// 保存图片信息到数据库
-		isHidden := c.Query("hidden") == "true"
-		imageModel := models.Image{
-			Url:       fileResult.URL,
-			Thumbnail: fileResult.ThumbnailURL,
-			FileName:  fileResult.FileName,
-			FileSize:  fileResult.FileSize,
-			MimeType:  fileResult.MimeType,
-			Width:     fileResult.Width,
-			Height:    fileResult.Height,
-			Storage:   fileResult.Storage,
-			UserId:    c.GetInt("user_id"),
-			MD5:       md5.Md5(c.GetString("username") + fileResult.FileName),
-			UUID:      GetUUID(c),
-			Hidden:    isHidden,
-		}
-
-		db := database.GetDB()
-		if db != nil {
-			db.DB.Create(&imageModel)
-		}
-
+		saveUploadedImage(c, setting, fileResult, c.Query("hidden") == "true")
 		uploadResults = append(uploadResults, *fileResult)
 
-		if setting.TGNotice {
-			placeholderData := telegram.PlaceholderData{
-				Username:    c.GetString("username"),
-				Date:        time.Now().Format("2006-01-02 15:04:05"),
-				Filename:    fileResult.FileName,
-				StorageType: setting.StorageType,
-				URL:         formatNotificationURL(c.Request.Host, fileResult.URL),
-			}
-
-			err := telegram.SendSimpleMsg(
-				setting.TGBotToken,   // 机器人Token
-				setting.TGReceivers,  // 接收者ChatID
-				setting.TGNoticeText, // 模板文本
-				placeholderData,      // 占位符数据
-			)
-			if err != nil {
-				log.Println(err)
-				// 忽略错误
-			}
-		}
-
 		successCount++
 	}
 
@@ -130,3 +107,111 @@ func UploadImages(c *gin.Context) {
 func UploadImage(c *gin.Context) {
 	UploadImages(c)
 }
+
+// uploadImageData 将内存中的文件按正常上传流程写入存储并保存图片记录
+// 文件类型按内容识别，大小和配额由调用方事先校验
+func uploadImageData(c *gin.Context, cfg *config.Config, setting models.Settings, maxSize int64, filename string, data []byte, hidden bool) (models.Image, error) {
+	uploadCfg := *cfg
+	uploadCfg.MaxFileSize = maxSize
+	uploader, err := getStorageUploader(&setting)
+	if err != nil {
+		return models.Image{}, err
+	}
+
+	contentType := http.DetectContentType(data)
+	uploadSetting := deferUploadProcessing(setting)
+	fileResult, err := uploader.Upload(c, &uploadCfg, &uploadSetting, createFileHeader(filename, contentType, data))
+	if err != nil {
+		return models.Image{}, fmt.Errorf("上传失败: %v", err)
+	}
+
+	image := saveUploadedImage(c, setting, fileResult, hidden)
+	if image.Id == 0 {
+		return image, fmt.Errorf("保存图片记录失败")
+	}
+	return image, nil
+}
+
+// deferUploadProcessing 返回实际上传时使用的设置：可写入的存储改由后台任务生成缩略图、添加水印和转换格式，缩短上传请求耗时
+// 自定义API等无法单独写入缩略图的存储仍在上传时处理
+// Telegram 覆盖写入会生成新的文件，配置了自定义域名的 S3/R2 不经过代理访问（处理完成前会直接暴露原图），这两类只延后缩略图
+func deferUploadProcessing(setting models.Settings) models.Settings {
+	storageType := setting.GetEffectiveStorageType()
+	if !storage.CanWrite(storageType) {
+		return setting
+	}
+	setting.Thumbnail = false
+
+	switch {
+	case storageType == storage.TypeTelegram:
+	case storageType == storage.TypeS3 && setting.S3CustomURL != "":
+	case storageType == storage.TypeR2 && setting.R2CustomURL != "":
+	default:
+		setting.DeferProcessing = true
+	}
+	return setting
+}
+
+// saveUploadedImage 保存上传结果到数据库，并创建缩略图生成、TG通知等后台任务
+// setting 为上传前的原始设置（未经 deferUploadProcessing 处理）
+func saveUploadedImage(c *gin.Context, setting models.Settings, fileResult *interfaces.ImageUploadResult, hidden bool) models.Image {
+	imageModel := models.Image{
+		Url:              fileResult.URL,
+		Thumbnail:        fileResult.ThumbnailURL,
+		FileName:         fileResult.FileName,
+		FileSize:         fileResult.FileSize,
+		MimeType:         fileResult.MimeType,
+		Width:            fileResult.Width,
+		Height:           fileResult.Height,
+		Storage:          fileResult.Storage,
+		StorageProfileId: setting.StorageProfileId,
+		ContentHash:      fileResult.ContentHash,
+		ProcessKey:       fileResult.ProcessKey,
+		UserId:           c.GetInt("user_id"),
+		MD5:              md5.Md5(c.GetString("username") + fileResult.FileName),
+		UUID:             GetUUID(c),
+		Hidden:           hidden,
+		Processing:       fileResult.Deferred,
+	}
+
+	db := database.GetDB()
+	if db == nil || db.DB.Create(&imageModel).Error != nil {
+		return imageModel
+	}
+	fileResult.ID = imageModel.Id
+	fileResult.Status = "ready"
+	ratelimit.ConsumeRequest(c, fileResult.FileSize)
+	webhooks.Dispatch(models.EventImageUploaded, imageModel)
+
+	// 主图处理（完成后由任务继续创建缩略图任务）
+	// 缩略图（去重复用的对象缩略图尚未生成时也补建任务，任务会跳过已生成的情况）
+	if fileResult.Deferred {
+		enqueueUploadJob(fileResult, models.JobTypeVariant, imageModel, jobs.NewVariantPayload(setting))
+	} else if setting.Thumbnail && fileResult.ThumbnailURL == "" && storage.CanWrite(fileResult.Storage) {
+		enqueueUploadJob(fileResult, models.JobTypeThumbnail, imageModel, nil)
+	}
+
+	if setting.TGNotice {
+		placeholderData := telegram.PlaceholderData{
+			Username:    c.GetString("username"),
+			Date:        time.Now().Format("2006-01-02 15:04:05"),
+			Filename:    fileResult.FileName,
+			StorageType: setting.StorageType,
+			URL:         formatNotificationURL(c.Request.Host, fileResult.URL),
+		}
+		enqueueUploadJob(fileResult, models.JobTypeNotify, imageModel, placeholderData)
+	}
+
+	return imageModel
+}
+
+// enqueueUploadJob 创建上传后处理任务并记录到上传结果中，创建失败不影响上传
+func enqueueUploadJob(fileResult *interfaces.ImageUploadResult, jobType string, image models.Image, payload any) {
+	job, err := jobs.Enqueue(jobType, image.Id, image.UserId, payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	fileResult.Status = models.JobPending
+	fileResult.Jobs = append(fileResult.Jobs, job.Id)
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/jobs"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListJobs 获取后台任务列表，可按 status / type / image_id 筛选
+// 可管理所有图片的角色查看全部任务，其他用户只能查看自己图片的任务
+func ListJobs(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := database.GetDB().DB
+	query := scopeOwnJobs(c, db, db.Model(&models.Job{}))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+	if imageId := c.Query("image_id"); imageId != "" {
+		query = query.Where("image_id = ?", imageId)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取任务列表失败"))
+		return
+	}
+
+	var list []models.Job
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取任务列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"jobs":        list,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	}))
+}
+
+// GetJob 获取后台任务状态
+func GetJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的任务ID"))
+		return
+	}
+
+	db := database.GetDB().DB
+	var job models.Job
+	if err := scopeOwnJobs(c, db, db.Model(&models.Job{})).Where("id = ?", id).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "任务不存在"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", job))
+}
+
+// RetryJob 重新执行失败的后台任务
+func RetryJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的任务ID"))
+		return
+	}
+
+	job, err := jobs.Retry(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("任务已重新排队", job))
+}
+
+// scopeOwnJobs 限定为当前用户自己图片的任务
+func scopeOwnJobs(c *gin.Context, db *gorm.DB, query *gorm.DB) *gorm.DB {
+	if models.CanManageAllImages(c.GetInt("user_role")) {
+		return query
+	}
+	return query.Where("image_id IN (?)", scopeOwnImages(c, db.Model(&models.Image{}).Select("id")))
+}
@@ -3,15 +3,21 @@ package controllers
 import (
 	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/loginguard"
+	"oneimg/backend/utils/pow"
 	"oneimg/backend/utils/result"
 	"oneimg/backend/utils/settings"
 
@@ -25,6 +31,8 @@ type LoginRequest struct {
 	Username           string         `json:"username" binding:"required"`
 	Password           string         `json:"password" binding:"required"`
 	TurnstileToken     string         `json:"turnstileToken"`
+	PowChallenge       string         `json:"powChallenge"`
+	PowNonce           string         `json:"powNonce"`
 	TouristFingerprint string         `json:"touristFingerprint"`
 	FusionHash         string         `json:"fusionHash"`
 	StableFeatures     map[string]any `json:"stableFeatures"`
@@ -75,6 +83,12 @@ func Login(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, result.Error(400, "人机验证失败，请重试"))
 			return
 		}
+	} else if sysSettings.PowVerify {
+		// 工作量证明（无需外网，适用于离线部署）
+		if err := pow.Verify(req.PowChallenge, req.PowNonce, pow.ScopeLogin, sysSettings.PowDifficulty); err != nil {
+			c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+			return
+		}
 	}
 
 	// 先判断是否为游客登录（游客登录跳过验证）
@@ -99,7 +113,7 @@ func Login(c *gin.Context) {
 			touristID := int(generateTouristID(touristUUID))
 			touristUser := &models.User{
 				Id:       touristID,
-				Role:     2,
+				Role:     models.RoleTourist,
 				Username: touristUUID,
 			}
 
@@ -115,7 +129,7 @@ func Login(c *gin.Context) {
 				"token": session.ID(),
 				"user": &models.User{
 					Id:       touristUser.Id,
-					Role:     2,
+					Role:     models.RoleTourist,
 					Username: touristUser.Username,
 				},
 			}))
@@ -123,27 +137,46 @@ func Login(c *gin.Context) {
 		}
 	}
 
+	// 登录失败次数过多的IP或用户名暂时拒绝（在校验密码前判断）
+	if wait := loginguard.Check(c.ClientIP(), req.Username); wait > 0 {
+		rejectLockedLogin(c, wait)
+		return
+	}
+
 	// 普通用户登录逻辑
 	var user models.User
 	userInfo := db.DB.Where("username = ?", req.Username).First(&user)
 
 	// 用户不存在
 	if userInfo.Error != nil {
+		loginguard.Fail(c.ClientIP(), req.Username)
 		c.JSON(http.StatusBadRequest, result.Error(401, "用户名或密码错误"))
 		return
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		loginguard.Fail(c.ClientIP(), req.Username)
 		c.JSON(http.StatusBadRequest, result.Error(401, "用户名或密码错误"))
 		return
 	}
 
+	// 已启用两步验证，或系统要求启用但尚未设置：进入第二步，此时会话未登录
+	if user.TOTPEnabled {
+		beginTwoFactor(c, &user, twoFactorStageVerify)
+		return
+	}
+	if sysSettings.TwoFactorRequired {
+		beginTwoFactor(c, &user, twoFactorStageSetup)
+		return
+	}
+
 	// 设置session
 	session, err := SetSession(c, &user)
 	if err != nil {
 		return
 	}
+	loginguard.Succeed(user.Username)
 
 	// 返回结果去除密码
 	user.Password = ""
@@ -154,6 +187,13 @@ func Login(c *gin.Context) {
 	}))
 }
 
+// rejectLockedLogin 登录被临时锁定
+func rejectLockedLogin(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, result.Error(429, fmt.Sprintf("登录失败次数过多，请 %d 秒后重试", seconds)))
+}
+
 // 辅助函数：基于UUID生成游客ID（保证唯一性）
 func generateTouristID(uuid string) uint {
 	var id uint = 2 // 基础ID（避开普通用户ID）
@@ -190,25 +230,30 @@ func generateRandomUUID() string {
 	)[:36]
 }
 
+// sessionOptions 登录Session的Cookie选项
+var sessionOptions = sessions.Options{
+	MaxAge:   24 * 60 * 60,            // 24小时，单位秒
+	HttpOnly: true,                    // 防止XSS攻击
+	Secure:   false,                   // 生产环境应设为true（需要HTTPS）
+	SameSite: http.SameSiteStrictMode, // 防止CSRF攻击
+	Path:     "/",                     // cookie路径
+}
+
 // 设置Session
 func SetSession(c *gin.Context, user *models.User) (sessions.Session, error) {
 	// 获取session
 	session := sessions.Default(c)
 
-	// 设置session数据
+	// 设置session数据（同时结束两步验证的待验证状态）
+	clearTwoFactorPending(session)
 	session.Set("user_id", user.Id)
 	session.Set("user_role", user.Role)
 	session.Set("username", user.Username)
 	session.Set("logged_in", true)
+	session.Set("session_epoch", middlewares.CurrentSessionEpoch())
 
 	// 设置session选项
-	session.Options(sessions.Options{
-		MaxAge:   24 * 60 * 60,            // 24小时，单位秒
-		HttpOnly: true,                    // 防止XSS攻击
-		Secure:   false,                   // 生产环境应设为true（需要HTTPS）
-		SameSite: http.SameSiteStrictMode, // 防止CSRF攻击
-		Path:     "/",                     // cookie路径
-	})
+	session.Options(sessionOptions)
 
 	// 保存session
 	if err := session.Save(); err != nil {
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginLockoutView 登录锁定记录及当前状态
+type loginLockoutView struct {
+	models.LoginLockout
+	Locked     bool `json:"locked"`      // 当前是否锁定
+	RetryAfter int  `json:"retry_after"` // 剩余锁定秒数
+}
+
+// ListLoginLockouts 分页获取登录失败与锁定记录
+// 筛选参数：kind（ip/username）、subject、locked=true 只看锁定中的记录
+func ListLoginLockouts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	now := time.Now()
+	query := database.GetDB().DB.Model(&models.LoginLockout{})
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+	if c.Query("locked") == "true" {
+		query = query.Where("locked_until > ?", now)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取登录锁定记录失败"))
+		return
+	}
+	var lockouts []models.LoginLockout
+	if err := query.Order("last_failure_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&lockouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取登录锁定记录失败"))
+		return
+	}
+
+	views := make([]loginLockoutView, len(lockouts))
+	for i, l := range lockouts {
+		views[i] = loginLockoutView{LoginLockout: l, Locked: l.IsLocked(now)}
+		if views[i].Locked {
+			views[i].RetryAfter = int(l.LockedUntil.Sub(now).Seconds()) + 1
+		}
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"lockouts":    views,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	}))
+}
+
+// DeleteLoginLockout 解除单条锁定并清空其失败计数
+func DeleteLoginLockout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "记录ID无效"))
+		return
+	}
+
+	db := database.GetDB().DB
+	var lockout models.LoginLockout
+	if err := db.First(&lockout, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "记录不存在"))
+		return
+	}
+	if err := db.Delete(&lockout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "解除锁定失败"))
+		return
+	}
+	audit.Record(c, models.AuditLoginUnlock, lockout.Kind, lockout.Subject, lockout, nil)
+
+	c.JSON(http.StatusOK, result.Success("已解除锁定", nil))
+}
+
+// ClearLoginLockouts 按 kind/subject 批量解除锁定，均未指定时清空全部记录
+func ClearLoginLockouts(c *gin.Context) {
+	kind := c.Query("kind")
+	subject := c.Query("subject")
+	if kind != "" && kind != models.LockoutKindIP && kind != models.LockoutKindUsername {
+		c.JSON(http.StatusBadRequest, result.Error(400, "kind 仅支持 ip、username"))
+		return
+	}
+
+	query := database.GetDB().DB.Where("1 = 1")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+	res := query.Delete(&models.LoginLockout{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "解除锁定失败"))
+		return
+	}
+
+	target := "login_lockout"
+	if kind != "" {
+		target = kind
+	}
+	audit.Record(c, models.AuditLoginUnlock, target, subject, nil, gin.H{"cleared": res.RowsAffected})
+
+	c.JSON(http.StatusOK, result.Success("已解除锁定", gin.H{"cleared": res.RowsAffected}))
+}
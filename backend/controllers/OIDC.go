@@ -0,0 +1,459 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/oidc"
+	"oneimg/backend/utils/settings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcCallbackPath 回调地址，需在身份提供方登记为 Redirect URI
+	oidcCallbackPath = "/api/login/oidc/callback"
+	// oidcFlowCookie 保存 state/nonce/PKCE 校验码的Cookie
+	// 登录Session的Cookie为 SameSite=Strict，从身份提供方跳转回来时浏览器不会携带，因此单独使用 Lax Cookie
+	oidcFlowCookie = "oneimg_oidc"
+	// oidcFlowTTL 在身份提供方完成登录的时限
+	oidcFlowTTL = 10 * time.Minute
+)
+
+// oidcRoleNames 角色映射中可使用的角色名称
+var oidcRoleNames = map[string]int{
+	"admin":    models.RoleAdmin,
+	"editor":   models.RoleEditor,
+	"uploader": models.RoleUploader,
+	"viewer":   models.RoleViewer,
+}
+
+// oidcRolePriority 同时匹配多个角色时取权限最高的
+var oidcRolePriority = map[int]int{
+	models.RoleAdmin:    4,
+	models.RoleEditor:   3,
+	models.RoleUploader: 2,
+	models.RoleViewer:   1,
+}
+
+// oidcFlow 一次登录流程的临时状态
+type oidcFlow struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Expires  int64  `json:"e"`
+}
+
+// OIDCLogin 跳转到身份提供方登录
+func OIDCLogin(c *gin.Context) {
+	sysSettings, err := settings.GetSettings()
+	if err != nil || !oidcConfigured(&sysSettings) {
+		oidcFail(c, "未启用单点登录", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	provider, err := oidc.Discover(ctx, sysSettings.OIDCIssuer)
+	if err != nil {
+		oidcFail(c, "连接身份提供方失败", err)
+		return
+	}
+
+	flow := oidcFlow{Expires: time.Now().Add(oidcFlowTTL).Unix()}
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		if *v, err = oidc.NewVerifier(); err != nil {
+			oidcFail(c, "生成登录状态失败", err)
+			return
+		}
+	}
+	setOIDCFlowCookie(c, &flow)
+
+	c.Redirect(http.StatusFound, provider.AuthURL(
+		sysSettings.OIDCClientID,
+		oidcRedirectURI(c, &sysSettings),
+		strings.Fields(sysSettings.OIDCScopes),
+		flow.State, flow.Nonce, flow.Verifier,
+	))
+}
+
+// OIDCCallback 身份提供方回调：校验授权结果、换取并验证 ID Token，映射到本地用户后建立登录会话
+func OIDCCallback(c *gin.Context) {
+	flow, ok := readOIDCFlowCookie(c)
+	// state 只能使用一次
+	c.SetCookie(oidcFlowCookie, "", -1, oidcCallbackPath, "", isHTTPS(c), true)
+
+	if e := c.Query("error"); e != "" {
+		oidcFail(c, "身份提供方拒绝了登录请求："+e, nil)
+		return
+	}
+	if !ok || time.Now().Unix() > flow.Expires {
+		oidcFail(c, "登录已超时，请重试", nil)
+		return
+	}
+	if !hmac.Equal([]byte(c.Query("state")), []byte(flow.State)) {
+		oidcFail(c, "登录状态校验失败，请重试", nil)
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		oidcFail(c, "缺少授权码", nil)
+		return
+	}
+
+	sysSettings, err := settings.GetSettings()
+	if err != nil || !oidcConfigured(&sysSettings) {
+		oidcFail(c, "未启用单点登录", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	provider, err := oidc.Discover(ctx, sysSettings.OIDCIssuer)
+	if err != nil {
+		oidcFail(c, "连接身份提供方失败", err)
+		return
+	}
+	token, err := provider.Exchange(ctx, sysSettings.OIDCClientID, sysSettings.OIDCClientSecret,
+		oidcRedirectURI(c, &sysSettings), code, flow.Verifier)
+	if err != nil {
+		oidcFail(c, "换取令牌失败", err)
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, sysSettings.OIDCClientID, flow.Nonce)
+	if err != nil {
+		oidcFail(c, "身份令牌校验失败", err)
+		return
+	}
+	// UserInfo 中的声明补充 ID Token（部分提供方只在 UserInfo 中返回用户名或分组）
+	if token.AccessToken != "" {
+		info, err := provider.UserInfo(ctx, token.AccessToken, claims.String("sub"))
+		if err != nil {
+			log.Printf("[OIDC] %v", err)
+		}
+		for k, v := range info {
+			if _, exists := claims[k]; !exists {
+				claims[k] = v
+			}
+		}
+	}
+
+	user, err := resolveOIDCUser(c, &sysSettings, provider.Issuer, claims)
+	if err != nil {
+		oidcFail(c, err.Error(), nil)
+		return
+	}
+
+	// 与密码登录相同，已启用或系统要求两步验证时需在登录页完成第二步
+	stage := ""
+	if user.TOTPEnabled {
+		stage = twoFactorStageVerify
+	} else if sysSettings.TwoFactorRequired {
+		stage = twoFactorStageSetup
+	}
+	if stage != "" {
+		if err := startTwoFactor(c, user, stage); err != nil {
+			oidcFail(c, "登录状态保存失败", err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/login?two_factor="+stage)
+		return
+	}
+
+	if _, err := SetSession(c, user); err != nil {
+		return
+	}
+	c.Redirect(http.StatusFound, "/")
+}
+
+// resolveOIDCUser 按 issuer + sub 查找已关联的用户，首次登录时按已验证的邮箱关联本地用户或自动创建
+func resolveOIDCUser(c *gin.Context, s *models.Settings, issuer string, claims oidc.Claims) (*models.User, error) {
+	db := database.GetDB().DB
+	sub := claims.String("sub")
+	role := mapOIDCRole(s, claims)
+
+	var user models.User
+	err := db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, sub).First(&user).Error
+	if err == nil {
+		if role == 0 {
+			return nil, errors.New("没有登录权限，请联系管理员")
+		}
+		// 配置了角色声明时每次登录同步角色
+		if s.OIDCRoleClaim != "" && role != user.Role {
+			if user.Role == models.RoleAdmin && countAdmins() <= 1 {
+				log.Printf("[OIDC] 用户 %s 是唯一的管理员，跳过角色同步", user.Username)
+			} else {
+				before := user
+				if err := db.Model(&user).Update("role", role).Error; err != nil {
+					return nil, errors.New("同步用户角色失败")
+				}
+				setOIDCActor(c, &user)
+				audit.Record(c, models.AuditUserUpdate, "user", user.Id, before, user)
+			}
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("查询用户失败")
+	}
+
+	username, err := oidcUsername(s, claims)
+	if err != nil {
+		return nil, err
+	}
+	if role == 0 {
+		return nil, errors.New("没有登录权限，请联系管理员")
+	}
+
+	// 关联已有本地用户只按身份提供方已验证的邮箱匹配，不按用户名（用户名声明通常可由用户在身份提供方自行修改）
+	if s.OIDCLinkExisting {
+		if linked, err := linkOIDCUser(c, s, issuer, sub, role, claims); linked != nil || err != nil {
+			return linked, err
+		}
+	}
+
+	err = db.Where("username = ?", username).First(&user).Error
+	if err == nil {
+		return nil, fmt.Errorf("用户名 %s 已被其他账号使用，请联系管理员", username)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("查询用户失败")
+	}
+
+	if !s.OIDCAutoCreate {
+		return nil, errors.New("账号不存在，请联系管理员创建")
+	}
+	if msg := validateUserFields(username, role, 0, 0); msg != "" {
+		return nil, errors.New(msg)
+	}
+	if len(username) > 64 {
+		return nil, errors.New("用户名过长")
+	}
+
+	// 单点登录用户不使用本地密码，设置随机密码使其无法通过密码登录
+	password, err := oidc.NewVerifier()
+	if err != nil {
+		return nil, errors.New("创建用户失败")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("创建用户失败")
+	}
+	user = models.User{
+		Username:    username,
+		Password:    string(hashedPassword),
+		Role:        role,
+		Nickname:    claims.String("name"),
+		Avatar:      claims.String("picture"),
+		OIDCIssuer:  issuer,
+		OIDCSubject: sub,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, errors.New("创建用户失败")
+	}
+	setOIDCActor(c, &user)
+	audit.Record(c, models.AuditUserCreate, "user", user.Id, nil, user)
+	return &user, nil
+}
+
+// linkOIDCUser 将外部身份关联到邮箱相同的本地用户，没有可关联的用户时返回 nil
+// 只使用身份提供方确认已验证（email_verified）的邮箱，本地邮箱由管理员设置；管理员账号不自动关联
+func linkOIDCUser(c *gin.Context, s *models.Settings, issuer, sub string, role int, claims oidc.Claims) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(claims.String("email")))
+	if email == "" || !claims.Bool("email_verified") {
+		return nil, nil
+	}
+
+	db := database.GetDB().DB
+	var user models.User
+	err := db.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("查询用户失败")
+	}
+	if user.OIDCSubject != "" {
+		return nil, fmt.Errorf("邮箱 %s 对应的用户已关联其他外部身份，请联系管理员", email)
+	}
+	if user.Role == models.RoleAdmin {
+		return nil, errors.New("管理员账号不能自动关联单点登录身份，请联系管理员")
+	}
+
+	before := user
+	updates := map[string]any{"oidc_issuer": issuer, "oidc_subject": sub}
+	if s.OIDCRoleClaim != "" && role != user.Role {
+		updates["role"] = role
+	}
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
+		return nil, errors.New("关联用户失败")
+	}
+	setOIDCActor(c, &user)
+	audit.Record(c, models.AuditOIDCLink, "user", user.Id, before, user)
+	return &user, nil
+}
+
+// oidcUsername 按用户名声明确定用户名，未返回时使用邮箱
+// 邮箱可由用户在身份提供方自行填写，只有提供方确认已验证（email_verified）时才能用于匹配本地用户
+func oidcUsername(s *models.Settings, claims oidc.Claims) (string, error) {
+	claim := s.OIDCUsernameClaim
+	username := strings.TrimSpace(claims.String(claim))
+	if username == "" {
+		claim = "email"
+		username = strings.TrimSpace(claims.String(claim))
+	}
+	if username == "" {
+		return "", fmt.Errorf("身份提供方未返回用户名（%s）", s.OIDCUsernameClaim)
+	}
+	if claim == "email" && !claims.Bool("email_verified") {
+		return "", errors.New("身份提供方未验证该邮箱地址，无法用于登录")
+	}
+	return username, nil
+}
+
+// mapOIDCRole 根据角色声明和映射规则计算角色，返回0表示不允许登录
+func mapOIDCRole(s *models.Settings, claims oidc.Claims) int {
+	if s.OIDCRoleClaim == "" {
+		return s.OIDCDefaultRole
+	}
+	mapping, _ := parseOIDCRoleMapping(s.OIDCRoleMapping)
+	role := 0
+	for _, value := range claims.Strings(s.OIDCRoleClaim) {
+		if r, ok := mapping[value]; ok && oidcRolePriority[r] > oidcRolePriority[role] {
+			role = r
+		}
+	}
+	if role == 0 {
+		return s.OIDCDefaultRole
+	}
+	return role
+}
+
+// parseOIDCRoleMapping 解析角色映射，格式：声明值=角色（admin/editor/uploader/viewer 或角色编号），多个用逗号分隔
+func parseOIDCRoleMapping(mapping string) (map[string]int, error) {
+	result := map[string]int{}
+	for _, item := range strings.Split(mapping, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, name, ok := strings.Cut(item, "=")
+		value, name = strings.TrimSpace(value), strings.TrimSpace(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("角色映射格式错误：%s（应为 声明值=角色）", item)
+		}
+		role, ok := oidcRoleNames[strings.ToLower(name)]
+		if !ok {
+			n, err := strconv.Atoi(name)
+			if err != nil || !models.IsValidRole(n) || n == models.RoleTourist {
+				return nil, fmt.Errorf("角色映射中的角色无效：%s", name)
+			}
+			role = n
+		}
+		result[value] = role
+	}
+	return result, nil
+}
+
+// oidcConfigured 是否已启用并完成必要配置
+func oidcConfigured(s *models.Settings) bool {
+	return s.OIDCEnabled && strings.TrimSpace(s.OIDCIssuer) != "" && strings.TrimSpace(s.OIDCClientID) != ""
+}
+
+// oidcRedirectURI 回调地址：优先使用网站域名，未设置时按当前请求推断
+func oidcRedirectURI(c *gin.Context, s *models.Settings) string {
+	if domain := strings.TrimSuffix(strings.TrimSpace(s.SiteDomain), "/"); domain != "" {
+		if !strings.Contains(domain, "://") {
+			domain = "https://" + domain
+		}
+		return domain + oidcCallbackPath
+	}
+	scheme := "http"
+	if isHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + oidcCallbackPath
+}
+
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// oidcFail 记录原因并跳转回登录页
+func oidcFail(c *gin.Context, msg string, err error) {
+	if err != nil {
+		log.Printf("[OIDC] %s：%v", msg, err)
+	}
+	c.Redirect(http.StatusFound, "/login?oidc_error="+url.QueryEscape(msg))
+}
+
+// setOIDCActor 尚未建立登录会话，审计日志的操作者取自本次登录的用户
+func setOIDCActor(c *gin.Context, user *models.User) {
+	c.Set("user_id", user.Id)
+	c.Set("username", user.Username)
+}
+
+// setOIDCFlowCookie 保存签名后的登录流程状态
+func setOIDCFlowCookie(c *gin.Context, flow *oidcFlow) {
+	payload, _ := json.Marshal(flow)
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	value += "." + base64.RawURLEncoding.EncodeToString(signOIDCFlow(value))
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     oidcCallbackPath,
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// readOIDCFlowCookie 读取并校验登录流程状态
+func readOIDCFlowCookie(c *gin.Context) (*oidcFlow, bool) {
+	value, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, false
+	}
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signOIDCFlow(payload)) {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(data, &flow); err != nil {
+		return nil, false
+	}
+	return &flow, true
+}
+
+func signOIDCFlow(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte("oidc-flow:"+config.App.SessionSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"oneimg/backend/utils/pow"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPowChallenge 获取工作量证明挑战，scope=login（默认）或 upload
+// 客户端需找到 nonce，使 SHA-256(challenge + ":" + nonce) 的前 difficulty 位为0
+func GetPowChallenge(c *gin.Context) {
+	sysSettings, err := settings.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取设置失败"))
+		return
+	}
+	if !sysSettings.PowVerify || sysSettings.Turnstile {
+		c.JSON(http.StatusBadRequest, result.Error(400, "未启用工作量证明验证"))
+		return
+	}
+
+	scope := c.DefaultQuery("scope", pow.ScopeLogin)
+	if scope != pow.ScopeLogin && scope != pow.ScopeUpload {
+		c.JSON(http.StatusBadRequest, result.Error(400, "scope 仅支持 login、upload"))
+		return
+	}
+
+	challenge, expires, err := pow.Issue(scope, sysSettings.PowDifficulty)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "生成挑战失败"))
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result.Success("ok", gin.H{
+		"challenge":  challenge,
+		"algorithm":  pow.Algorithm,
+		"difficulty": sysSettings.PowDifficulty,
+		"scope":      scope,
+		"expires_in": int(time.Until(expires).Seconds()),
+	}))
+}
@@ -17,9 +17,11 @@ import (
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 	"oneimg/backend/utils/ftp"
+	"oneimg/backend/utils/images"
 	"oneimg/backend/utils/result"
 	"oneimg/backend/utils/s3"
 	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/signurl"
 	"oneimg/backend/utils/telegram"
 	"oneimg/backend/utils/watermark"
 	"oneimg/backend/utils/webdav"
@@ -50,7 +52,7 @@ func ImageProxy(c *gin.Context) {
 		return
 	}
 
-	// 查询图片信息
+	// 查询图片信息（私有图片独占其文件，共用文件的记录均为公开，按记录自身的私有设置校验签名）
 	var imageModel models.Image
 	sqlResult := db.DB.Unscoped().Where("Url = ? OR Thumbnail = ?", cleanPath, cleanPath).First(&imageModel)
 	if sqlResult.Error != nil {
@@ -58,6 +60,13 @@ func ImageProxy(c *gin.Context) {
 		return
 	}
 
+	// 水印和格式转换尚未完成时不提供原样保存的文件
+	if imageModel.Processing {
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, result.Error(503, "图片处理中，请稍后再试"))
+		return
+	}
+
 	// 获取配置信息
 	setting, setErr := settings.GetSettings()
 	if setErr != nil {
@@ -65,6 +74,17 @@ func ImageProxy(c *gin.Context) {
 		return
 	}
 
+	// 私有图片必须通过有效的签名链接访问
+	if imageModel.Private {
+		expiresAt, ok := signurl.Verify(cleanPath, c.Request.URL.Query())
+		if !ok {
+			c.JSON(http.StatusForbidden, result.Error(403, "私有图片需要有效的签名链接"))
+			return
+		}
+		// 缓存时间不超过链接有效期，且不允许共享缓存
+		c.Set(proxyCacheControlKey, fmt.Sprintf("private, max-age=%d", int(time.Until(expiresAt).Seconds())))
+	}
+
 	// 检查是否开启来源白名单
 	if setting.RefererWhiteEnable && setting.RefererWhiteList != "" {
 		// 过滤本站域名
@@ -75,6 +95,13 @@ func ImageProxy(c *gin.Context) {
 		}
 	}
 
+	// 按图片记录的存储类型和配置方案解析存储配置，切换默认存储后旧图片仍按原配置读取
+	if err := settings.ApplyProfile(&setting, imageModel.StorageProfileId); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+		return
+	}
+	setting.StorageType = imageModel.Storage
+
 	// 校验图片元信息
 	if imageModel.Width == 0 && imageModel.Height == 0 {
 		log.Printf("图片[%s]元信息不完整（宽高为0），继续代理访问", cleanPath)
@@ -122,6 +149,48 @@ func ImageProxy(c *gin.Context) {
 		return
 	}
 
+	// 裁剪坐标按原图尺寸计算，缩略图尺寸不同，不能直接套用
+	if imageUrl != imageModel.Url && c.Query("crop") != "" {
+		c.JSON(http.StatusBadRequest, result.Error(400, "缩略图不支持裁剪，请使用原图地址"))
+		return
+	}
+
+	// 图片变换（缩放、裁剪、格式、质量）：先取回原始内容，再统一处理，适用于所有存储
+	transformOpts, err := images.ParseTransform(c.Request.URL.Query(), c.GetHeader("Accept"), imageModel.Width, imageModel.Height)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	// 水印和变换结果走衍生图片缓存，避免每次重新下载和渲染
+	if watermarkCfg.Enable || !transformOpts.IsEmpty() {
+		serveDerivedImage(c, imageModel, imageUrl, watermarkCfg, transformOpts, func() {
+			proxyStorageFile(c, imageModel, imageUrl, setting, webDAVClient, watermarkCfg)
+		})
+		return
+	}
+
+	// 原图直出：支持 ETag/Last-Modified 条件请求，各存储在代理函数中处理 Range 分段请求
+	if checkNotModified(c, imageModel, imageUrl) {
+		return
+	}
+
+	proxyStorageFile(c, imageModel, imageUrl, setting, webDAVClient, watermarkCfg)
+}
+
+// proxyCacheControlKey 上下文中覆盖默认缓存策略的键
+const proxyCacheControlKey = "proxy_cache_control"
+
+// proxyCacheControl 代理响应的 Cache-Control，默认永久公开缓存
+func proxyCacheControl(c *gin.Context) string {
+	if value := c.GetString(proxyCacheControlKey); value != "" {
+		return value
+	}
+	return "public, max-age=31536000"
+}
+
+// proxyStorageFile 按存储类型分发到对应的代理函数
+func proxyStorageFile(c *gin.Context, imageModel models.Image, imageUrl string, setting models.Settings, webDAVClient *webdav.WebDAVClient, watermarkCfg watermark.WatermarkConfig) {
 	// 传递水印配置到各个代理函数
 	switch imageModel.Storage {
 	case "default":
@@ -176,6 +245,10 @@ func proxyS3File(c *gin.Context, objectKey, mimeType string, fileSize int64, cfg
 		Bucket: aws.String(bucket),
 		Key:    aws.String(objectKey),
 	}
+	// 分段请求直接转发给S3/R2
+	if rangeHeader := requestedRange(c); rangeHeader != "" {
+		getInput.Range = aws.String(rangeHeader)
+	}
 
 	resp, err := s3Client.GetObject(ctx, &getInput)
 	if err != nil {
@@ -196,6 +269,9 @@ func proxyS3File(c *gin.Context, objectKey, mimeType string, fileSize int64, cfg
 			case http.StatusRequestTimeout:
 				c.JSON(http.StatusGatewayTimeout, result.Error(504, "S3请求超时"))
 				return
+			case http.StatusRequestedRangeNotSatisfiable:
+				writeRangeNotSatisfiable(c, -1)
+				return
 			}
 		}
 
@@ -224,19 +300,25 @@ func proxyS3File(c *gin.Context, objectKey, mimeType string, fileSize int64, cfg
 
 	// 3. 设置响应头
 	c.Header("Content-Type", mimeType)
+	status := http.StatusOK
+	partial := resp.ContentRange != nil && *resp.ContentRange != ""
+	if partial {
+		status = http.StatusPartialContent
+		c.Header("Content-Range", *resp.ContentRange)
+	}
 	// 如果添加了水印，不设置Content-Length（因为内容已改变）
 	if !watermarkCfg.Enable {
 		// 优先使用S3返回的文件大小，其次使用数据库中存储的大小
 		if resp.ContentLength != nil && *resp.ContentLength > 0 {
 			c.Header("Content-Length", strconv.FormatInt(*resp.ContentLength, 10))
-		} else if fileSize > 0 {
+		} else if fileSize > 0 && !partial {
 			c.Header("Content-Length", strconv.FormatInt(fileSize, 10))
 		}
 	} else {
 		c.Header("Transfer-Encoding", "chunked")
 	}
 	// 缓存控制（永久缓存）
-	c.Header("Cache-Control", "public, max-age=31536000")
+	c.Header("Cache-Control", proxyCacheControl(c))
 	// 存储类型标识
 	c.Header("X-Storage-Type", storageType)
 	// 跨域支持（可选）
@@ -244,7 +326,7 @@ func proxyS3File(c *gin.Context, objectKey, mimeType string, fileSize int64, cfg
 
 	// 4. 流式传输文件（避免内存溢出）
 	// 设置响应状态码
-	c.Status(http.StatusOK)
+	c.Status(status)
 	// 分块传输，每次4KB
 	buf := make([]byte, 4096)
 	_, err = io.CopyBuffer(c.Writer, contentReader, buf)
@@ -278,8 +360,9 @@ func proxyWebDAVFile(c *gin.Context, relPath, mimeType string, fileSize int64, c
 		return
 	}
 
-	// 获取文件流
-	resp, err := client.WebDAVGetFile(ctx, relPath)
+	// 获取文件流，分段请求转发给WebDAV服务端
+	rangeHeader := requestedRange(c)
+	resp, err := client.WebDAVGetFileRange(ctx, relPath, rangeHeader)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, result.Error(502, "WebDAV文件获取失败"))
 		return
@@ -287,13 +370,27 @@ func proxyWebDAVFile(c *gin.Context, relPath, mimeType string, fileSize int64, c
 	defer resp.Body.Close()
 
 	// 校验响应状态
-	if resp.StatusCode != http.StatusOK {
+	var contentReader io.Reader = resp.Body
+	status := http.StatusOK
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 服务端不支持分段时在本地截取
+		var ok bool
+		if contentReader, status, ok = sliceStream(c, resp.Body, resp.ContentLength, rangeHeader); !ok {
+			return
+		}
+	case http.StatusPartialContent:
+		status = http.StatusPartialContent
+		c.Header("Content-Range", resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		writeRangeNotSatisfiable(c, -1)
+		return
+	default:
 		c.JSON(resp.StatusCode, result.Error(resp.StatusCode, "WebDAV文件获取失败"))
 		return
 	}
 
 	// 处理水印
-	var contentReader io.Reader = resp.Body
 	if watermarkCfg.Enable {
 		processedReader, err := watermark.ProcessImageWithWatermark(resp.Body, mimeType, watermarkCfg)
 		if err != nil {
@@ -311,7 +408,11 @@ func proxyWebDAVFile(c *gin.Context, relPath, mimeType string, fileSize int64, c
 
 	// 设置响应头
 	c.Header("Content-Type", mimeType)
-	if !watermarkCfg.Enable {
+	if status == http.StatusPartialContent {
+		if resp.StatusCode == http.StatusPartialContent && resp.ContentLength > 0 {
+			c.Header("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+	} else if !watermarkCfg.Enable {
 		if resp.ContentLength > 0 {
 			c.Header("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
 		} else if fileSize > 0 {
@@ -320,11 +421,12 @@ func proxyWebDAVFile(c *gin.Context, relPath, mimeType string, fileSize int64, c
 	} else {
 		c.Header("Transfer-Encoding", "chunked")
 	}
-	c.Header("Cache-Control", "public, max-age=31536000")
+	c.Header("Cache-Control", proxyCacheControl(c))
 	c.Header("X-Storage-Type", "webdav")
 	c.Header("Access-Control-Allow-Origin", "*")
 
 	// 流式传输文件
+	c.Status(status)
 	_, err = io.Copy(c.Writer, contentReader)
 	if err != nil {
 		log.Printf("WebDAV文件传输失败：%v", err)
@@ -372,7 +474,7 @@ func proxyLocalFile(c *gin.Context, realPath string, mimeType string, cfg models
 
 		// 设置响应头
 		c.Header("Content-Type", mimeType)
-		c.Header("Cache-Control", "public, max-age=31536000")
+		c.Header("Cache-Control", proxyCacheControl(c))
 		c.Header("X-Storage-Type", "default")
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Transfer-Encoding", "chunked")
@@ -384,15 +486,23 @@ func proxyLocalFile(c *gin.Context, realPath string, mimeType string, cfg models
 	}
 
 	// 未启用水印，使用原始逻辑
+	file, err := os.Open(fullPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "打开文件失败"))
+		return
+	}
+	defer file.Close()
+
 	// 设置响应头
 	c.Header("Content-Type", mimeType)
 	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-	c.Header("Cache-Control", "public, max-age=31536000")
+	c.Header("Cache-Control", proxyCacheControl(c))
 	c.Header("X-Storage-Type", "default")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	// 流式传输
-	c.File(fullPath)
+	// 流式传输，由ServeContent处理Range/If-Range；修改时间沿用图片元信息中的Last-Modified
+	modTime, _ := http.ParseTime(c.Writer.Header().Get("Last-Modified"))
+	http.ServeContent(c.Writer, c.Request, "", modTime, file)
 }
 
 // FTP代理（添加水印支持）
@@ -422,8 +532,31 @@ func proxyFTPFile(c *gin.Context, ftpPath string, mimeType string, cfg models.Se
 		}
 	}()
 
+	// 分段请求：先取文件大小解析范围，再从起始偏移量下载（REST + RETR）
+	var start, length, size int64 = 0, -1, -1
+	if rangeHeader := requestedRange(c); rangeHeader != "" {
+		if fileSize, err := ftpUtil.FileSize(ftpPath); err == nil {
+			size = fileSize
+			var rangeErr error
+			start, length, rangeErr = parseByteRange(rangeHeader, size)
+			if errors.Is(rangeErr, errRangeNotSatisfiable) {
+				writeRangeNotSatisfiable(c, size)
+				return
+			}
+			if rangeErr != nil {
+				start, length = 0, -1
+			}
+		}
+	}
+
 	// 获取文件流
-	fileReader, _, err := ftpUtil.GetFileStreamReader(ftpPath)
+	var fileReader io.ReadCloser
+	var err error
+	if length >= 0 {
+		fileReader, err = ftpUtil.GetFileStreamReaderFrom(ftpPath, start)
+	} else {
+		fileReader, _, err = ftpUtil.GetFileStreamReader(ftpPath)
+	}
 	if err != nil {
 		log.Printf("获取FTP文件流失败（路径：%s）：%v", ftpPath, err)
 		if strings.Contains(err.Error(), "550") {
@@ -434,7 +567,8 @@ func proxyFTPFile(c *gin.Context, ftpPath string, mimeType string, cfg models.Se
 		return
 	}
 	defer func() {
-		if err := fileReader.Close(); err != nil {
+		// 分段下载提前关闭数据连接时服务端会返回426，无需记录
+		if err := fileReader.Close(); err != nil && length < 0 {
 			if !strings.Contains(err.Error(), "227 Entering Passive Mode") {
 				log.Printf("FTP文件流关闭失败：%v", err)
 			}
@@ -459,7 +593,7 @@ func proxyFTPFile(c *gin.Context, ftpPath string, mimeType string, cfg models.Se
 	}
 
 	c.Header("Content-Type", mimeType)
-	c.Header("Cache-Control", "public, max-age=31536000")
+	c.Header("Cache-Control", proxyCacheControl(c))
 	c.Header("X-Storage-Type", "ftp")
 	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Connection", "close")
@@ -468,7 +602,13 @@ func proxyFTPFile(c *gin.Context, ftpPath string, mimeType string, cfg models.Se
 		c.Header("Transfer-Encoding", "chunked")
 	}
 
-	c.Status(http.StatusOK)
+	if length >= 0 {
+		contentReader = io.LimitReader(fileReader, length)
+		setPartialHeaders(c, start, length, size)
+		c.Status(http.StatusPartialContent)
+	} else {
+		c.Status(http.StatusOK)
+	}
 
 	buf := make([]byte, 4096)
 	totalWritten := int64(0)
@@ -501,7 +641,7 @@ func ProxyTelegramFile(c *gin.Context, realPath string, telegramFileName string,
 		c.Writer.Header().Del("Content-Length")
 	}
 	c.Header("Content-Type", mimeType)
-	c.Header("Cache-Control", "public, max-age=31536000")
+	c.Header("Cache-Control", proxyCacheControl(c))
 	c.Header("X-Storage-Type", "telegram")
 	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Connection", "close")
@@ -556,7 +696,7 @@ func ProxyTelegramFile(c *gin.Context, realPath string, telegramFileName string,
 	tgClient.Retry = 3                  // 重试次数
 
 	// 5. 调用telegram包获取文件流
-	fileReader, err := telegram.GetTelegramFileStreamReader(tgClient, fileId)
+	fileReader, fileSize, err := telegram.GetTelegramFileStream(tgClient, fileId)
 	if err != nil {
 		log.Printf("获取Telegram文件流失败（FileId：%s）：%v", fileId, err)
 		if strings.Contains(err.Error(), "file not found") || strings.Contains(err.Error(), "invalid file id") {
@@ -589,8 +729,14 @@ func ProxyTelegramFile(c *gin.Context, realPath string, telegramFileName string,
 		}
 	}
 
-	// 7. 流式返回
-	c.Status(http.StatusOK)
+	// 7. 分段请求：Telegram不支持按偏移量下载，跳过起始字节后截断
+	contentReader, status, ok := sliceStream(c, contentReader, fileSize, requestedRange(c))
+	if !ok {
+		return
+	}
+
+	// 8. 流式返回
+	c.Status(status)
 	buf := make([]byte, 4096)
 	totalWritten := int64(0)
 	for {
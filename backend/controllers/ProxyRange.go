@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/models"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errRangeUnsupported 请求头格式不支持（如多段范围），按完整内容返回
+	errRangeUnsupported = errors.New("unsupported range")
+	// errRangeNotSatisfiable 请求范围超出文件大小
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// imageETag 根据图片元信息生成稳定的ETag
+// 只使用不随存储位置变化的字段，迁移存储后ETag保持不变，客户端缓存仍然有效
+func imageETag(imageModel models.Image, path string) string {
+	raw := fmt.Sprintf("%d|%s|%s|%d|%d", imageModel.Id, path, imageModel.ContentHash, imageModel.FileSize, imageModel.CreatedAt.Unix())
+	sum := sha256.Sum256([]byte(raw))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// checkNotModified 写入ETag、Last-Modified和Accept-Ranges响应头
+// 客户端缓存仍然有效时直接返回304并返回true
+func checkNotModified(c *gin.Context, imageModel models.Image, path string) bool {
+	etag := imageETag(imageModel, path)
+	modTime := imageModel.CreatedAt.UTC().Truncate(time.Second)
+
+	header := c.Writer.Header()
+	header.Set("ETag", etag)
+	header.Set("Accept-Ranges", "bytes")
+	if !imageModel.CreatedAt.IsZero() {
+		header.Set("Last-Modified", modTime.Format(http.TimeFormat))
+	}
+
+	// If-None-Match 优先于 If-Modified-Since
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if !etagMatch(inm, etag) {
+			return false
+		}
+	} else if ims := c.GetHeader("If-Modified-Since"); ims != "" && !imageModel.CreatedAt.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || modTime.After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	header.Set("Cache-Control", proxyCacheControl(c))
+	header.Set("Access-Control-Allow-Origin", "*")
+	c.Status(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+	return true
+}
+
+// etagMatch 判断 If-None-Match / If-Range 是否与当前ETag匹配（弱比较）
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedRange 获取需要处理的 Range 请求头
+// 只支持单段 bytes 范围；If-Range 与当前ETag或修改时间不匹配时忽略分段，返回完整内容
+func requestedRange(c *gin.Context) string {
+	rangeHeader := strings.TrimSpace(c.GetHeader("Range"))
+	if !strings.HasPrefix(rangeHeader, "bytes=") || strings.Contains(rangeHeader, ",") {
+		return ""
+	}
+
+	if ifRange := strings.TrimSpace(c.GetHeader("If-Range")); ifRange != "" {
+		header := c.Writer.Header()
+		if strings.HasPrefix(ifRange, `"`) {
+			// If-Range 要求强比较
+			if ifRange != header.Get("ETag") {
+				return ""
+			}
+		} else {
+			t, err := http.ParseTime(ifRange)
+			lastModified, lmErr := http.ParseTime(header.Get("Last-Modified"))
+			if err != nil || lmErr != nil || !t.Equal(lastModified) {
+				return ""
+			}
+		}
+	}
+	return rangeHeader
+}
+
+// parseByteRange 按文件大小解析单段范围，返回起始位置和长度
+func parseByteRange(rangeHeader string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok || size < 0 {
+		return 0, 0, errRangeUnsupported
+	}
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errRangeUnsupported
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+	// 后缀范围：bytes=-N 表示最后N个字节
+	if startStr == "" {
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errRangeUnsupported
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errRangeUnsupported
+	}
+	if start >= size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+			return 0, 0, errRangeUnsupported
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, nil
+}
+
+// setPartialHeaders 设置206响应的长度和范围头
+func setPartialHeaders(c *gin.Context, start, length, size int64) {
+	header := c.Writer.Header()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+}
+
+// writeRangeNotSatisfiable 返回416，size未知时传-1
+func writeRangeNotSatisfiable(c *gin.Context, size int64) {
+	header := c.Writer.Header()
+	header.Del("Transfer-Encoding")
+	header.Del("Content-Length")
+	header.Del("Content-Type")
+	if size >= 0 {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	}
+	c.AbortWithStatusJSON(http.StatusRequestedRangeNotSatisfiable, result.Error(416, "请求的范围无效"))
+}
+
+// sliceStream 在不支持分段读取的后端上实现 Range：跳过起始字节并截断长度
+// 无需分段时返回原始流和200；范围无效时已写入416，返回ok=false
+func sliceStream(c *gin.Context, reader io.Reader, size int64, rangeHeader string) (io.Reader, int, bool) {
+	if rangeHeader == "" {
+		return reader, http.StatusOK, true
+	}
+	start, length, err := parseByteRange(rangeHeader, size)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		writeRangeNotSatisfiable(c, size)
+		return nil, 0, false
+	}
+	if err != nil {
+		return reader, http.StatusOK, true
+	}
+	if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadGateway, result.Error(502, "读取文件失败"))
+		return nil, 0, false
+	}
+	setPartialHeaders(c, start, length, size)
+	return io.LimitReader(reader, length), http.StatusPartialContent, true
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+
+	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/ratelimit"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRateLimits 查看上传限流的当前计数（prefix 按键前缀筛选，如 ip:、tourist:、user:）
+func ListRateLimits(c *gin.Context) {
+	sysSettings, err := settings.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取设置失败"))
+		return
+	}
+	rules, err := ratelimit.ParseRules(sysSettings.UploadRateLimits)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+		return
+	}
+
+	counters := ratelimit.Snapshot(c.Query("prefix"))
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"enabled":  sysSettings.UploadRateLimit,
+		"rules":    rules,
+		"counters": counters,
+		"total":    len(counters),
+	}))
+}
+
+// ResetRateLimits 清除指定键（如 ip:1.2.3.4）的限流计数，未指定时清除全部
+func ResetRateLimits(c *gin.Context) {
+	key := c.Query("key")
+	cleared := ratelimit.Reset(key)
+	audit.Record(c, models.AuditRateLimitReset, "rate_limit", key, nil, gin.H{"cleared": cleared})
+
+	c.JSON(http.StatusOK, result.Success("已清除", gin.H{"cleared": cleared}))
+}
@@ -0,0 +1,627 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/quota"
+	"oneimg/backend/utils/s3api"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// s3MaxListKeys 单次列举返回的最大对象数
+const s3MaxListKeys = 1000
+
+// s3MaxKeyLength 对象键最大长度（字节）
+const s3MaxKeyLength = 512
+
+// s3LikeEscape LIKE 转义字符（三种数据库均支持以 ESCAPE 指定）
+const s3LikeEscape = "!"
+
+var s3BucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// S3ListBuckets 列出当前用户的存储桶（GET /s3/）
+func S3ListBuckets(c *gin.Context) {
+	if !s3Authorize(c, models.ScopeRead) {
+		return
+	}
+
+	db := database.GetDB().DB
+	var names []string
+	if err := db.Model(&models.S3Object{}).Where("user_id = ?", c.GetInt("user_id")).
+		Distinct("bucket").Order("bucket").Pluck("bucket", &names).Error; err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+
+	res := s3api.ListAllMyBucketsResult{
+		Owner:   s3Owner(c),
+		Buckets: make([]s3api.Bucket, 0, len(names)),
+	}
+	for _, name := range names {
+		var first models.S3Object
+		db.Where("user_id = ? AND bucket = ?", c.GetInt("user_id"), name).Order("created_at").First(&first)
+		res.Buckets = append(res.Buckets, s3api.Bucket{Name: name, CreationDate: s3api.FormatTime(first.CreatedAt)})
+	}
+	s3api.WriteXML(c, http.StatusOK, res)
+}
+
+// S3CreateBucket 创建存储桶（PUT /s3/:bucket）
+// 存储桶只是对象键的命名空间，无需实际创建，仅校验名称
+func S3CreateBucket(c *gin.Context) {
+	if !s3Authorize(c, models.ScopeUpload) {
+		return
+	}
+	if _, ok := s3Bucket(c); !ok {
+		return
+	}
+	if len(c.Request.URL.RawQuery) > 0 {
+		s3api.WriteError(c, s3api.ErrNotImplemented)
+		return
+	}
+
+	c.Header("Location", "/"+c.Param("bucket"))
+	c.Status(http.StatusOK)
+}
+
+// S3HeadBucket 检查存储桶（HEAD /s3/:bucket）
+func S3HeadBucket(c *gin.Context) {
+	if !s3Authorize(c, models.ScopeRead) {
+		return
+	}
+	if _, ok := s3Bucket(c); !ok {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// S3DeleteBucket 删除存储桶（DELETE /s3/:bucket），仅允许删除空存储桶
+func S3DeleteBucket(c *gin.Context) {
+	if !s3Authorize(c, models.ScopeDelete) {
+		return
+	}
+	bucket, ok := s3Bucket(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	database.GetDB().DB.Model(&models.S3Object{}).
+		Where("user_id = ? AND bucket = ?", c.GetInt("user_id"), bucket).
+		Count(&count)
+	if count > 0 {
+		s3api.WriteError(c, s3api.ErrBucketNotEmpty)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// S3ListObjects 列举对象（GET /s3/:bucket），支持 ListObjectsV2 与 ListObjects(V1)
+func S3ListObjects(c *gin.Context) {
+	if !s3Authorize(c, models.ScopeRead) {
+		return
+	}
+	bucket, ok := s3Bucket(c)
+	if !ok {
+		return
+	}
+
+	query := c.Request.URL.Query()
+	if _, ok := query["location"]; ok {
+		s3api.WriteXML(c, http.StatusOK, s3api.LocationConstraint{})
+		return
+	}
+	for _, sub := range []string{"acl", "policy", "versioning", "versions", "uploads", "tagging", "lifecycle", "cors"} {
+		if _, ok := query[sub]; ok {
+			s3api.WriteError(c, s3api.ErrNotImplemented)
+			return
+		}
+	}
+
+	maxKeys := s3MaxListKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			s3api.WriteError(c, s3api.ErrInvalidArgument.WithMessage("max-keys 无效"))
+			return
+		}
+		maxKeys = min(n, s3MaxListKeys)
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		s3api.WriteError(c, s3api.ErrInvalidArgument.WithMessage("encoding-type 仅支持 url"))
+		return
+	}
+	encode := func(s string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	v2 := query.Get("list-type") == "2"
+
+	// V2 的续传令牌为上一页最后一个键的 base64 编码
+	marker := query.Get("marker")
+	if v2 {
+		marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				s3api.WriteError(c, s3api.ErrInvalidArgument.WithMessage("continuation-token 无效"))
+				return
+			}
+			marker = string(decoded)
+		}
+	}
+
+	contents, prefixes, truncated, next, err := listS3Objects(c.GetInt("user_id"), bucket, prefix, delimiter, marker, maxKeys)
+	if err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+
+	res := s3api.ListBucketResult{
+		Name:         bucket,
+		Prefix:       encode(prefix),
+		Delimiter:    encode(delimiter),
+		MaxKeys:      maxKeys,
+		IsTruncated:  truncated,
+		EncodingType: encodingType,
+	}
+	for _, obj := range contents {
+		res.Contents = append(res.Contents, s3api.Content{
+			Key:          encode(obj.ObjectKey),
+			LastModified: s3api.FormatTime(obj.UpdatedAt),
+			ETag:         `"` + obj.ETag + `"`,
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, p := range prefixes {
+		res.CommonPrefixes = append(res.CommonPrefixes, s3api.CommonPrefix{Prefix: encode(p)})
+	}
+
+	if v2 {
+		keyCount := len(contents) + len(prefixes)
+		res.KeyCount = &keyCount
+		res.ContinuationToken = query.Get("continuation-token")
+		res.StartAfter = encode(query.Get("start-after"))
+		if truncated {
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+		}
+	} else {
+		m := encode(query.Get("marker"))
+		res.Marker = &m
+		if truncated {
+			res.NextMarker = encode(next)
+		}
+	}
+	s3api.WriteXML(c, http.StatusOK, res)
+}
+
+// S3DeleteObjects 批量删除对象（POST /s3/:bucket?delete）
+func S3DeleteObjects(c *gin.Context) {
+	if _, ok := c.Request.URL.Query()["delete"]; !ok {
+		s3api.WriteError(c, s3api.ErrNotImplemented)
+		return
+	}
+	if !s3Authorize(c, models.ScopeDelete) {
+		return
+	}
+	bucket, ok := s3Bucket(c)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 2<<20))
+	if err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+	var req s3api.DeleteRequest
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Objects) > s3MaxListKeys {
+		s3api.WriteError(c, s3api.ErrMalformedXML)
+		return
+	}
+
+	res := s3api.DeleteResult{}
+	for _, obj := range req.Objects {
+		if err := deleteS3Object(c.GetInt("user_id"), bucket, obj.Key); err != nil {
+			res.Errors = append(res.Errors, s3api.DeleteError{Key: obj.Key, Code: s3api.ErrInternalError.Code, Message: err.Error()})
+			continue
+		}
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, s3api.DeletedObject{Key: obj.Key})
+		}
+	}
+	s3api.WriteXML(c, http.StatusOK, res)
+}
+
+// S3PutObject 上传对象（PUT /s3/:bucket/*key），按正常上传流程写入图床存储
+func S3PutObject(c *gin.Context) {
+	bucket, key, ok := s3BucketAndKey(c)
+	if !ok {
+		return
+	}
+	if key == "" {
+		S3CreateBucket(c)
+		return
+	}
+	if !s3Authorize(c, models.ScopeUpload) {
+		return
+	}
+	if c.GetHeader("X-Amz-Copy-Source") != "" || c.Query("partNumber") != "" || c.Query("uploadId") != "" {
+		s3api.WriteError(c, s3api.ErrNotImplemented.WithMessage("不支持复制对象和分段上传"))
+		return
+	}
+	// 与上传接口共用限流规则（S3客户端遇到 SlowDown 会自动退避重试）
+	if seconds := middlewares.CheckUploadRateLimit(c); seconds > 0 {
+		s3api.WriteError(c, s3api.ErrSlowDown.WithMessage(fmt.Sprintf("上传过于频繁，请 %d 秒后重试", seconds)))
+		return
+	}
+
+	setting, err := settings.GetSettings()
+	if err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+	cfg := c.MustGet("config").(*config.Config)
+
+	user := quota.GetUser(c.GetInt("user_id"), c.GetInt("user_role"))
+	maxSize := quota.EffectiveMaxFileSize(user, setting.MaxFileSize, cfg.MaxFileSize)
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSize+1))
+	if err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		s3api.WriteError(c, s3api.ErrEntityTooLarge.WithMessage(fmt.Sprintf("文件大小超过限制 (最大 %d MB)", maxSize/1024/1024)))
+		return
+	}
+	if len(data) == 0 {
+		s3api.WriteError(c, s3api.ErrInvalidRequest.WithMessage("不支持上传空对象"))
+		return
+	}
+
+	sum := md5.Sum(data)
+	if contentMD5 := c.GetHeader("Content-MD5"); contentMD5 != "" && contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+		s3api.WriteError(c, s3api.ErrBadDigest)
+		return
+	}
+	if err := quota.CheckStorageQuota(user, int64(len(data))); err != nil {
+		s3api.WriteError(c, s3api.ErrAccessDenied.WithMessage(err.Error()))
+		return
+	}
+
+	// S3客户端按上传内容的MD5校验ETag，对象按原始内容保存（不压缩、不转换格式、不加水印），下载内容与上传一致
+	setting.OriginalImage = true
+	setting.SaveWebp = false
+	setting.WatermarkEnable = false
+	image, err := uploadImageData(c, cfg, setting, maxSize, path.Base(key), data, false)
+	if err != nil {
+		s3api.WriteError(c, s3api.ErrInvalidRequest.WithMessage(err.Error()))
+		return
+	}
+
+	db := database.GetDB().DB
+	etag := hex.EncodeToString(sum[:])
+	oldImageId, err := putS3Object(db, models.S3Object{
+		UserId:      c.GetInt("user_id"),
+		Bucket:      bucket,
+		ObjectKey:   key,
+		ImageId:     image.Id,
+		ETag:        etag,
+		Size:        image.FileSize,
+		ContentType: image.MimeType,
+	})
+	if err != nil {
+		removeImage(db, image)
+		s3api.WriteError(c, err)
+		return
+	}
+
+	// 覆盖写入时删除被替换的旧图片
+	if oldImageId != 0 && oldImageId != image.Id {
+		var old models.Image
+		if db.First(&old, oldImageId).Error == nil {
+			removeImage(db, old)
+		}
+	}
+
+	c.Header("ETag", `"`+etag+`"`)
+	c.Status(http.StatusOK)
+}
+
+// S3GetObject 下载对象（GET /s3/:bucket/*key），支持 Range 与条件请求
+func S3GetObject(c *gin.Context) {
+	bucket, key, ok := s3BucketAndKey(c)
+	if !ok {
+		return
+	}
+	if key == "" {
+		S3ListObjects(c)
+		return
+	}
+	if !s3Authorize(c, models.ScopeRead) {
+		return
+	}
+
+	obj, image, ok := loadS3Object(c, bucket, key)
+	if !ok {
+		return
+	}
+
+	setting, err := settings.ForImage(image)
+	if err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+	backend, err := storage.New(image.Storage, setting)
+	if err != nil {
+		s3api.WriteError(c, s3api.ErrNotImplemented.WithMessage(err.Error()))
+		return
+	}
+	data, err := backend.Read(c.Request.Context(), image)
+	if err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+
+	setS3ObjectHeaders(c, obj)
+	c.Writer.Header().Del("Content-Length")
+	http.ServeContent(c.Writer, c.Request, "", obj.UpdatedAt, bytes.NewReader(data.Data))
+}
+
+// S3HeadObject 获取对象元数据（HEAD /s3/:bucket/*key）
+func S3HeadObject(c *gin.Context) {
+	bucket, key, ok := s3BucketAndKey(c)
+	if !ok {
+		return
+	}
+	if key == "" {
+		S3HeadBucket(c)
+		return
+	}
+	if !s3Authorize(c, models.ScopeRead) {
+		return
+	}
+
+	obj, _, ok := loadS3Object(c, bucket, key)
+	if !ok {
+		return
+	}
+	setS3ObjectHeaders(c, obj)
+	c.Status(http.StatusOK)
+}
+
+// S3DeleteObject 删除对象（DELETE /s3/:bucket/*key），同时删除对应的图片
+func S3DeleteObject(c *gin.Context) {
+	bucket, key, ok := s3BucketAndKey(c)
+	if !ok {
+		return
+	}
+	if key == "" {
+		S3DeleteBucket(c)
+		return
+	}
+	if !s3Authorize(c, models.ScopeDelete) {
+		return
+	}
+
+	if err := deleteS3Object(c.GetInt("user_id"), bucket, key); err != nil {
+		s3api.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// S3PostObject 对象级 POST 请求（分段上传等），目前均不支持
+func S3PostObject(c *gin.Context) {
+	if _, key, ok := s3BucketAndKey(c); ok && key == "" {
+		S3DeleteObjects(c)
+		return
+	}
+	s3api.WriteError(c, s3api.ErrNotImplemented.WithMessage("不支持分段上传，请调大客户端的分段阈值"))
+}
+
+// RemoveImageS3Objects 图片被删除后清理S3对象映射
+func RemoveImageS3Objects(db *gorm.DB, imageId int) {
+	db.Where("image_id = ?", imageId).Delete(&models.S3Object{})
+}
+
+// s3Authorize 校验角色权限和API令牌权限范围
+func s3Authorize(c *gin.Context, scope string) bool {
+	if !models.RoleHasPermission(c.GetInt("user_role"), scope) || !middlewares.HasScope(c, scope) {
+		s3api.WriteError(c, s3api.ErrAccessDenied.WithMessage("缺少权限："+scope))
+		return false
+	}
+	return true
+}
+
+// s3Owner 当前用户作为所有者
+func s3Owner(c *gin.Context) s3api.Owner {
+	return s3api.Owner{ID: strconv.Itoa(c.GetInt("user_id")), DisplayName: c.GetString("username")}
+}
+
+// s3Bucket 读取并校验存储桶名称
+func s3Bucket(c *gin.Context) (string, bool) {
+	bucket := c.Param("bucket")
+	if !s3BucketNameRegex.MatchString(bucket) || strings.Contains(bucket, "..") {
+		s3api.WriteError(c, s3api.ErrInvalidBucketName)
+		return "", false
+	}
+	return bucket, true
+}
+
+// s3BucketAndKey 读取并校验存储桶名称和对象键（键为空表示存储桶级请求）
+func s3BucketAndKey(c *gin.Context) (string, string, bool) {
+	bucket, ok := s3Bucket(c)
+	if !ok {
+		return "", "", false
+	}
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if len(key) > s3MaxKeyLength {
+		s3api.WriteError(c, s3api.ErrInvalidArgument.WithMessage(fmt.Sprintf("对象键不能超过 %d 字节", s3MaxKeyLength)))
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// loadS3Object 加载对象映射及对应图片
+func loadS3Object(c *gin.Context, bucket, key string) (models.S3Object, models.Image, bool) {
+	db := database.GetDB().DB
+	var obj models.S3Object
+	var image models.Image
+	if err := db.Where("user_id = ? AND bucket = ? AND object_key = ?", c.GetInt("user_id"), bucket, key).First(&obj).Error; err != nil {
+		s3api.WriteError(c, s3api.ErrNoSuchKey)
+		return obj, image, false
+	}
+	if err := db.First(&image, obj.ImageId).Error; err != nil {
+		s3api.WriteError(c, s3api.ErrNoSuchKey)
+		return obj, image, false
+	}
+	return obj, image, true
+}
+
+// setS3ObjectHeaders 写入对象元数据响应头
+func setS3ObjectHeaders(c *gin.Context, obj models.S3Object) {
+	c.Header("ETag", `"`+obj.ETag+`"`)
+	c.Header("Content-Type", obj.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(obj.Size, 10))
+	c.Header("Last-Modified", obj.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "bytes")
+}
+
+// putS3Object 写入对象映射，返回被覆盖的旧图片ID
+func putS3Object(db *gorm.DB, obj models.S3Object) (int, error) {
+	var existing models.S3Object
+	err := db.Where("user_id = ? AND bucket = ? AND object_key = ?", obj.UserId, obj.Bucket, obj.ObjectKey).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := db.Create(&obj).Error; err == nil {
+			return 0, nil
+		}
+		// 并发写入同一个键时唯一索引冲突，按覆盖处理
+		err = db.Where("user_id = ? AND bucket = ? AND object_key = ?", obj.UserId, obj.Bucket, obj.ObjectKey).First(&existing).Error
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	oldImageId := existing.ImageId
+	err = db.Model(&existing).Updates(map[string]any{
+		"image_id":     obj.ImageId,
+		"etag":         obj.ETag,
+		"size":         obj.Size,
+		"content_type": obj.ContentType,
+		"updated_at":   time.Now(),
+	}).Error
+	return oldImageId, err
+}
+
+// deleteS3Object 删除对象映射及对应的图片，对象不存在时视为成功
+func deleteS3Object(userId int, bucket, key string) error {
+	db := database.GetDB().DB
+	var obj models.S3Object
+	if err := db.Where("user_id = ? AND bucket = ? AND object_key = ?", userId, bucket, key).First(&obj).Error; err != nil {
+		return nil
+	}
+
+	var image models.Image
+	if err := db.First(&image, obj.ImageId).Error; err != nil {
+		return db.Delete(&obj).Error
+	}
+	_, err := removeImage(db, image)
+	return err
+}
+
+// listS3Objects 按键名顺序列举对象，指定分隔符时将更深层级折叠为公共前缀
+// 返回对象、公共前缀、是否截断以及下一页的起始标记
+func listS3Objects(userId int, bucket, prefix, delimiter, marker string, maxKeys int) ([]models.S3Object, []string, bool, string, error) {
+	db := database.GetDB().DB
+	contents := []models.S3Object{}
+	prefixes := []string{}
+	if maxKeys == 0 {
+		return contents, prefixes, false, "", nil
+	}
+
+	// 上一页以公共前缀结束时，跳过该前缀下的全部对象
+	skipPrefix := ""
+	if delimiter != "" && strings.HasPrefix(marker, prefix) && strings.HasSuffix(marker, delimiter) {
+		skipPrefix = marker
+	}
+
+	last := ""
+	for {
+		query := db.Where("user_id = ? AND bucket = ? AND object_key > ?", userId, bucket, marker)
+		if prefix != "" {
+			query = query.Where("object_key LIKE ? ESCAPE '"+s3LikeEscape+"'", escapeS3Like(prefix)+"%")
+		}
+		var batch []models.S3Object
+		if err := query.Order("object_key").Limit(s3MaxListKeys).Find(&batch).Error; err != nil {
+			return nil, nil, false, "", err
+		}
+
+		for _, obj := range batch {
+			marker = obj.ObjectKey
+			if skipPrefix != "" && strings.HasPrefix(obj.ObjectKey, skipPrefix) {
+				continue
+			}
+
+			entry := ""
+			if delimiter != "" {
+				if i := strings.Index(obj.ObjectKey[len(prefix):], delimiter); i >= 0 {
+					entry = obj.ObjectKey[:len(prefix)+i+len(delimiter)]
+				}
+			}
+			if entry != "" && entry == skipPrefix {
+				continue
+			}
+
+			if len(contents)+len(prefixes) == maxKeys {
+				return contents, prefixes, true, last, nil
+			}
+			if entry != "" {
+				prefixes = append(prefixes, entry)
+				skipPrefix = entry
+				last = entry
+				continue
+			}
+			contents = append(contents, obj)
+			last = obj.ObjectKey
+		}
+
+		if len(batch) < s3MaxListKeys {
+			return contents, prefixes, false, "", nil
+		}
+	}
+}
+
+// escapeS3Like 转义 LIKE 通配符
+func escapeS3Like(s string) string {
+	r := strings.NewReplacer(s3LikeEscape, s3LikeEscape+s3LikeEscape, "%", s3LikeEscape+"%", "_", s3LikeEscape+"_")
+	return r.Replace(s)
+}
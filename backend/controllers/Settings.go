@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -14,9 +15,13 @@ import (
 
 	"oneimg/backend/database"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/pow"
+	"oneimg/backend/utils/ratelimit"
 	"oneimg/backend/utils/result"
 	"oneimg/backend/utils/settings"
 	"oneimg/backend/utils/telegram"
+	"oneimg/backend/utils/webhooks"
 )
 
 // 定义请求参数
@@ -30,6 +35,9 @@ type GetSettingsRequest struct {
 	Keys []string `json:"keys"`
 }
 
+// secretMask 已设置的密钥类设置在接口中返回的掩码，原样提交时不修改
+const secretMask = "********"
+
 // 十六进制颜色格式正则
 var hexColorRegex = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
 
@@ -40,11 +48,29 @@ func GetSettings(c *gin.Context) {
 		return
 	}
 
+	// 密钥类设置只写不读，已设置的返回掩码
+	maskSecretSettings(&settings)
+
 	// Simplify: directly return all settings to ensure no data loss in filtering
 	// log.Printf("Returning Settings: %+v", settings)
 	c.JSON(200, result.Success("ok", settings))
 }
 
+// maskSecretSettings 将已设置的密钥类设置替换为掩码
+func maskSecretSettings(settings *models.Settings) {
+	val := reflect.ValueOf(settings).Elem()
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := val.Field(i)
+		if field.Kind() != reflect.String || field.String() == "" {
+			continue
+		}
+		if models.IsSecretSettingKey(typ.Field(i).Tag.Get("json")) {
+			field.SetString(secretMask)
+		}
+	}
+}
+
 // 返回登录配置
 func GetLoginSettings(c *gin.Context) {
 	settings, err := settings.GetSettings()
@@ -57,8 +83,11 @@ func GetLoginSettings(c *gin.Context) {
 		map[string]any{
 			"turnstile":          settings.Turnstile,
 			"turnstile_site_key": settings.TurnstileSiteKey,
+			"pow_verify":         settings.PowVerify && !settings.Turnstile,
+			"pow_difficulty":     settings.PowDifficulty,
 			"tourist":            settings.Tourist,
 			"site_logo":          settings.SiteLogo,
+			"oidc":               oidcConfigured(&settings),
 		},
 	))
 }
@@ -69,6 +98,12 @@ func UpdateSettings(c *gin.Context) {
 		c.JSON(400, result.Error(400, "请求参数错误: "+err.Error()))
 		return
 	}
+	// 提交的是掩码说明密钥未修改
+	if models.IsSecretSettingKey(req.Key) && req.Value == secretMask {
+		c.JSON(200, result.Success("未修改", nil))
+		return
+	}
+
 	// 查询是否有该设置项
 	currentSettings, err := settings.GetSettings()
 	if err != nil {
@@ -92,16 +127,22 @@ func UpdateSettings(c *gin.Context) {
 			var oldImage models.Image
 			// 查找旧图片记录 (包括隐藏的)
 			if err := db.Unscoped().Where("url = ?", oldLogo).First(&oldImage).Error; err == nil {
-				DeleteImageFile(oldImage)
-				db.Unscoped().Delete(&oldImage)
+				deleteImageObject(db, oldImage)
 			}
 		}
 	}
 
+	before := currentSettings
 	if err := updateSettingsField(&currentSettings, req.Key, req.Value); err != nil {
 		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
 		return
 	}
+	// Turnstile 与工作量证明二选一，启用其中一个时关闭另一个
+	if req.Key == "turnstile" && currentSettings.Turnstile {
+		currentSettings.PowVerify = false
+	} else if req.Key == "pow_verify" && currentSettings.PowVerify {
+		currentSettings.Turnstile = false
+	}
 
 	// 更新设置项
 	db := database.GetDB().DB
@@ -114,11 +155,20 @@ func UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, models.AuditSettingsUpdate, "settings", req.Key, before, currentSettings)
+
 	// 自动设置/删除 Telegram Webhook
 	if req.Key == "tg_webhook" {
 		go handleTelegramWebhookUpdate(&currentSettings)
 	}
 
+	// 密钥类设置不随事件发送
+	event := gin.H{"key": req.Key, "value": req.Value, "updated_by": c.GetString("username")}
+	if models.IsSecretSettingKey(req.Key) {
+		event["value"] = nil
+	}
+	webhooks.Dispatch(models.EventSettingsUpdated, event)
+
 	c.JSON(200, result.Success("更新成功", nil))
 }
 
@@ -276,6 +326,75 @@ func convertValueToTargetType(key string, value any, targetType reflect.Type) (a
 
 func validateSettingData(key string, value any) error {
 	switch key {
+	case "two_factor_required":
+		return errors.New("请通过 /api/admin/2fa/enforce 修改两步验证策略")
+
+	case "oidc_issuer":
+		issuer, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("OIDC Issuer 必须是字符串类型，实际类型：%T", value)
+		}
+		if issuer = strings.TrimSpace(issuer); issuer != "" {
+			u, err := url.Parse(issuer)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return errors.New("OIDC Issuer 必须是 http(s) 地址")
+			}
+		}
+
+	case "oidc_role_mapping":
+		mapping, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("角色映射必须是字符串类型，实际类型：%T", value)
+		}
+		if _, err := parseOIDCRoleMapping(mapping); err != nil {
+			return err
+		}
+
+	case "oidc_default_role":
+		var role int
+		switch v := value.(type) {
+		case float64:
+			role = int(v)
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("默认角色必须是整数（当前值：%s）", v)
+			}
+			role = n
+		default:
+			return fmt.Errorf("默认角色必须是整数，实际类型：%T", value)
+		}
+		if role != 0 && (!models.IsValidRole(role) || role == models.RoleTourist) {
+			return fmt.Errorf("默认角色无效（当前：%d）", role)
+		}
+
+	case "upload_rate_limits":
+		rules, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("上传限流规则必须是字符串类型，实际类型：%T", value)
+		}
+		if _, err := ratelimit.ParseRules(rules); err != nil {
+			return err
+		}
+
+	case "pow_difficulty":
+		var difficulty int
+		switch v := value.(type) {
+		case float64:
+			difficulty = int(v)
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("工作量证明难度必须是整数（当前值：%s）", v)
+			}
+			difficulty = n
+		default:
+			return fmt.Errorf("工作量证明难度必须是整数，实际类型：%T", value)
+		}
+		if difficulty < pow.MinDifficulty || difficulty > pow.MaxDifficulty {
+			return fmt.Errorf("工作量证明难度必须在%d-%d之间（当前：%d）", pow.MinDifficulty, pow.MaxDifficulty, difficulty)
+		}
+
 	case "watermark_text":
 		// 1. 水印文字长度校验（兼容字符串类型）
 		text, ok := value.(string)
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/migration"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartMigrationRequest 创建存储迁移任务请求
+type StartMigrationRequest struct {
+	Source          string `json:"source"`
+	Target          string `json:"target"`
+	SourceProfileId int    `json:"source_profile_id"` // 来源存储配置方案ID（可选）
+	TargetProfileId int    `json:"target_profile_id"` // 目标存储配置方案ID（可选）
+}
+
+// MigrationItem 迁移任务及进度
+type MigrationItem struct {
+	models.StorageMigration
+	Running  bool    `json:"running"`  // 是否正在当前进程中运行
+	Progress float64 `json:"progress"` // 完成百分比
+}
+
+// ListStorageMigrations 获取存储迁移任务列表
+func ListStorageMigrations(c *gin.Context) {
+	db := database.GetDB().DB
+
+	var jobs []models.StorageMigration
+	if err := db.Order("id DESC").Limit(50).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取迁移任务失败"))
+		return
+	}
+
+	items := make([]MigrationItem, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, toMigrationItem(job))
+	}
+	c.JSON(http.StatusOK, result.Success("获取成功", items))
+}
+
+// GetStorageMigration 获取存储迁移任务进度
+func GetStorageMigration(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的任务ID"))
+		return
+	}
+
+	var job models.StorageMigration
+	if err := database.GetDB().DB.First(&job, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "迁移任务不存在"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", toMigrationItem(job)))
+}
+
+// StartStorageMigration 创建存储迁移任务并在后台执行
+func StartStorageMigration(c *gin.Context) {
+	var req StartMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	job, err := migration.Start(req.Source, req.Target, req.SourceProfileId, req.TargetProfileId, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("迁移任务已启动", toMigrationItem(*job)))
+}
+
+// ResumeStorageMigration 从断点继续已中断的迁移任务
+func ResumeStorageMigration(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的任务ID"))
+		return
+	}
+
+	job, err := migration.Resume(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("迁移任务已继续", toMigrationItem(*job)))
+}
+
+// CancelStorageMigration 取消正在运行的迁移任务
+func CancelStorageMigration(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的任务ID"))
+		return
+	}
+
+	if err := migration.Cancel(id); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("已请求取消迁移任务", nil))
+}
+
+// toMigrationItem 转换为带进度的响应
+func toMigrationItem(job models.StorageMigration) MigrationItem {
+	item := MigrationItem{
+		StorageMigration: job,
+		Running:          migration.IsRunning(job.Id),
+	}
+	if job.Total > 0 {
+		done := job.Migrated + job.Failed
+		if done > job.Total {
+			done = job.Total
+		}
+		item.Progress = float64(done*10000/job.Total) / 100
+	}
+	if job.Status == models.MigrationCompleted {
+		item.Progress = 100
+	}
+	return item
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StorageProfileRequest 创建/更新存储配置方案请求
+type StorageProfileRequest struct {
+	Name      string `json:"name" binding:"required,max=64"`
+	Type      string `json:"type" binding:"required"`
+	Endpoint  string `json:"endpoint"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	CustomURL string `json:"custom_url"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Port      int    `json:"port"`
+	ApiKey    string `json:"api_key"`
+	DeleteURL string `json:"delete_url"`
+	// 上传时可选择该方案的角色ID，逗号分隔，如 "3,4"（管理员始终可用）
+	UploadRoles string `json:"upload_roles"`
+}
+
+// StorageProfileOption 上传时可选择的存储配置方案（不含凭据）
+type StorageProfileOption struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ListStorageProfileOptions 获取当前用户上传时可选择的存储配置方案
+func ListStorageProfileOptions(c *gin.Context) {
+	var profiles []models.StorageProfile
+	if err := database.GetDB().DB.Order("id ASC").Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取存储配置方案失败"))
+		return
+	}
+	options := []StorageProfileOption{}
+	for _, profile := range profiles {
+		if profile.AllowsUploadRole(c.GetInt("user_role")) {
+			options = append(options, StorageProfileOption{Id: profile.Id, Name: profile.Name, Type: profile.Type})
+		}
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", options))
+}
+
+// ListStorageProfiles 获取全部存储配置方案（仅管理员，密钥类字段返回掩码）
+func ListStorageProfiles(c *gin.Context) {
+	var profiles []models.StorageProfile
+	if err := database.GetDB().DB.Order("id ASC").Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取存储配置方案失败"))
+		return
+	}
+	for i := range profiles {
+		maskStorageProfile(&profiles[i])
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", profiles))
+}
+
+// CreateStorageProfile 创建存储配置方案
+func CreateStorageProfile(c *gin.Context) {
+	var profile models.StorageProfile
+	if !bindStorageProfile(c, &profile) {
+		return
+	}
+
+	if err := database.GetDB().DB.Create(&profile).Error; err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "创建失败，方案名称可能已存在"))
+		return
+	}
+
+	maskStorageProfile(&profile)
+	c.JSON(http.StatusOK, result.Success("创建成功", profile))
+}
+
+// UpdateStorageProfile 更新存储配置方案
+// 已有图片引用的方案不允许修改存储类型，以免旧图片无法读取
+func UpdateStorageProfile(c *gin.Context) {
+	profile, ok := loadStorageProfile(c)
+	if !ok {
+		return
+	}
+
+	oldType := profile.Type
+	if !bindStorageProfile(c, &profile) {
+		return
+	}
+
+	db := database.GetDB().DB
+	if profile.Type != oldType && countProfileImages(profile.Id) > 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "该方案已有图片，不能修改存储类型"))
+		return
+	}
+
+	if err := db.Save(&profile).Error; err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "更新失败，方案名称可能已存在"))
+		return
+	}
+
+	maskStorageProfile(&profile)
+	c.JSON(http.StatusOK, result.Success("更新成功", profile))
+}
+
+// DeleteStorageProfile 删除存储配置方案（仍有图片引用时不允许删除）
+func DeleteStorageProfile(c *gin.Context) {
+	profile, ok := loadStorageProfile(c)
+	if !ok {
+		return
+	}
+
+	if count := countProfileImages(profile.Id); count > 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "该方案仍有 "+strconv.FormatInt(count, 10)+" 张图片，请先迁移或删除图片"))
+		return
+	}
+
+	var activeJobs int64
+	database.GetDB().DB.Model(&models.StorageMigration{}).
+		Where("status IN ? AND (source_profile_id = ? OR target_profile_id = ?)",
+			[]string{models.MigrationPending, models.MigrationRunning}, profile.Id, profile.Id).
+		Count(&activeJobs)
+	if activeJobs > 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "该方案正在被存储迁移任务使用"))
+		return
+	}
+
+	if err := database.GetDB().DB.Delete(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "删除失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("删除成功", nil))
+}
+
+// loadStorageProfile 根据路径参数加载存储配置方案
+func loadStorageProfile(c *gin.Context) (models.StorageProfile, bool) {
+	var profile models.StorageProfile
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的方案ID"))
+		return profile, false
+	}
+	if err := database.GetDB().DB.First(&profile, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "存储配置方案不存在"))
+		return profile, false
+	}
+	return profile, true
+}
+
+// bindStorageProfile 解析并校验请求，写入方案字段
+func bindStorageProfile(c *gin.Context, profile *models.StorageProfile) bool {
+	var req StorageProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Type = strings.ToLower(strings.TrimSpace(req.Type))
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, result.Error(400, "方案名称不能为空"))
+		return false
+	}
+	if !models.IsValidStorageProfileType(req.Type) {
+		c.JSON(http.StatusBadRequest, result.Error(400, "不支持的存储类型，可选值："+strings.Join(models.StorageProfileTypes, "/")))
+		return false
+	}
+	if req.Port <= 0 {
+		req.Port = 21
+	}
+	var uploadRoles []string
+	for _, item := range strings.Split(req.UploadRoles, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		if role, err := strconv.Atoi(item); err != nil || !models.IsValidRole(role) {
+			c.JSON(http.StatusBadRequest, result.Error(400, "无效的角色："+item))
+			return false
+		}
+		uploadRoles = append(uploadRoles, item)
+	}
+
+	profile.Name = req.Name
+	profile.Type = req.Type
+	profile.Endpoint = strings.TrimSpace(req.Endpoint)
+	profile.Bucket = strings.TrimSpace(req.Bucket)
+	profile.AccessKey = req.AccessKey
+	profile.CustomURL = strings.TrimRight(strings.TrimSpace(req.CustomURL), "/")
+	profile.Username = req.Username
+	profile.Port = req.Port
+	profile.DeleteURL = strings.TrimSpace(req.DeleteURL)
+	profile.UploadRoles = strings.Join(uploadRoles, ",")
+	setSecret(&profile.SecretKey, req.SecretKey)
+	setSecret(&profile.Password, req.Password)
+	setSecret(&profile.ApiKey, req.ApiKey)
+
+	if !profile.IsValid() {
+		c.JSON(http.StatusBadRequest, result.Error(400, "存储配置不完整"))
+		return false
+	}
+	return true
+}
+
+// setSecret 更新密钥类字段，提交的是掩码说明未修改
+func setSecret(field *string, value string) {
+	if value != secretMask {
+		*field = value
+	}
+}
+
+// maskStorageProfile 将已设置的密钥类字段替换为掩码
+func maskStorageProfile(profile *models.StorageProfile) {
+	for _, field := range []*string{&profile.SecretKey, &profile.Password, &profile.ApiKey} {
+		if *field != "" {
+			*field = secretMask
+		}
+	}
+}
+
+// countProfileImages 统计引用该方案的图片数量
+func countProfileImages(profileId int) int64 {
+	var count int64
+	database.GetDB().DB.Unscoped().Model(&models.Image{}).Where("storage_profile_id = ?", profileId).Count(&count)
+	return count
+}
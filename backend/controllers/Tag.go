@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"net/http"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageTagsRequest 批量打标签/取消标签请求
+type ImageTagsRequest struct {
+	ImageIds []int    `json:"image_ids" binding:"required"`
+	Tags     []string `json:"tags" binding:"required"`
+}
+
+// TagItem 标签及使用次数
+type TagItem struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// ListTags 获取当前用户可见图片上的标签及使用次数
+func ListTags(c *gin.Context) {
+	db := database.GetDB().DB
+
+	imageIds := db.Model(&models.Image{}).Select("id")
+	if !models.CanManageAllImages(c.GetInt("user_role")) {
+		imageIds = scopeOwnImages(c, imageIds)
+	}
+
+	var items []TagItem
+	err := db.Model(&models.ImageTag{}).
+		Select("tags.name AS name, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("image_tags.image_id IN (?)", imageIds).
+		Group("tags.name").
+		Order("count DESC, tags.name ASC").
+		Scan(&items).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取标签列表失败"))
+		return
+	}
+	if items == nil {
+		items = []TagItem{}
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", items))
+}
+
+// TagImages 批量为图片添加标签
+func TagImages(c *gin.Context) {
+	imageIds, tags, ok := bindImageTagsRequest(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB().DB
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tagIds, err := ensureTags(tx, tags)
+		if err != nil {
+			return err
+		}
+
+		relations := make([]models.ImageTag, 0, len(imageIds)*len(tagIds))
+		for _, imageId := range imageIds {
+			for _, tagId := range tagIds {
+				relations = append(relations, models.ImageTag{ImageId: imageId, TagId: tagId})
+			}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&relations, 500).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "添加标签失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("添加标签成功", gin.H{"count": len(imageIds), "tags": tags}))
+}
+
+// UntagImages 批量移除图片标签
+func UntagImages(c *gin.Context) {
+	imageIds, tags, ok := bindImageTagsRequest(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB().DB
+	tagIds := db.Model(&models.Tag{}).Select("id").Where("name IN ?", tags)
+	if err := db.Where("image_id IN ? AND tag_id IN (?)", imageIds, tagIds).Delete(&models.ImageTag{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "移除标签失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("移除标签成功", gin.H{"count": len(imageIds), "tags": tags}))
+}
+
+// RemoveImageTags 图片被删除后清理标签关联
+func RemoveImageTags(db *gorm.DB, imageId int) {
+	db.Where("image_id = ?", imageId).Delete(&models.ImageTag{})
+}
+
+// attachImageTags 为图片列表填充标签
+func attachImageTags(db *gorm.DB, images []models.Image) {
+	if len(images) == 0 {
+		return
+	}
+
+	ids := make([]int, 0, len(images))
+	for _, image := range images {
+		ids = append(ids, image.Id)
+	}
+
+	var rows []struct {
+		ImageId int
+		Name    string
+	}
+	db.Model(&models.ImageTag{}).
+		Select("image_tags.image_id AS image_id, tags.name AS name").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("image_tags.image_id IN ?", ids).
+		Order("tags.name ASC").
+		Scan(&rows)
+
+	tagMap := make(map[int][]string)
+	for _, row := range rows {
+		tagMap[row.ImageId] = append(tagMap[row.ImageId], row.Name)
+	}
+	for i := range images {
+		images[i].Tags = tagMap[images[i].Id]
+	}
+}
+
+// bindImageTagsRequest 解析请求，校验图片权限并规范化标签
+func bindImageTagsRequest(c *gin.Context) ([]int, []string, bool) {
+	var req ImageTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return nil, nil, false
+	}
+	if len(req.ImageIds) == 0 || len(req.ImageIds) > 500 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "图片数量需在1-500之间"))
+		return nil, nil, false
+	}
+	if len(req.Tags) == 0 || len(req.Tags) > 50 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "标签数量需在1-50之间"))
+		return nil, nil, false
+	}
+
+	seen := make(map[string]bool)
+	tags := make([]string, 0, len(req.Tags))
+	for _, raw := range req.Tags {
+		tag := models.NormalizeTagName(raw)
+		if tag == "" {
+			c.JSON(http.StatusBadRequest, result.Error(400, "标签无效："+raw))
+			return nil, nil, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	imageIds, ok := loadAccessibleImageIds(c, req.ImageIds)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return imageIds, tags, true
+}
+
+// ensureTags 获取标签ID，不存在的标签自动创建
+func ensureTags(tx *gorm.DB, names []string) ([]int, error) {
+	newTags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		newTags = append(newTags, models.Tag{Name: name})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newTags).Error; err != nil {
+		return nil, err
+	}
+
+	var tagIds []int
+	if err := tx.Model(&models.Tag{}).Where("name IN ?", names).Pluck("id", &tagIds).Error; err != nil {
+		return nil, err
+	}
+	return tagIds, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -17,7 +18,9 @@ import (
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 	"oneimg/backend/utils/md5"
+	"oneimg/backend/utils/ratelimit"
 	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/webhooks"
 
 	"github.com/gin-gonic/gin"
 )
@@ -93,6 +96,19 @@ func TelegramWebhook(c *gin.Context) {
 		return
 	}
 
+	// 上传限流（Telegram 收到非200响应会重复推送，因此以消息回复代替 429）
+	var limitSubjects []ratelimit.Subject
+	if setting.UploadRateLimit {
+		if rules, err := ratelimit.ParseRules(setting.UploadRateLimits); err == nil {
+			limitSubjects = ratelimit.TelegramSubjects(chatID, rules)
+		}
+		if wait := ratelimit.Allow(limitSubjects); wait > 0 {
+			sendTelegramReply(setting.TGBotToken, chatID, fmt.Sprintf("⏳ 上传过于频繁，请 %d 秒后重试", int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+			return
+		}
+	}
+
 	// 发送处理中提示
 	sendTelegramReply(setting.TGBotToken, chatID, "⏳ 正在下载并上传图片...")
 
@@ -168,23 +184,26 @@ func TelegramWebhook(c *gin.Context) {
 	}
 
 	imageModel := models.Image{
-		Url:       fileResult.URL,
-		Thumbnail: fileResult.ThumbnailURL,
-		FileName:  fileResult.FileName,
-		FileSize:  fileResult.FileSize,
-		MimeType:  fileResult.MimeType,
-		Width:     fileResult.Width,
-		Height:    fileResult.Height,
-		Storage:   fileResult.Storage,
-		UserId:    0, // Telegram 用户没有关联的系统用户 ID
-		MD5:       md5.Md5(username + fileResult.FileName),
-		UUID:      "",
+		Url:         fileResult.URL,
+		Thumbnail:   fileResult.ThumbnailURL,
+		FileName:    fileResult.FileName,
+		FileSize:    fileResult.FileSize,
+		MimeType:    fileResult.MimeType,
+		Width:       fileResult.Width,
+		Height:      fileResult.Height,
+		Storage:     fileResult.Storage,
+		ContentHash: fileResult.ContentHash,
+		ProcessKey:  fileResult.ProcessKey,
+		UserId:      0, // Telegram 用户没有关联的系统用户 ID
+		MD5:         md5.Md5(username + fileResult.FileName),
+		UUID:        "",
 	}
 
 	db := database.GetDB()
-	if db != nil {
-		db.DB.Create(&imageModel)
+	if db != nil && db.DB.Create(&imageModel).Error == nil {
+		webhooks.Dispatch(models.EventImageUploaded, imageModel)
 	}
+	ratelimit.Consume(limitSubjects, fileResult.FileSize)
 
 	// 构建访问URL
 	accessURL := formatNotificationURL(c.Request.Host, fileResult.URL)
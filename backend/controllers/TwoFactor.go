@@ -0,0 +1,542 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/loginguard"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/twofactor"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 登录第二步的阶段
+const (
+	twoFactorStageVerify = "verify" // 已启用两步验证，需输入验证码或恢复码
+	twoFactorStageSetup  = "setup"  // 系统要求启用两步验证，需先完成设置
+)
+
+const (
+	// twoFactorPendingTTL 密码验证通过后完成第二步的时限
+	twoFactorPendingTTL = 5 * time.Minute
+	// twoFactorMaxAttempts 第二步允许的错误次数，超过后需重新输入密码
+	twoFactorMaxAttempts = 5
+	// twoFactorIssuer 验证器App中显示的服务名称
+	twoFactorIssuer = "OneImg"
+)
+
+// 待完成两步验证的Session键（不设置 logged_in，无法通过 AuthMiddleware）
+const (
+	pendingUserKey     = "2fa_pending_user_id"
+	pendingStageKey    = "2fa_pending_stage"
+	pendingAtKey       = "2fa_pending_at"
+	pendingAttemptsKey = "2fa_pending_attempts"
+	setupSecretKey     = "2fa_setup_secret" // 设置中尚未确认的TOTP密钥
+)
+
+// TwoFactorCodeRequest 验证码请求（code 与 recovery_code 二选一）
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorDisableRequest 关闭两步验证请求
+type TwoFactorDisableRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorEnforceRequest 强制两步验证策略请求
+type TwoFactorEnforceRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// beginTwoFactor 密码验证通过后进入第二步：清除原有登录状态，只记录待验证的用户
+func beginTwoFactor(c *gin.Context, user *models.User, stage string) {
+	if err := startTwoFactor(c, user, stage); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "session保存失败："+err.Error()))
+		return
+	}
+
+	msg := "请输入两步验证码"
+	if stage == twoFactorStageSetup {
+		msg = "系统要求启用两步验证，请先完成设置"
+	}
+	// 使用 202 业务码，避免只判断 200 的客户端误以为已登录
+	c.JSON(http.StatusOK, &result.Result{Code: 202, Msg: msg, Data: gin.H{
+		"two_factor": stage,
+		"expires_in": int(twoFactorPendingTTL.Seconds()),
+	}})
+}
+
+// startTwoFactor 保存待完成两步验证的状态（密码登录和单点登录共用）
+func startTwoFactor(c *gin.Context, user *models.User, stage string) error {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set(pendingUserKey, user.Id)
+	session.Set(pendingStageKey, stage)
+	session.Set(pendingAtKey, time.Now().Unix())
+	session.Set(pendingAttemptsKey, 0)
+	session.Options(sessionOptions)
+	return session.Save()
+}
+
+// clearTwoFactorPending 清除待验证状态
+func clearTwoFactorPending(session sessions.Session) {
+	for _, key := range []string{pendingUserKey, pendingStageKey, pendingAtKey, pendingAttemptsKey, setupSecretKey} {
+		session.Delete(key)
+	}
+}
+
+// loadPendingUser 校验待验证状态并加载用户
+func loadPendingUser(c *gin.Context, stage string) (*models.User, sessions.Session, bool) {
+	session := sessions.Default(c)
+	userID, _ := session.Get(pendingUserKey).(int)
+	pendingAt, _ := session.Get(pendingAtKey).(int64)
+	if userID == 0 || session.Get(pendingStageKey) != stage {
+		c.JSON(http.StatusUnauthorized, result.Error(401, "请先输入用户名和密码"))
+		return nil, session, false
+	}
+	if time.Since(time.Unix(pendingAt, 0)) > twoFactorPendingTTL {
+		clearTwoFactorPending(session)
+		session.Save()
+		c.JSON(http.StatusUnauthorized, result.Error(401, "验证已超时，请重新登录"))
+		return nil, session, false
+	}
+
+	var user models.User
+	if err := database.GetDB().DB.First(&user, userID).Error; err != nil {
+		clearTwoFactorPending(session)
+		session.Save()
+		c.JSON(http.StatusUnauthorized, result.Error(401, "账号不存在或已被删除"))
+		return nil, session, false
+	}
+	return &user, session, true
+}
+
+// failTwoFactorAttempt 记录一次失败，超过次数后作废本次登录
+func failTwoFactorAttempt(c *gin.Context, session sessions.Session, msg string) {
+	attempts, _ := session.Get(pendingAttemptsKey).(int)
+	attempts++
+	if attempts >= twoFactorMaxAttempts {
+		clearTwoFactorPending(session)
+		session.Save()
+		c.JSON(http.StatusUnauthorized, result.Error(401, "错误次数过多，请重新登录"))
+		return
+	}
+	session.Set(pendingAttemptsKey, attempts)
+	session.Save()
+	c.JSON(http.StatusBadRequest, result.Error(400, msg))
+}
+
+// completeLogin 第二步完成，建立正式登录会话
+func completeLogin(c *gin.Context, user *models.User, data gin.H) {
+	session, err := SetSession(c, user)
+	if err != nil {
+		return
+	}
+	loginguard.Succeed(user.Username)
+	user.Password = ""
+	if data == nil {
+		data = gin.H{}
+	}
+	data["token"] = session.ID()
+	data["user"] = user
+	c.JSON(http.StatusOK, result.Success("登录成功", data))
+}
+
+// LoginTwoFactor 登录第二步：校验验证码或恢复码
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误"))
+		return
+	}
+
+	user, session, ok := loadPendingUser(c, twoFactorStageVerify)
+	if !ok {
+		return
+	}
+	// 验证码错误同样计入登录失败次数
+	if wait := loginguard.Check(c.ClientIP(), user.Username); wait > 0 {
+		rejectLockedLogin(c, wait)
+		return
+	}
+	if !verifySecondFactor(user, req.Code, req.RecoveryCode) {
+		loginguard.Fail(c.ClientIP(), user.Username)
+		failTwoFactorAttempt(c, session, "验证码错误")
+		return
+	}
+	completeLogin(c, user, nil)
+}
+
+// LoginTwoFactorSetup 登录时按系统要求设置两步验证：生成密钥
+func LoginTwoFactorSetup(c *gin.Context) {
+	user, session, ok := loadPendingUser(c, twoFactorStageSetup)
+	if !ok {
+		return
+	}
+	startTwoFactorSetup(c, session, user)
+}
+
+// LoginTwoFactorEnable 登录时按系统要求设置两步验证：确认验证码后启用并完成登录
+func LoginTwoFactorEnable(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误"))
+		return
+	}
+
+	user, session, ok := loadPendingUser(c, twoFactorStageSetup)
+	if !ok {
+		return
+	}
+	codes, ok := enableTwoFactor(c, session, user, req.Code)
+	if !ok {
+		return
+	}
+
+	// 尚未建立登录会话，审计日志的操作者取自本次登录的用户
+	c.Set("user_id", user.Id)
+	c.Set("username", user.Username)
+	audit.Record(c, models.AuditTwoFactorEnable, "user", user.Id, nil, nil)
+	completeLogin(c, user, gin.H{"recovery_codes": codes})
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	user, ok := loadSessionUser(c)
+	if !ok {
+		return
+	}
+
+	var remaining int64
+	database.GetDB().DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.Id).Count(&remaining)
+	sysSettings, _ := settings.GetSettings()
+
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"required":                 sysSettings.TwoFactorRequired,
+		"recovery_codes_remaining": remaining,
+	}))
+}
+
+// SetupTwoFactor 开始设置两步验证：生成密钥，确认验证码后才生效
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := loadSessionUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, result.Error(400, "已启用两步验证，如需更换请先关闭"))
+		return
+	}
+	startTwoFactorSetup(c, sessions.Default(c), user)
+}
+
+// EnableTwoFactor 确认验证码并启用两步验证，返回恢复码
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误"))
+		return
+	}
+
+	user, ok := loadSessionUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, result.Error(400, "已启用两步验证"))
+		return
+	}
+	codes, ok := enableTwoFactor(c, sessions.Default(c), user, req.Code)
+	if !ok {
+		return
+	}
+
+	audit.Record(c, models.AuditTwoFactorEnable, "user", user.Id, nil, nil)
+	c.JSON(http.StatusOK, result.Success("两步验证已启用，请妥善保存恢复码", gin.H{"recovery_codes": codes}))
+}
+
+// DisableTwoFactor 关闭两步验证（需要密码和验证码/恢复码）
+func DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误"))
+		return
+	}
+
+	user, ok := loadSessionUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, result.Error(400, "未启用两步验证"))
+		return
+	}
+	if sysSettings, _ := settings.GetSettings(); sysSettings.TwoFactorRequired {
+		c.JSON(http.StatusBadRequest, result.Error(400, "系统要求启用两步验证，无法关闭"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "密码错误"))
+		return
+	}
+	if !verifySecondFactor(user, req.Code, req.RecoveryCode) {
+		c.JSON(http.StatusBadRequest, result.Error(400, "验证码错误"))
+		return
+	}
+
+	if err := resetTwoFactor(database.GetDB().DB, user.Id); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "关闭两步验证失败"))
+		return
+	}
+	audit.Record(c, models.AuditTwoFactorDisable, "user", user.Id, nil, nil)
+	c.JSON(http.StatusOK, result.Success("两步验证已关闭", nil))
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码（需要验证码），旧恢复码全部作废
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误"))
+		return
+	}
+
+	user, ok := loadSessionUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, result.Error(400, "未启用两步验证"))
+		return
+	}
+	if !verifySecondFactor(user, req.Code, "") {
+		c.JSON(http.StatusBadRequest, result.Error(400, "验证码错误"))
+		return
+	}
+
+	var codes []string
+	err := database.GetDB().DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.Id)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "生成恢复码失败"))
+		return
+	}
+	audit.Record(c, models.AuditRecoveryCodes, "user", user.Id, nil, nil)
+	c.JSON(http.StatusOK, result.Success("已重新生成恢复码，请妥善保存", gin.H{"recovery_codes": codes}))
+}
+
+// EnforceTwoFactor 设置是否要求所有注册用户启用两步验证
+// 开启后清除所有会话，未启用两步验证的用户下次登录时必须先完成设置
+func EnforceTwoFactor(c *gin.Context) {
+	var req TwoFactorEnforceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误"))
+		return
+	}
+
+	admin, ok := loadSessionUser(c)
+	if !ok {
+		return
+	}
+	if *req.Enabled && !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请先为当前账号启用两步验证"))
+		return
+	}
+
+	db := database.GetDB().DB
+	currentSettings, err := settings.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取设置失败"))
+		return
+	}
+	before := gin.H{"two_factor_required": currentSettings.TwoFactorRequired}
+	if err := db.Model(&models.Settings{}).Where("id = ?", currentSettings.ID).
+		UpdateColumn("two_factor_required", *req.Enabled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "更新失败"))
+		return
+	}
+	audit.Record(c, models.AuditTwoFactorEnforce, "settings", "two_factor_required", before, gin.H{"two_factor_required": *req.Enabled})
+
+	if *req.Enabled && !currentSettings.TwoFactorRequired {
+		// 使现有会话失效，当前管理员重新建立会话
+		if err := middlewares.ClearSessionStore(); err != nil {
+			c.JSON(http.StatusInternalServerError, result.Error(500, "清除会话失败: "+err.Error()))
+			return
+		}
+		sessions.Default(c).Clear()
+		if _, err := SetSession(c, admin); err != nil {
+			return
+		}
+	}
+
+	var missing int64
+	db.Model(&models.User{}).Where("role <> ? AND totp_enabled = ?", models.RoleTourist, false).Count(&missing)
+	c.JSON(http.StatusOK, result.Success("更新成功", gin.H{
+		"required":          *req.Enabled,
+		"users_without_2fa": missing,
+	}))
+}
+
+// ResetUserTwoFactor 管理员重置用户的两步验证（用户丢失验证器和恢复码时）
+func ResetUserTwoFactor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "用户ID无效"))
+		return
+	}
+
+	db := database.GetDB().DB
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "用户不存在"))
+		return
+	}
+	if err := resetTwoFactor(db, user.Id); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "重置两步验证失败"))
+		return
+	}
+	audit.Record(c, models.AuditTwoFactorReset, "user", user.Id, gin.H{"totp_enabled": user.TOTPEnabled}, gin.H{"totp_enabled": false})
+	c.JSON(http.StatusOK, result.Success("已重置该用户的两步验证", nil))
+}
+
+// loadSessionUser 加载当前登录用户（两步验证只能通过Session登录管理）
+func loadSessionUser(c *gin.Context) (*models.User, bool) {
+	if middlewares.IsTokenAuth(c) {
+		c.JSON(http.StatusForbidden, result.Error(403, "API令牌不能用于管理两步验证"))
+		return nil, false
+	}
+	var user models.User
+	if err := database.GetDB().DB.First(&user, c.GetInt("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "用户不存在"))
+		return nil, false
+	}
+	return &user, true
+}
+
+// startTwoFactorSetup 生成新密钥并暂存在Session中
+func startTwoFactorSetup(c *gin.Context, session sessions.Session, user *models.User) {
+	secret, err := twofactor.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+		return
+	}
+	session.Set(setupSecretKey, secret)
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "session保存失败："+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("请使用验证器App扫描二维码或手动输入密钥，然后提交验证码", gin.H{
+		"secret":      secret,
+		"otpauth_url": twofactor.URL(twoFactorIssuer, user.Username, secret),
+	}))
+}
+
+// enableTwoFactor 校验暂存密钥对应的验证码，启用两步验证并生成恢复码
+func enableTwoFactor(c *gin.Context, session sessions.Session, user *models.User, code string) ([]string, bool) {
+	secret, _ := session.Get(setupSecretKey).(string)
+	if secret == "" {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请先生成两步验证密钥"))
+		return nil, false
+	}
+	step, ok := twofactor.Validate(secret, code, 0, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, result.Error(400, "验证码错误，请确认验证器时间准确"))
+		return nil, false
+	}
+
+	var codes []string
+	err := database.GetDB().DB.Transaction(func(tx *gorm.DB) error {
+		user.TOTPEnabled = true
+		user.TOTPSecret = secret
+		user.TOTPLastStep = step
+		if err := tx.Model(user).Select("totp_enabled", "totp_secret", "totp_last_step").Updates(user).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.Id)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "启用两步验证失败"))
+		return nil, false
+	}
+
+	session.Delete(setupSecretKey)
+	session.Save()
+	return codes, true
+}
+
+// verifySecondFactor 校验验证码（防重放）或消耗一个恢复码
+func verifySecondFactor(user *models.User, code, recoveryCode string) bool {
+	db := database.GetDB().DB
+	if code != "" {
+		step, ok := twofactor.Validate(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+		if !ok {
+			return false
+		}
+		// 条件更新保证同一时间步只能使用一次
+		res := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.Id, step).
+			UpdateColumn("totp_last_step", step)
+		return res.Error == nil && res.RowsAffected == 1
+	}
+	if recoveryCode != "" {
+		res := db.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.Id, twofactor.HashRecoveryCode(recoveryCode)).
+			UpdateColumn("used_at", time.Now())
+		return res.Error == nil && res.RowsAffected == 1
+	}
+	return false
+}
+
+// replaceRecoveryCodes 删除旧恢复码并生成新的一组
+func replaceRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	codes, err := twofactor.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	records := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = models.RecoveryCode{UserId: userID, CodeHash: twofactor.HashRecoveryCode(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// resetTwoFactor 关闭两步验证并删除恢复码
+func resetTwoFactor(db *gorm.DB, userID int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]any{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
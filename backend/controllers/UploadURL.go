@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -13,13 +12,11 @@ import (
 	"time"
 
 	"oneimg/backend/config"
-	"oneimg/backend/database"
 	"oneimg/backend/interfaces"
 	"oneimg/backend/models"
-	"oneimg/backend/utils/md5"
+	"oneimg/backend/utils/quota"
 	"oneimg/backend/utils/result"
 	"oneimg/backend/utils/settings"
-	"oneimg/backend/utils/telegram"
 	"oneimg/backend/utils/uploads"
 
 	"github.com/gin-gonic/gin"
@@ -27,7 +24,8 @@ import (
 
 // UploadURLRequest URL上传请求
 type UploadURLRequest struct {
-	URL string `json:"url" binding:"required"`
+	URL              string `json:"url" binding:"required"`
+	StorageProfileId int    `json:"storage_profile_id"` // 存储配置方案ID（可选，0表示系统默认存储）
 }
 
 // UploadImageByURL 通过URL上传图片
@@ -90,18 +88,23 @@ func UploadImageByURL(c *gin.Context) {
 		return
 	}
 
-	// 检查文件大小
-	// 检查文件大小 (优先使用数据库配置，兜底使用环境变量)
-	maxSize := setting.MaxFileSize
-	if maxSize <= 0 {
-		maxSize = cfg.MaxFileSize
-	}
+	// 检查文件大小 (优先使用用户配置，其次数据库配置，兜底使用环境变量)
+	user := quota.GetUser(c.GetInt("user_id"), c.GetInt("user_role"))
+	maxSize := quota.EffectiveMaxFileSize(user, setting.MaxFileSize, cfg.MaxFileSize)
 
 	if int64(len(imageData)) > maxSize {
 		c.JSON(http.StatusBadRequest, result.Error(400, fmt.Sprintf("图片大小超过限制 (最大 %d MB)", maxSize/1024/1024)))
 		return
 	}
 
+	// 校验用户存储配额
+	if err := quota.CheckStorageQuota(user, int64(len(imageData))); err != nil {
+		c.JSON(http.StatusForbidden, result.Error(403, err.Error()))
+		return
+	}
+	uploadCfg := *cfg
+	uploadCfg.MaxFileSize = maxSize
+
 	// 从URL中提取文件名
 	filename := path.Base(parsedURL.Path)
 	if filename == "" || filename == "/" || filename == "." {
@@ -111,6 +114,12 @@ func UploadImageByURL(c *gin.Context) {
 	// 创建一个虚拟的 multipart.FileHeader
 	fileHeader := createFileHeader(filename, contentType, imageData)
 
+	// 应用请求指定的存储配置方案
+	if err := settings.ApplyUploadProfile(&setting, req.StorageProfileId, c.GetInt("user_role")); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
 	// 获取存储上传器
 	uploader, err := getStorageUploader(&setting)
 	if err != nil {
@@ -119,52 +128,15 @@ func UploadImageByURL(c *gin.Context) {
 	}
 
 	// 执行上传
-	fileResult, err := uploader.Upload(c, cfg, &setting, fileHeader)
+	uploadSetting := deferUploadProcessing(setting)
+	fileResult, err := uploader.Upload(c, &uploadCfg, &uploadSetting, fileHeader)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, result.Error(500, "上传失败: "+err.Error()))
 		return
 	}
 
 	// 保存到数据库
-	imageModel := models.Image{
-		Url:       fileResult.URL,
-		Thumbnail: fileResult.ThumbnailURL,
-		FileName:  fileResult.FileName,
-		FileSize:  fileResult.FileSize,
-		MimeType:  fileResult.MimeType,
-		Width:     fileResult.Width,
-		Height:    fileResult.Height,
-		Storage:   fileResult.Storage,
-		UserId:    c.GetInt("user_id"),
-		MD5:       md5.Md5(c.GetString("username") + fileResult.FileName),
-		UUID:      GetUUID(c),
-	}
-
-	db := database.GetDB()
-	if db != nil {
-		db.DB.Create(&imageModel)
-	}
-
-	// TG通知
-	if setting.TGNotice {
-		placeholderData := telegram.PlaceholderData{
-			Username:    c.GetString("username"),
-			Date:        time.Now().Format("2006-01-02 15:04:05"),
-			Filename:    fileResult.FileName,
-			StorageType: setting.StorageType,
-			URL:         formatNotificationURL(c.Request.Host, fileResult.URL),
-		}
-
-		err := telegram.SendSimpleMsg(
-			setting.TGBotToken,
-			setting.TGReceivers,
-			setting.TGNoticeText,
-			placeholderData,
-		)
-		if err != nil {
-			log.Println(err)
-		}
-	}
+	saveUploadedImage(c, setting, fileResult, false)
 
 	// 返回结果
 	c.JSON(http.StatusOK, result.Success("上传成功", map[string]any{
@@ -5,15 +5,13 @@ import (
 
 	"oneimg/backend/utils/result"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
 func CheckLoginStatus(c *gin.Context) {
-	// 经过了AuthMiddleware，这里一定已经登录了
-	session := sessions.Default(c)
-	userID := session.Get("user_id")
-	username := session.Get("username")
+	// 经过了AuthMiddleware，这里一定已经登录了（Session或API令牌）
+	userID := c.GetInt("user_id")
+	username := c.GetString("username")
 
 	// 使用统一返回格式
 	c.JSON(http.StatusOK, result.Success(
@@ -77,10 +77,8 @@ func UpdateUserProfile(c *gin.Context) {
 			var oldImage models.Image
 			// 查找旧头像图片记录 (包括隐藏的)
 			if err := db.DB.Unscoped().Where("url = ?", oldUser.Avatar).First(&oldImage).Error; err == nil {
-				// 删除物理文件
-				DeleteImageFile(oldImage)
-				// 删除数据库记录
-				db.DB.Unscoped().Delete(&oldImage)
+				// 删除数据库记录，无其他引用时删除物理文件
+				deleteImageObject(db.DB, oldImage)
 			}
 		}
 		updates["avatar"] = req.Avatar
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/audit"
+	"oneimg/backend/utils/result"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreateUserRequest 创建用户请求
+type CreateUserRequest struct {
+	Username     string `json:"username" binding:"required,min=3,max=64"`
+	Password     string `json:"password" binding:"required,min=6"`
+	Role         int    `json:"role" binding:"required"`
+	Nickname     string `json:"nickname"`
+	Email        string `json:"email"`
+	StorageQuota int64  `json:"storage_quota"`
+	MaxFileSize  int64  `json:"max_file_size"`
+}
+
+// UpdateUserRequest 更新用户请求（字段为空表示不修改）
+type UpdateUserRequest struct {
+	Username     *string `json:"username"`
+	Password     *string `json:"password"`
+	Role         *int    `json:"role"`
+	Nickname     *string `json:"nickname"`
+	Email        *string `json:"email"`
+	StorageQuota *int64  `json:"storage_quota"`
+	MaxFileSize  *int64  `json:"max_file_size"`
+}
+
+// UserListItem 用户列表项（不包含密码）
+type UserListItem struct {
+	Id           int    `json:"id"`
+	Username     string `json:"username"`
+	Nickname     string `json:"nickname"`
+	Avatar       string `json:"avatar"`
+	Email        string `json:"email"`
+	Role         int    `json:"role"`
+	StorageQuota int64  `json:"storage_quota"`
+	MaxFileSize  int64  `json:"max_file_size"`
+	ImageCount   int64  `json:"image_count"`
+	UsedStorage  int64  `json:"used_storage"`
+	OIDCLinked   bool   `json:"oidc_linked"` // 是否已关联单点登录身份
+}
+
+// ListUsers 获取用户列表（含存储使用量）
+func ListUsers(c *gin.Context) {
+	db := database.GetDB().DB
+
+	var users []models.User
+	if err := db.Order("id ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取用户列表失败"))
+		return
+	}
+
+	// 按用户汇总图片数量和占用空间
+	var usages []struct {
+		UserId int
+		Count  int64
+		Total  int64
+	}
+	db.Model(&models.Image{}).
+		Select("user_id, COUNT(*) as count, COALESCE(SUM(file_size), 0) as total").
+		Group("user_id").
+		Scan(&usages)
+	usageMap := make(map[int]int)
+	for i, u := range usages {
+		usageMap[u.UserId] = i
+	}
+
+	items := make([]UserListItem, 0, len(users))
+	for _, u := range users {
+		item := toUserListItem(u)
+		if i, ok := usageMap[u.Id]; ok {
+			item.ImageCount = usages[i].Count
+			item.UsedStorage = usages[i].Total
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", items))
+}
+
+// CreateUser 创建用户
+func CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if err := validateUserFields(req.Username, req.Role, req.StorageQuota, req.MaxFileSize); err != "" {
+		c.JSON(http.StatusBadRequest, result.Error(400, err))
+		return
+	}
+
+	db := database.GetDB().DB
+	var count int64
+	db.Model(&models.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "用户名已存在"))
+		return
+	}
+	email, msg := normalizeUserEmail(req.Email, 0)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, result.Error(400, msg))
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "密码加密失败"))
+		return
+	}
+
+	user := models.User{
+		Username:     req.Username,
+		Password:     string(hashedPassword),
+		Role:         req.Role,
+		Nickname:     req.Nickname,
+		Email:        email,
+		StorageQuota: req.StorageQuota,
+		MaxFileSize:  req.MaxFileSize,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建用户失败"))
+		return
+	}
+	audit.Record(c, models.AuditUserCreate, "user", user.Id, nil, user)
+
+	c.JSON(http.StatusOK, result.Success("创建成功", toUserListItem(user)))
+}
+
+// UpdateUser 更新用户信息、角色和配额
+func UpdateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "用户ID无效"))
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	db := database.GetDB().DB
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "用户不存在"))
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if len(username) < 3 || len(username) > 64 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "用户名长度需在3-64之间"))
+			return
+		}
+		if isTouristUsername(username) {
+			c.JSON(http.StatusBadRequest, result.Error(400, "游客保留用户名"))
+			return
+		}
+		var count int64
+		db.Model(&models.User{}).Where("username = ? AND id != ?", username, id).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "用户名已存在"))
+			return
+		}
+		updates["username"] = username
+	}
+	if req.Password != nil {
+		if len(*req.Password) < 6 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "密码长度不能少于6位"))
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, result.Error(500, "密码加密失败"))
+			return
+		}
+		updates["password"] = string(hashedPassword)
+	}
+	if req.Role != nil {
+		if !models.IsValidRole(*req.Role) || *req.Role == models.RoleTourist {
+			c.JSON(http.StatusBadRequest, result.Error(400, "角色无效"))
+			return
+		}
+		// 避免移除最后一个管理员
+		if user.Role == models.RoleAdmin && *req.Role != models.RoleAdmin && countAdmins() <= 1 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "至少需要保留一个管理员"))
+			return
+		}
+		updates["role"] = *req.Role
+	}
+	if req.Nickname != nil {
+		updates["nickname"] = *req.Nickname
+	}
+	if req.Email != nil {
+		email, msg := normalizeUserEmail(*req.Email, id)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, result.Error(400, msg))
+			return
+		}
+		updates["email"] = email
+	}
+	if req.StorageQuota != nil {
+		if *req.StorageQuota < 0 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "存储配额不能为负数"))
+			return
+		}
+		updates["storage_quota"] = *req.StorageQuota
+	}
+	if req.MaxFileSize != nil {
+		if *req.MaxFileSize < 0 {
+			c.JSON(http.StatusBadRequest, result.Error(400, "单文件大小上限不能为负数"))
+			return
+		}
+		updates["max_file_size"] = *req.MaxFileSize
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "没有要更新的内容"))
+		return
+	}
+
+	before := user
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "更新失败"))
+		return
+	}
+
+	db.First(&user, id)
+	audit.Record(c, models.AuditUserUpdate, "user", user.Id, before, user)
+	c.JSON(http.StatusOK, result.Success("更新成功", toUserListItem(user)))
+}
+
+// DeleteUser 删除用户（保留其图片，同时撤销其API令牌）
+func DeleteUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "用户ID无效"))
+		return
+	}
+
+	if id == c.GetInt("user_id") {
+		c.JSON(http.StatusBadRequest, result.Error(400, "不能删除当前登录的账号"))
+		return
+	}
+
+	db := database.GetDB().DB
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "用户不存在"))
+		return
+	}
+
+	if user.Role == models.RoleAdmin && countAdmins() <= 1 {
+		c.JSON(http.StatusBadRequest, result.Error(400, "至少需要保留一个管理员"))
+		return
+	}
+
+	tx := db.Begin()
+	if err := tx.Where("user_id = ?", user.Id).Delete(&models.ApiToken{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, result.Error(500, "撤销用户令牌失败"))
+		return
+	}
+	if err := tx.Where("user_id = ?", user.Id).Delete(&models.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, result.Error(500, "删除用户恢复码失败"))
+		return
+	}
+	if err := tx.Delete(&user).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, result.Error(500, "删除用户失败"))
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "删除用户失败"))
+		return
+	}
+	audit.Record(c, models.AuditUserDelete, "user", user.Id, user, nil)
+
+	c.JSON(http.StatusOK, result.Success("删除成功", nil))
+}
+
+// validateUserFields 校验创建用户的字段，返回错误信息
+func validateUserFields(username string, role int, storageQuota, maxFileSize int64) string {
+	if isTouristUsername(username) {
+		return "游客保留用户名"
+	}
+	if !models.IsValidRole(role) || role == models.RoleTourist {
+		return "角色无效"
+	}
+	if storageQuota < 0 || maxFileSize < 0 {
+		return "配额不能为负数"
+	}
+	return ""
+}
+
+// normalizeUserEmail 规范化并校验邮箱（可为空），返回小写邮箱和错误信息
+// 邮箱用于关联单点登录身份，不允许多个用户使用同一邮箱
+func normalizeUserEmail(email string, excludeId int) (string, string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", ""
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email || len(email) > 191 {
+		return "", "邮箱格式不正确"
+	}
+	var count int64
+	database.GetDB().DB.Model(&models.User{}).Where("email = ? AND id != ?", email, excludeId).Count(&count)
+	if count > 0 {
+		return "", "邮箱已被其他用户使用"
+	}
+	return email, ""
+}
+
+// countAdmins 统计管理员数量
+func countAdmins() int64 {
+	var count int64
+	database.GetDB().DB.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&count)
+	return count
+}
+
+// toUserListItem 转换为不含密码的用户信息
+func toUserListItem(u models.User) UserListItem {
+	return UserListItem{
+		Id:           u.Id,
+		Username:     u.Username,
+		Nickname:     u.Nickname,
+		Avatar:       u.Avatar,
+		Email:        u.Email,
+		Role:         u.Role,
+		StorageQuota: u.StorageQuota,
+		MaxFileSize:  u.MaxFileSize,
+		OIDCLinked:   u.OIDCSubject != "",
+	}
+}
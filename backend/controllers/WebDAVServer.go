@@ -0,0 +1,716 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/middlewares"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/quota"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/storage"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+)
+
+// davAlbumsDir 根目录下存放相册的目录名
+const davAlbumsDir = "albums"
+
+// davLocks WebDAV锁（仅为满足客户端的 LOCK/UNLOCK 流程，保存在内存中）
+var davLocks = webdav.NewMemLS()
+
+// WebDAVMethods WebDAV服务端需要注册的请求方法
+var WebDAVMethods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// WebDAVServer 以 WebDAV 协议提供当前用户的图库
+// 目录结构：/<年>/<月>/<文件名> 按上传时间归档，/albums/<相册名>/<文件名> 按相册归档
+func WebDAVServer(c *gin.Context) {
+	if c.GetInt("user_role") == models.RoleTourist {
+		c.String(http.StatusForbidden, "游客无法使用WebDAV")
+		return
+	}
+
+	scope := davMethodScope(c.Request.Method)
+	if !models.RoleHasPermission(c.GetInt("user_role"), scope) || !middlewares.HasScope(c, scope) {
+		c.String(http.StatusForbidden, "缺少权限："+scope)
+		return
+	}
+
+	// 写入文件与上传接口共用限流规则
+	if c.Request.Method == http.MethodPut {
+		if seconds := middlewares.CheckUploadRateLimit(c); seconds > 0 {
+			c.String(http.StatusTooManyRequests, fmt.Sprintf("上传过于频繁，请 %d 秒后重试", seconds))
+			return
+		}
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+	handler := &webdav.Handler{
+		Prefix:     cfg.WebDAVServerPath,
+		FileSystem: &davFileSystem{c: c, cfg: cfg, userId: c.GetInt("user_id")},
+		LockSystem: davLocks,
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("WebDAV %s %s 失败: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	handler.ServeHTTP(c.Writer, c.Request)
+}
+
+// davMethodScope 请求方法所需的权限范围
+func davMethodScope(method string) string {
+	switch method {
+	case http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND":
+		return models.ScopeRead
+	case http.MethodDelete:
+		return models.ScopeDelete
+	default:
+		return models.ScopeUpload
+	}
+}
+
+// davKind 路径类型
+type davKind int
+
+const (
+	davRoot   davKind = iota // /
+	davYear                  // /2026
+	davMonth                 // /2026/01
+	davAlbums                // /albums
+	davAlbum                 // /albums/<相册名>
+	davFile                  // 月份目录、相册目录或根目录下的文件
+)
+
+// davPath 解析后的WebDAV路径
+type davPath struct {
+	kind  davKind
+	year  int
+	month int
+	album string // 相册目录名（相册内的文件同样填写）
+	file  string
+}
+
+// parseDavPath 解析WebDAV路径，不符合目录结构的路径视为不存在
+func parseDavPath(name string) (davPath, error) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	if parts[0] == "" {
+		return davPath{kind: davRoot}, nil
+	}
+
+	if parts[0] == davAlbumsDir {
+		switch len(parts) {
+		case 1:
+			return davPath{kind: davAlbums}, nil
+		case 2:
+			return davPath{kind: davAlbum, album: parts[1]}, nil
+		case 3:
+			return davPath{kind: davFile, album: parts[1], file: parts[2]}, nil
+		}
+		return davPath{}, os.ErrNotExist
+	}
+
+	year, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts[0]) != 4 {
+		// 根目录下的普通文件名只用于上传
+		if len(parts) == 1 {
+			return davPath{kind: davFile, file: parts[0]}, nil
+		}
+		return davPath{}, os.ErrNotExist
+	}
+	if len(parts) == 1 {
+		return davPath{kind: davYear, year: year}, nil
+	}
+
+	month, err := strconv.Atoi(parts[1])
+	if err != nil || len(parts[1]) != 2 || month < 1 || month > 12 {
+		return davPath{}, os.ErrNotExist
+	}
+	switch len(parts) {
+	case 2:
+		return davPath{kind: davMonth, year: year, month: month}, nil
+	case 3:
+		return davPath{kind: davFile, year: year, month: month, file: parts[2]}, nil
+	}
+	return davPath{}, os.ErrNotExist
+}
+
+// davFileSystem 将当前用户的图片映射为 webdav.FileSystem
+type davFileSystem struct {
+	c      *gin.Context
+	cfg    *config.Config
+	userId int
+}
+
+func (fs *davFileSystem) db() *gorm.DB {
+	return database.GetDB().DB
+}
+
+// images 当前用户的图片查询
+func (fs *davFileSystem) images() *gorm.DB {
+	return fs.db().Model(&models.Image{}).Where("user_id = ?", fs.userId)
+}
+
+// hasImages 指定时间范围内是否存在图片
+func (fs *davFileSystem) hasImages(start, end time.Time) bool {
+	var ids []int
+	fs.images().Where("created_at >= ? AND created_at < ?", start, end).Limit(1).Pluck("id", &ids)
+	return len(ids) > 0
+}
+
+// albums 当前用户的相册及其目录名（重名时追加 ~ID 区分）
+func (fs *davFileSystem) albums() ([]models.Album, []string, error) {
+	var albums []models.Album
+	if err := fs.db().Where("user_id = ?", fs.userId).Order("id").Find(&albums).Error; err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	names := make([]string, len(albums))
+	for i, album := range albums {
+		names[i] = davUniqueName(seen, strings.ReplaceAll(album.Name, "/", "_"), album.Id)
+	}
+	return albums, names, nil
+}
+
+// findAlbum 根据目录名查找相册
+func (fs *davFileSystem) findAlbum(dirName string) (*models.Album, error) {
+	albums, names, err := fs.albums()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if name == dirName {
+			return &albums[i], nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// dirImages 返回目录内图片的查询构造函数
+func (fs *davFileSystem) dirImages(p davPath) (func() *gorm.DB, error) {
+	if p.album != "" {
+		album, err := fs.findAlbum(p.album)
+		if err != nil {
+			return nil, err
+		}
+		return func() *gorm.DB {
+			return fs.images().Where("id IN (?)", albumImageIds(fs.db(), album.Id))
+		}, nil
+	}
+	if p.year == 0 {
+		return nil, os.ErrNotExist
+	}
+	start, end := davMonthRange(p.year, p.month)
+	return func() *gorm.DB {
+		return fs.images().Where("created_at >= ? AND created_at < ?", start, end)
+	}, nil
+}
+
+// findImage 根据文件名查找图片（重名文件以 名称~ID.扩展名 区分）
+func (fs *davFileSystem) findImage(p davPath) (models.Image, error) {
+	var image models.Image
+	query, err := fs.dirImages(p)
+	if err != nil {
+		return image, err
+	}
+	if query().Where("file_name = ?", p.file).Order("id").First(&image).Error == nil {
+		return image, nil
+	}
+	if fileName, id, ok := parseDavUniqueName(p.file); ok {
+		if query().Where("id = ? AND file_name = ?", id, fileName).First(&image).Error == nil {
+			return image, nil
+		}
+	}
+	return image, os.ErrNotExist
+}
+
+// Stat 获取文件或目录信息
+func (fs *davFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	p, err := parseDavPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.stat(p)
+}
+
+func (fs *davFileSystem) stat(p davPath) (*davFileInfo, error) {
+	switch p.kind {
+	case davRoot:
+		return davDirInfo("/", time.Now()), nil
+	case davAlbums:
+		return davDirInfo(davAlbumsDir, time.Now()), nil
+	case davYear:
+		start := time.Date(p.year, time.January, 1, 0, 0, 0, 0, time.Local)
+		if !fs.hasImages(start, start.AddDate(1, 0, 0)) {
+			return nil, os.ErrNotExist
+		}
+		return davDirInfo(strconv.Itoa(p.year), start), nil
+	case davMonth:
+		start, end := davMonthRange(p.year, p.month)
+		if !fs.hasImages(start, end) {
+			return nil, os.ErrNotExist
+		}
+		return davDirInfo(fmt.Sprintf("%02d", p.month), start), nil
+	case davAlbum:
+		album, err := fs.findAlbum(p.album)
+		if err != nil {
+			return nil, err
+		}
+		return davDirInfo(p.album, album.UpdatedAt), nil
+	}
+
+	image, err := fs.findImage(p)
+	if err != nil {
+		return nil, err
+	}
+	return davImageInfo(p.file, image), nil
+}
+
+// OpenFile 打开文件或目录，写入模式时返回上传文件
+func (fs *davFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	p, err := parseDavPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		return fs.create(p)
+	}
+
+	info, err := fs.stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &davDir{fs: fs, path: p, info: info}, nil
+	}
+	image, err := fs.findImage(p)
+	if err != nil {
+		return nil, err
+	}
+	return &davImageFile{ctx: ctx, image: image, info: info}, nil
+}
+
+// create 创建上传文件，关闭时按正常上传流程写入存储
+// 上传后的文件名由上传规则生成，图片归档到上传当月；写入相册目录时同时加入相册
+// 覆盖已有文件时，新图片写入成功后删除旧图片（相册目录中只移出相册）
+func (fs *davFileSystem) create(p davPath) (webdav.File, error) {
+	if p.kind != davFile {
+		return nil, os.ErrPermission
+	}
+	var album *models.Album
+	if p.album != "" {
+		var err error
+		if album, err = fs.findAlbum(p.album); err != nil {
+			return nil, err
+		}
+	}
+	var replace *models.Image
+	if image, err := fs.findImage(p); err == nil {
+		// 在月份目录覆盖会删除旧图片，需要删除权限
+		if p.album == "" && (!models.RoleHasPermission(fs.c.GetInt("user_role"), models.ScopeDelete) || !middlewares.HasScope(fs.c, models.ScopeDelete)) {
+			return nil, os.ErrPermission
+		}
+		replace = &image
+	}
+
+	setting, err := settings.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	user := quota.GetUser(fs.userId, fs.c.GetInt("user_role"))
+	return &davUploadFile{
+		fs:      fs,
+		name:    p.file,
+		album:   album,
+		replace: replace,
+		setting: setting,
+		user:    user,
+		maxSize: quota.EffectiveMaxFileSize(user, setting.MaxFileSize, fs.cfg.MaxFileSize),
+	}, nil
+}
+
+// Mkdir 在相册目录下创建目录即创建相册
+func (fs *davFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	p, err := parseDavPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.stat(p); err == nil {
+		return os.ErrExist
+	}
+	if p.kind != davAlbum || strings.TrimSpace(p.album) == "" {
+		return os.ErrPermission
+	}
+	return fs.db().Create(&models.Album{UserId: fs.userId, Name: strings.TrimSpace(p.album)}).Error
+}
+
+// RemoveAll 删除月份目录中的文件即删除图片；删除相册目录中的文件只移出相册；删除相册目录即删除相册（不删除图片）
+func (fs *davFileSystem) RemoveAll(ctx context.Context, name string) error {
+	p, err := parseDavPath(name)
+	if err != nil {
+		return err
+	}
+
+	switch p.kind {
+	case davAlbum:
+		album, err := fs.findAlbum(p.album)
+		if err != nil {
+			return err
+		}
+		return deleteAlbum(fs.db(), album)
+	case davFile:
+		if davIgnored(p.file) {
+			return nil
+		}
+		image, err := fs.findImage(p)
+		if err != nil {
+			return err
+		}
+		if p.album != "" {
+			album, err := fs.findAlbum(p.album)
+			if err != nil {
+				return err
+			}
+			return removeImagesFromAlbum(fs.db(), album, []int{image.Id})
+		}
+		_, err = removeImage(fs.db(), image)
+		return err
+	}
+	return os.ErrPermission
+}
+
+// Rename 支持重命名相册，以及在相册之间移动图片
+func (fs *davFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	src, err := parseDavPath(oldName)
+	if err != nil {
+		return err
+	}
+	dst, err := parseDavPath(newName)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case src.kind == davAlbum && dst.kind == davAlbum:
+		album, err := fs.findAlbum(src.album)
+		if err != nil {
+			return err
+		}
+		if _, err := fs.findAlbum(dst.album); err == nil {
+			return os.ErrExist
+		}
+		return fs.db().Model(album).Update("name", strings.TrimSpace(dst.album)).Error
+	case src.kind == davFile && dst.kind == davFile && src.album != "" && dst.album != "" && src.file == dst.file:
+		image, err := fs.findImage(src)
+		if err != nil {
+			return err
+		}
+		from, err := fs.findAlbum(src.album)
+		if err != nil {
+			return err
+		}
+		to, err := fs.findAlbum(dst.album)
+		if err != nil {
+			return err
+		}
+		if err := addImagesToAlbum(fs.db(), to.Id, []int{image.Id}); err != nil {
+			return err
+		}
+		return removeImagesFromAlbum(fs.db(), from, []int{image.Id})
+	}
+	return os.ErrPermission
+}
+
+// readdir 列出目录内容
+func (fs *davFileSystem) readdir(p davPath) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+	switch p.kind {
+	case davRoot:
+		var first, last models.Image
+		if fs.images().Order("created_at").First(&first).Error == nil {
+			fs.images().Order("created_at DESC").First(&last)
+			for year := last.CreatedAt.Local().Year(); year >= first.CreatedAt.Local().Year(); year-- {
+				if info, err := fs.stat(davPath{kind: davYear, year: year}); err == nil {
+					infos = append(infos, info)
+				}
+			}
+		}
+		infos = append(infos, davDirInfo(davAlbumsDir, time.Now()))
+	case davYear:
+		for month := 12; month >= 1; month-- {
+			if info, err := fs.stat(davPath{kind: davMonth, year: p.year, month: month}); err == nil {
+				infos = append(infos, info)
+			}
+		}
+	case davAlbums:
+		albums, names, err := fs.albums()
+		if err != nil {
+			return nil, err
+		}
+		for i, album := range albums {
+			infos = append(infos, davDirInfo(names[i], album.UpdatedAt))
+		}
+	case davMonth, davAlbum:
+		query, err := fs.dirImages(p)
+		if err != nil {
+			return nil, err
+		}
+		var images []models.Image
+		if err := query().Order("id").Find(&images).Error; err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, image := range images {
+			infos = append(infos, davImageInfo(davUniqueName(seen, image.FileName, image.Id), image))
+		}
+	}
+	return infos, nil
+}
+
+// davFileInfo 文件或目录信息，实现 webdav.ContentTyper 与 webdav.ETager 以避免读取文件内容
+type davFileInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	dir         bool
+	contentType string
+	etag        string
+}
+
+func davDirInfo(name string, modTime time.Time) *davFileInfo {
+	return &davFileInfo{name: name, modTime: modTime, dir: true}
+}
+
+func davImageInfo(name string, image models.Image) *davFileInfo {
+	return &davFileInfo{
+		name:        name,
+		size:        image.FileSize,
+		modTime:     image.CreatedAt,
+		contentType: image.MimeType,
+		etag:        imageETag(image, image.Url),
+	}
+}
+
+func (fi *davFileInfo) Name() string       { return fi.name }
+func (fi *davFileInfo) Size() int64        { return fi.size }
+func (fi *davFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *davFileInfo) IsDir() bool        { return fi.dir }
+func (fi *davFileInfo) Sys() any           { return nil }
+
+func (fi *davFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.contentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.contentType, nil
+}
+
+func (fi *davFileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.etag, nil
+}
+
+// davDir 目录
+type davDir struct {
+	fs     *davFileSystem
+	path   davPath
+	info   *davFileInfo
+	infos  []os.FileInfo
+	loaded bool
+}
+
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.loaded {
+		infos, err := d.fs.readdir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.infos, d.loaded = infos, true
+	}
+	if count <= 0 {
+		infos := d.infos
+		d.infos = nil
+		return infos, nil
+	}
+	if len(d.infos) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.infos))
+	infos := d.infos[:n]
+	d.infos = d.infos[n:]
+	return infos, nil
+}
+
+func (d *davDir) Stat() (os.FileInfo, error)                   { return d.info, nil }
+func (d *davDir) Close() error                                 { return nil }
+func (d *davDir) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *davDir) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (d *davDir) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+
+// davImageFile 只读图片文件，首次读取时从存储加载内容
+type davImageFile struct {
+	ctx    context.Context
+	image  models.Image
+	info   *davFileInfo
+	reader *bytes.Reader
+}
+
+func (f *davImageFile) load() error {
+	if f.reader != nil {
+		return nil
+	}
+	setting, err := settings.ForImage(f.image)
+	if err != nil {
+		return err
+	}
+	backend, err := storage.New(f.image.Storage, setting)
+	if err != nil {
+		return err
+	}
+	obj, err := backend.Read(f.ctx, f.image)
+	if err != nil {
+		return err
+	}
+	f.reader = bytes.NewReader(obj.Data)
+	return nil
+}
+
+func (f *davImageFile) Read(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Read(p)
+}
+
+func (f *davImageFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *davImageFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *davImageFile) Close() error                             { return nil }
+func (f *davImageFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *davImageFile) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+
+// davUploadFile 上传中的文件，内容缓存在内存中，关闭时写入存储
+type davUploadFile struct {
+	fs      *davFileSystem
+	name    string
+	album   *models.Album
+	replace *models.Image // 被覆盖的旧图片
+	setting models.Settings
+	user    *models.User
+	maxSize int64
+	buf     bytes.Buffer
+	closed  bool
+}
+
+func (f *davUploadFile) Write(p []byte) (int, error) {
+	if int64(f.buf.Len()+len(p)) > f.maxSize {
+		return 0, fmt.Errorf("文件大小超过限制 (最大 %d MB)", f.maxSize/1024/1024)
+	}
+	return f.buf.Write(p)
+}
+
+// Close 写入存储；空文件（部分客户端会先创建空文件再写入内容）和系统元数据文件直接丢弃
+func (f *davUploadFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.buf.Len() == 0 || davIgnored(f.name) {
+		return nil
+	}
+
+	if err := quota.CheckStorageQuota(f.user, int64(f.buf.Len())); err != nil {
+		return err
+	}
+	image, err := uploadImageData(f.fs.c, f.fs.cfg, f.setting, f.maxSize, f.name, f.buf.Bytes(), false)
+	if err != nil {
+		return err
+	}
+	if f.album != nil {
+		if err := addImagesToAlbum(f.fs.db(), f.album.Id, []int{image.Id}); err != nil {
+			return err
+		}
+	}
+
+	if f.replace != nil {
+		if f.album != nil {
+			return removeImagesFromAlbum(f.fs.db(), f.album, []int{f.replace.Id})
+		}
+		_, err = removeImage(f.fs.db(), *f.replace)
+		return err
+	}
+	return nil
+}
+
+func (f *davUploadFile) Stat() (os.FileInfo, error) {
+	return &davFileInfo{name: f.name, size: int64(f.buf.Len()), modTime: time.Now()}, nil
+}
+
+func (f *davUploadFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *davUploadFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (f *davUploadFile) Readdir(count int) ([]os.FileInfo, error)     { return nil, os.ErrInvalid }
+
+// davMonthRange 月份的起止时间（服务器本地时区）
+func davMonthRange(year, month int) (time.Time, time.Time) {
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// davUniqueName 同一目录下重名时追加 ~ID 区分
+func davUniqueName(seen map[string]bool, name string, id int) string {
+	if !seen[name] {
+		seen[name] = true
+		return name
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s~%d%s", strings.TrimSuffix(name, ext), id, ext)
+}
+
+// parseDavUniqueName 解析 名称~ID.扩展名 形式的文件名
+func parseDavUniqueName(name string) (string, int, bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	i := strings.LastIndex(stem, "~")
+	if i < 0 {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(stem[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return stem[:i] + ext, id, true
+}
+
+// davIgnored 客户端生成的系统元数据文件，上传时直接丢弃
+func davIgnored(name string) bool {
+	return strings.HasPrefix(name, "._") || name == ".DS_Store" || name == "Thumbs.db" || name == "desktop.ini"
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookRequest 创建/更新Webhook请求
+type WebhookRequest struct {
+	Name         string   `json:"name" binding:"max=64"`
+	Url          string   `json:"url"`
+	Events       []string `json:"events"`
+	Enabled      *bool    `json:"enabled"`
+	Secret       string   `json:"secret"`        // 创建时可指定签名密钥，留空自动生成
+	RotateSecret bool     `json:"rotate_secret"` // 更新时重新生成签名密钥
+}
+
+// WebhookWithSecret 创建或重置密钥后返回（密钥只返回这一次）
+type WebhookWithSecret struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// ListWebhooks 获取Webhook列表
+func ListWebhooks(c *gin.Context) {
+	var hooks []models.Webhook
+	if err := database.GetDB().DB.Order("id ASC").Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取Webhook列表失败"))
+		return
+	}
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"webhooks": hooks,
+		"events":   models.WebhookEvents,
+	}))
+}
+
+// CreateWebhook 创建Webhook
+func CreateWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	hook := models.Webhook{
+		Name:      strings.TrimSpace(req.Name),
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		CreatedBy: c.GetInt("user_id"),
+	}
+	if err := applyWebhookRequest(&hook, req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+
+	hook.Secret = req.Secret
+	if hook.Secret == "" {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+			return
+		}
+		hook.Secret = secret
+	}
+
+	if err := database.GetDB().DB.Create(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建Webhook失败"))
+		return
+	}
+	c.JSON(http.StatusOK, result.Success("创建成功，请妥善保存签名密钥", WebhookWithSecret{hook, hook.Secret}))
+}
+
+// UpdateWebhook 更新Webhook，rotate_secret 为 true 时重新生成签名密钥
+func UpdateWebhook(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "请求参数错误: "+err.Error()))
+		return
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		hook.Name = name
+	}
+	if req.Url == "" {
+		req.Url = hook.Url
+	}
+	if req.Events == nil {
+		req.Events = hook.EventList()
+	}
+	if err := applyWebhookRequest(&hook, req); err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, err.Error()))
+		return
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+	if req.RotateSecret {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, result.Error(500, err.Error()))
+			return
+		}
+		hook.Secret = secret
+	}
+
+	if err := database.GetDB().DB.Save(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "更新Webhook失败"))
+		return
+	}
+	if req.RotateSecret {
+		c.JSON(http.StatusOK, result.Success("更新成功，请妥善保存新的签名密钥", WebhookWithSecret{hook, hook.Secret}))
+		return
+	}
+	c.JSON(http.StatusOK, result.Success("更新成功", hook))
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func DeleteWebhook(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB().DB
+	if err := db.Delete(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "删除Webhook失败"))
+		return
+	}
+	db.Where("webhook_id = ?", hook.Id).Delete(&models.WebhookDelivery{})
+	c.JSON(http.StatusOK, result.Success("删除成功", nil))
+}
+
+// TestWebhook 发送一次测试事件（ping）
+func TestWebhook(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	job, err := webhooks.Ping(hook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "创建测试投递失败"))
+		return
+	}
+	c.JSON(http.StatusOK, result.Success("测试事件已排队", job))
+}
+
+// ListWebhookDeliveries 获取Webhook的投递记录
+func ListWebhookDeliveries(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := database.GetDB().DB
+	query := db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", hook.Id)
+	if eventId := c.Query("event_id"); eventId != "" {
+		query = query.Where("event_id = ?", eventId)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取投递记录失败"))
+		return
+	}
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, result.Error(500, "获取投递记录失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Success("获取成功", gin.H{
+		"deliveries":  deliveries,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	}))
+}
+
+// loadWebhook 按路径参数加载Webhook
+func loadWebhook(c *gin.Context) (models.Webhook, bool) {
+	var hook models.Webhook
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.Error(400, "无效的Webhook ID"))
+		return hook, false
+	}
+	if err := database.GetDB().DB.First(&hook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, result.Error(404, "Webhook不存在"))
+		return hook, false
+	}
+	return hook, true
+}
+
+// applyWebhookRequest 校验并写入地址和订阅事件
+func applyWebhookRequest(hook *models.Webhook, req WebhookRequest) error {
+	u, err := url.Parse(strings.TrimSpace(req.Url))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Webhook地址必须是有效的 http/https 地址")
+	}
+	if len(req.Events) == 0 {
+		return fmt.Errorf("请至少订阅一个事件")
+	}
+
+	events := make([]string, 0, len(req.Events))
+	for _, event := range req.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return fmt.Errorf("不支持的事件：%s", event)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	hook.Url = u.String()
+	hook.Events = strings.Join(events, ",")
+	if hook.Name == "" {
+		hook.Name = u.Host
+	}
+	return nil
+}
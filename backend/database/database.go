@@ -5,9 +5,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"oneimg/backend/config"
 	"oneimg/backend/models"
+	"oneimg/backend/utils/secrets"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -45,6 +47,11 @@ func InitDB(cfg *config.Config) {
 	var dialector gorm.Dialector
 	var dbType string
 
+	// 加载设置加密主密钥（读写 settings 表前必须完成）
+	if err := secrets.Init(cfg.SettingsEncryptionKey, cfg.SettingsEncryptionOldKeys); err != nil {
+		log.Fatal(err)
+	}
+
 	// 根据配置选择数据库类型（优先级：PostgreSQL > MySQL > SQLite）
 	if cfg.IsPostgres {
 		// 使用 PostgreSQL
@@ -85,13 +92,102 @@ func InitDB(cfg *config.Config) {
 
 	log.Println("数据库连接成功")
 
+	// 迁移旧版数据结构
+	migrateLegacySchema(db.DB)
+
 	// 自动迁移数据表
-	err = db.DB.AutoMigrate(&models.User{}, &models.Image{}, &models.Settings{}, &models.ImageTeleGram{})
+	err = db.DB.AutoMigrate(&models.User{}, &models.Image{}, &models.Settings{}, &models.ImageTeleGram{}, &models.ApiToken{}, &models.Album{}, &models.AlbumImage{}, &models.Tag{}, &models.ImageTag{}, &models.StorageMigration{}, &models.StorageProfile{}, &models.UploadSession{}, &models.S3Object{}, &models.Job{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.AuditLog{}, &models.RecoveryCode{}, &models.LoginLockout{}, &models.PowChallenge{}, &models.RateLimitUsage{})
 	if err != nil {
 		log.Fatal("数据库迁移失败:", err)
 	}
 
 	log.Println("数据库表迁移完成")
+
+	// 按当前主密钥加密（或重新加密）设置和存储配置方案中的密钥、用户的两步验证密钥、S3访问密钥及Webhook签名密钥
+	for _, model := range []any{&models.Settings{}, &models.User{}, &models.StorageProfile{}, &models.ApiToken{}, &models.Webhook{}} {
+		if err := migrateEncryptedColumns(db.DB, model); err != nil {
+			log.Fatal("密钥加密迁移失败:", err)
+		}
+	}
+}
+
+// migrateEncryptedColumns 检查数据表中加密字段（serializer:encrypted）的存储状态，
+// 明文或使用旧主密钥加密的值按当前主密钥重新写入；
+// 未配置主密钥而旧密钥仍可解密时，写回明文（用于关闭加密）
+func migrateEncryptedColumns(gormDB *gorm.DB, model any) error {
+	stmt := &gorm.Statement{DB: gormDB}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	var columns []string
+	for _, field := range stmt.Schema.Fields {
+		if field.TagSettings["SERIALIZER"] == "encrypted" {
+			columns = append(columns, field.DBName)
+		}
+	}
+
+	// 直接读取数据库原始值，不经过解密
+	var rows []map[string]any
+	if err := gormDB.Table(stmt.Schema.Table).Select(append([]string{"id"}, columns...)).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	count := 0
+	for _, row := range rows {
+		rewrap := false
+		for _, column := range columns {
+			if secrets.NeedsRewrap(rawString(row[column])) {
+				rewrap = true
+				break
+			}
+		}
+		if !rewrap {
+			continue
+		}
+
+		record := reflect.New(stmt.Schema.ModelType).Interface()
+		if err := gormDB.First(record, row["id"]).Error; err != nil {
+			return err
+		}
+		if err := gormDB.Model(record).Select(columns).Updates(record).Error; err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count > 0 {
+		if secrets.Enabled() {
+			log.Printf("已加密 %s 表中 %d 条记录的密钥", stmt.Schema.Table, count)
+		} else {
+			log.Printf("未配置 SETTINGS_ENCRYPTION_KEY，已将 %s 表中 %d 条记录的密钥还原为明文", stmt.Schema.Table, count)
+		}
+	}
+	return nil
+}
+
+// rawString 数据库原始值转为字符串（部分驱动返回 []byte）
+func rawString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+// migrateLegacySchema 处理AutoMigrate无法完成的旧版结构变更
+func migrateLegacySchema(gormDB *gorm.DB) {
+	// 旧版 users.role 带有唯一索引，导致只能存在一个管理员
+	migrator := gormDB.Migrator()
+	if migrator.HasTable(&models.User{}) && migrator.HasIndex(&models.User{}, "unique_idx") {
+		if err := migrator.DropIndex(&models.User{}, "unique_idx"); err != nil {
+			log.Printf("删除旧版用户角色唯一索引失败: %v", err)
+		} else {
+			log.Println("已删除旧版用户角色唯一索引")
+		}
+	}
 }
 
 // 辅助函数，如果数据库目录不存在则创建
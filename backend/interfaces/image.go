@@ -22,6 +22,12 @@ type ImageUploadResult struct {
 	Width        int    `json:"width,omitempty"`
 	Height       int    `json:"height,omitempty"`
 	CreatedAt    string `json:"created_at,omitempty"`
+	ContentHash  string `json:"content_hash,omitempty"` // 原始文件内容哈希
+	ProcessKey   string `json:"-"`                      // 处理设置摘要（去重依据）
+	Deduplicated bool   `json:"deduplicated,omitempty"` // 是否复用了已存在的相同文件
+	Deferred     bool   `json:"-"`                      // 水印和格式转换交由后台任务处理
+	Status       string `json:"status,omitempty"`       // 上传后处理状态：pending（后台任务未完成）/ ready
+	Jobs         []int  `json:"jobs,omitempty"`         // 上传后处理的后台任务ID
 }
 
 // Upload 上传处理接口
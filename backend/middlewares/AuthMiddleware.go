@@ -2,6 +2,11 @@ package middlewares
 
 import (
 	"net/http"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/apitoken"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -13,9 +18,23 @@ type AuthResponse struct {
 	Message string `json:"message"`
 }
 
-// AuthMiddleware Session认证中间件
+// AuthMiddleware Session认证中间件（同时支持 Authorization: Bearer 令牌）
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 优先使用API令牌认证
+		if token := apitoken.FromAuthorizationHeader(c.GetHeader("Authorization")); token != "" {
+			if !authenticateToken(c, token) {
+				c.JSON(http.StatusUnauthorized, AuthResponse{
+					Code:    401,
+					Message: "API令牌无效或已过期",
+				})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		// 获取session
 		session := sessions.Default(c)
 
@@ -30,6 +49,16 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 检查会话是否已被清除（清除所有会话后版本号变化）
+		if !IsSessionEpochValid(session.Get("session_epoch")) {
+			c.JSON(http.StatusUnauthorized, AuthResponse{
+				Code:    401,
+				Message: "会话已失效，请重新登录",
+			})
+			c.Abort()
+			return
+		}
+
 		// 获取用户信息
 		userID := session.Get("user_id")
 		userRole := session.Get("user_role")
@@ -44,6 +73,20 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 注册用户每次请求同步数据库中的角色，角色变更/删除账号立即生效
+		if role, ok := userRole.(int); ok && role != models.RoleTourist {
+			user, exists := loadUser(userID)
+			if !exists {
+				c.JSON(http.StatusUnauthorized, AuthResponse{
+					Code:    401,
+					Message: "账号不存在或已被删除",
+				})
+				c.Abort()
+				return
+			}
+			userRole = user.Role
+		}
+
 		// 将用户信息存储到上下文中，供后续处理使用
 		session.Set("logged_in", true)
 
@@ -56,12 +99,29 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminOnlyMiddleware 仅管理员可访问
 func AdminOnlyMiddleware() gin.HandlerFunc {
+	return RoleMiddleware(models.RoleAdmin)
+}
+
+// RoleMiddleware 角色校验中间件，仅允许指定角色访问
+// 若包含管理员角色，API令牌还需拥有 admin 权限范围
+func RoleMiddleware(roles ...int) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 获取用户ID
 		userRole := c.GetInt("user_role")
 
-		if userRole != 1 {
+		allowed := false
+		for _, role := range roles {
+			if userRole == role {
+				allowed = true
+				break
+			}
+		}
+		if allowed && userRole == models.RoleAdmin && !HasScope(c, models.ScopeAdmin) {
+			allowed = false
+		}
+
+		if !allowed {
 			c.JSON(http.StatusForbidden, AuthResponse{
 				Code:    403,
 				Message: "无权访问",
@@ -75,6 +135,102 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 	}
 }
 
+// ScopeMiddleware 权限校验中间件（校验角色权限，API令牌还需拥有对应权限范围）
+func ScopeMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.RoleHasPermission(c.GetInt("user_role"), scope) {
+			c.JSON(http.StatusForbidden, AuthResponse{
+				Code:    403,
+				Message: "当前角色无此权限：" + scope,
+			})
+			c.Abort()
+			return
+		}
+
+		if !HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, AuthResponse{
+				Code:    403,
+				Message: "API令牌缺少权限：" + scope,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasScope 检查当前请求是否拥有指定权限
+func HasScope(c *gin.Context, scope string) bool {
+	tokenInterface, exists := c.Get("api_token")
+	if !exists {
+		return true
+	}
+	token, ok := tokenInterface.(*models.ApiToken)
+	return ok && token.HasScope(scope)
+}
+
+// IsTokenAuth 当前请求是否通过API令牌认证
+func IsTokenAuth(c *gin.Context) bool {
+	_, exists := c.Get("api_token")
+	return exists
+}
+
+// loadUser 根据会话中的用户ID加载用户
+func loadUser(userID any) (*models.User, bool) {
+	id, ok := userID.(int)
+	db := database.GetDB()
+	if !ok || db == nil {
+		return nil, false
+	}
+	var user models.User
+	if err := db.DB.First(&user, id).Error; err != nil {
+		return nil, false
+	}
+	return &user, true
+}
+
+// authenticateToken 校验API令牌并写入用户上下文
+func authenticateToken(c *gin.Context, plain string) bool {
+	db := database.GetDB()
+	if db == nil {
+		return false
+	}
+
+	var token models.ApiToken
+	if err := db.DB.Where("token_hash = ?", apitoken.Hash(plain)).First(&token).Error; err != nil {
+		return false
+	}
+	if token.IsExpired() {
+		return false
+	}
+	return signInWithToken(c, &token)
+}
+
+// signInWithToken 加载令牌所属用户并写入用户上下文
+func signInWithToken(c *gin.Context, token *models.ApiToken) bool {
+	db := database.GetDB()
+	var user models.User
+	if err := db.DB.First(&user, token.UserId).Error; err != nil {
+		return false
+	}
+
+	// 更新最后使用时间（一分钟内不重复写库）
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute || token.LastUsedIP != c.ClientIP() {
+		db.DB.Model(token).UpdateColumns(map[string]any{
+			"last_used_at": now,
+			"last_used_ip": c.ClientIP(),
+		})
+	}
+
+	c.Set("user_id", user.Id)
+	c.Set("user_role", user.Role)
+	c.Set("username", user.Username)
+	c.Set("api_token", token)
+	return true
+}
+
 // OptionalAuthMiddleware 可选认证中间件（不强制要求认证）
 func OptionalAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// DAVAuthMiddleware WebDAV服务端认证中间件
+// 除API的Session和Bearer令牌外，还支持以API令牌作为密码的Basic认证（Finder/资源管理器等客户端只支持Basic）
+func DAVAuthMiddleware() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		if _, password, ok := c.Request.BasicAuth(); ok {
+			if !authenticateToken(c, password) {
+				davChallenge(c)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// 未提供任何凭据时返回认证质询，客户端据此弹出登录框
+		if c.GetHeader("Authorization") == "" && sessions.Default(c).Get("logged_in") != true {
+			davChallenge(c)
+			return
+		}
+
+		auth(c)
+	}
+}
+
+// davChallenge 返回 Basic 认证质询
+func davChallenge(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="OneImg", charset="UTF-8"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
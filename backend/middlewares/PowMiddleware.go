@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"oneimg/backend/models"
+	"oneimg/backend/utils/pow"
+	"oneimg/backend/utils/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PowMiddleware 游客上传前校验工作量证明（请求头 X-Pow-Challenge / X-Pow-Nonce）
+// 注册用户登录时已完成验证，API令牌用于程序调用，均不需要
+func PowMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsTokenAuth(c) || c.GetInt("user_role") != models.RoleTourist {
+			c.Next()
+			return
+		}
+		sysSettings, err := settings.GetSettings()
+		if err != nil || !sysSettings.PowVerify || sysSettings.Turnstile {
+			c.Next()
+			return
+		}
+
+		if err := pow.Verify(c.GetHeader("X-Pow-Challenge"), c.GetHeader("X-Pow-Nonce"), scope, sysSettings.PowDifficulty); err != nil {
+			c.JSON(http.StatusBadRequest, AuthResponse{
+				Code:    400,
+				Message: err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"oneimg/backend/utils/ratelimit"
+	"oneimg/backend/utils/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware 上传限流：按用户/游客/IP的令牌桶限制请求频率和每日上传量
+func RateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if seconds := CheckUploadRateLimit(c); seconds > 0 {
+			c.JSON(http.StatusTooManyRequests, AuthResponse{
+				Code:    429,
+				Message: fmt.Sprintf("上传过于频繁，请 %d 秒后重试", seconds),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CheckUploadRateLimit 检查上传限流，超出限制时设置 Retry-After 并返回需要等待的秒数
+// 未超出时保存本次请求的限流对象，上传完成后按实际大小扣减上传量（S3、WebDAV 写入同样调用）
+func CheckUploadRateLimit(c *gin.Context) int {
+	sysSettings, err := settings.GetSettings()
+	if err != nil || !sysSettings.UploadRateLimit {
+		return 0
+	}
+	rules, err := ratelimit.ParseRules(sysSettings.UploadRateLimits)
+	if err != nil {
+		log.Printf("上传限流规则无效：%v", err)
+		return 0
+	}
+
+	subjects := ratelimit.Subjects(c, rules)
+	if wait := ratelimit.Allow(subjects); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		return seconds
+	}
+	ratelimit.Bind(c, subjects)
+	return 0
+}
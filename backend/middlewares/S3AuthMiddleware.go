@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"io"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/s3api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// S3AuthMiddleware S3兼容接口认证中间件（AWS Signature V4）
+// 访问密钥对随API令牌生成，请求以令牌所属用户的身份和权限范围执行
+func S3AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sig, err := s3api.ParseSignature(c.Request)
+		if err != nil {
+			s3api.WriteError(c, err)
+			return
+		}
+
+		db := database.GetDB()
+		if db == nil {
+			s3api.WriteError(c, s3api.ErrInternalError)
+			return
+		}
+		var token models.ApiToken
+		if err := db.DB.Where("access_key = ? AND access_key <> ''", sig.AccessKeyId).First(&token).Error; err != nil || token.IsExpired() {
+			s3api.WriteError(c, s3api.ErrInvalidAccessKeyId)
+			return
+		}
+
+		if err := sig.Verify(c.Request, token.SecretKey); err != nil {
+			s3api.WriteError(c, err)
+			return
+		}
+
+		body, err := sig.Body(c.Request, token.SecretKey)
+		if err != nil {
+			s3api.WriteError(c, err)
+			return
+		}
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, c.Request.Body}
+
+		if !signInWithToken(c, &token) {
+			s3api.WriteError(c, s3api.ErrInvalidAccessKeyId.WithMessage("令牌所属用户不存在"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,21 +1,61 @@
 package middlewares
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
 	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
 
 	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	gormsessions "github.com/gin-contrib/sessions/gorm"
 	"github.com/gin-contrib/sessions/memstore"
+	redisstore "github.com/gin-contrib/sessions/redis"
 	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"gorm.io/gorm"
+)
+
+const (
+	// Session存储后端类型
+	SessionStoreMemory   = "memory"
+	SessionStoreDatabase = "database"
+	SessionStoreCookie   = "cookie"
+	SessionStoreRedis    = "redis"
+
+	// redisKeyPrefix Redis中Session键前缀
+	redisKeyPrefix = "oneimg_session_"
+	// sessionEpochTTL Session版本号本地缓存时间（多副本下清除会话最多延迟该时间生效）
+	sessionEpochTTL = 5 * time.Second
 )
 
 var SessionStore sessions.Store
 
+// 当前使用的Session后端
+var (
+	sessionBackend string
+	redisPool      *redis.Pool
+)
+
+// Session版本号缓存
+var epochCache struct {
+	sync.Mutex
+	value    int64
+	loadedAt time.Time
+}
+
 // SessionMiddleware 配置session中间件
 func SessionMiddleware(cfg *config.Config) gin.HandlerFunc {
-	// 使用cookie存储session
-	SessionStore = memstore.NewStore(
-		[]byte(cfg.SessionSecret),
-	)
+	store, err := newSessionStore(cfg)
+	if err != nil {
+		log.Fatalf("初始化Session存储失败：%v", err)
+	}
+	SessionStore = store
 
 	// 配置session选项
 	SessionStore.Options(sessions.Options{
@@ -28,3 +68,174 @@ func SessionMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 	return sessions.Sessions("oneimg-session", SessionStore)
 }
+
+// newSessionStore 根据配置创建Session存储
+func newSessionStore(cfg *config.Config) (sessions.Store, error) {
+	secret := []byte(cfg.SessionSecret)
+
+	switch cfg.SessionStore {
+	case "", SessionStoreMemory:
+		sessionBackend = SessionStoreMemory
+		log.Println("Session存储：内存（重启后会话失效）")
+		return memstore.NewStore(secret), nil
+
+	case SessionStoreCookie:
+		// 签名Cookie存储，会话数据保存在客户端
+		sessionBackend = SessionStoreCookie
+		log.Println("Session存储：签名Cookie")
+		return cookie.NewStore(secret), nil
+
+	case SessionStoreDatabase:
+		// 使用现有GORM连接，兼容 SQLite/MySQL/PostgreSQL
+		db := database.GetDB()
+		if db == nil {
+			return nil, fmt.Errorf("数据库未初始化")
+		}
+		sessionBackend = SessionStoreDatabase
+		log.Println("Session存储：数据库")
+		return gormsessions.NewStore(db.DB, true, secret), nil
+
+	case SessionStoreRedis:
+		pool := &redis.Pool{
+			MaxIdle:     10,
+			IdleTimeout: 240 * time.Second,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", cfg.RedisAddr,
+					redis.DialUsername(cfg.RedisUsername),
+					redis.DialPassword(cfg.RedisPassword),
+					redis.DialDatabase(cfg.RedisDB),
+					redis.DialConnectTimeout(5*time.Second),
+				)
+			},
+		}
+
+		// 启动时校验连接
+		conn := pool.Get()
+		_, err := conn.Do("PING")
+		conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("连接Redis失败 [%s]：%v", cfg.RedisAddr, err)
+		}
+
+		store, err := redisstore.NewStoreWithPool(pool, secret)
+		if err != nil {
+			return nil, fmt.Errorf("创建Redis Session存储失败：%v", err)
+		}
+		if err := redisstore.SetKeyPrefix(store, redisKeyPrefix); err != nil {
+			return nil, fmt.Errorf("设置Redis键前缀失败：%v", err)
+		}
+		sessionBackend = SessionStoreRedis
+		redisPool = pool
+		log.Printf("Session存储：Redis (%s)", cfg.RedisAddr)
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("不支持的Session存储类型：%s", cfg.SessionStore)
+	}
+}
+
+// ClearSessionStore 使所有会话失效
+// 所有后端均通过递增Session版本号实现失效（签名Cookie只能依赖此方式），
+// 服务端存储的后端会同时清理已保存的会话数据
+func ClearSessionStore() error {
+	if err := bumpSessionEpoch(); err != nil {
+		return err
+	}
+
+	switch sessionBackend {
+	case SessionStoreDatabase:
+		if err := database.GetDB().DB.Exec("DELETE FROM sessions").Error; err != nil {
+			return fmt.Errorf("清理数据库会话失败：%v", err)
+		}
+	case SessionStoreRedis:
+		if err := clearRedisSessions(); err != nil {
+			return fmt.Errorf("清理Redis会话失败：%v", err)
+		}
+	}
+
+	return nil
+}
+
+// clearRedisSessions 删除Redis中所有带前缀的Session键
+func clearRedisSessions() error {
+	conn, err := redisPool.GetContext(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", redisKeyPrefix+"*", "COUNT", 500))
+		if err != nil {
+			return err
+		}
+		cursor, _ = redis.Int(values[0], nil)
+		keys, _ := redis.Strings(values[1], nil)
+		if len(keys) > 0 {
+			args := redis.Args{}.AddFlat(keys)
+			if _, err := conn.Do("DEL", args...); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// CurrentSessionEpoch 获取当前Session版本号（带短时缓存）
+func CurrentSessionEpoch() int64 {
+	epochCache.Lock()
+	defer epochCache.Unlock()
+
+	if time.Since(epochCache.loadedAt) < sessionEpochTTL {
+		return epochCache.value
+	}
+
+	db := database.GetDB()
+	if db == nil {
+		return epochCache.value
+	}
+	var setting models.Settings
+	if err := db.DB.Select("id", "session_epoch").First(&setting).Error; err == nil {
+		epochCache.value = setting.SessionEpoch
+		epochCache.loadedAt = time.Now()
+	}
+	return epochCache.value
+}
+
+// IsSessionEpochValid 校验会话中保存的版本号是否为当前版本
+func IsSessionEpochValid(value any) bool {
+	var epoch int64
+	switch v := value.(type) {
+	case nil:
+		epoch = 0 // 兼容升级前创建的会话
+	case int64:
+		epoch = v
+	case int:
+		epoch = int64(v)
+	default:
+		return false
+	}
+	return epoch == CurrentSessionEpoch()
+}
+
+// bumpSessionEpoch 递增Session版本号
+func bumpSessionEpoch() error {
+	db := database.GetDB()
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	err := db.DB.Model(&models.Settings{}).Where("1 = 1").
+		UpdateColumn("session_epoch", gorm.Expr("session_epoch + ?", 1)).Error
+	if err != nil {
+		return fmt.Errorf("更新会话版本失败：%v", err)
+	}
+
+	// 立即刷新本地缓存
+	epochCache.Lock()
+	epochCache.loadedAt = time.Time{}
+	epochCache.Unlock()
+	return nil
+}
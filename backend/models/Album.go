@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// 相册模型
+type Album struct {
+	Id           int       `json:"id" gorm:"primaryKey"`
+	UserId       int       `json:"user_id" gorm:"not null;index"`
+	Name         string    `json:"name" gorm:"size:128;not null"`
+	Description  string    `json:"description" gorm:"size:512"`
+	CoverImageId int       `json:"cover_image_id" gorm:"default:0"` // 0 表示使用相册中最新的图片
+	IsPublic     bool      `json:"is_public" gorm:"default:false"`
+	ShareToken   string    `json:"share_token" gorm:"size:64;index"` // 公开分享链接标识，关闭分享时清空
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// 相册与图片的关联（多对多）
+type AlbumImage struct {
+	AlbumId   int       `json:"album_id" gorm:"primaryKey;autoIncrement:false"`
+	ImageId   int       `json:"image_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// API令牌权限范围
+const (
+	ScopeUpload = "upload" // 上传图片
+	ScopeRead   = "read"   // 读取图片/统计信息
+	ScopeDelete = "delete" // 删除图片
+	ScopeAdmin  = "admin"  // 管理员接口
+)
+
+// AllScopes 全部可用的权限范围
+var AllScopes = []string{ScopeUpload, ScopeRead, ScopeDelete, ScopeAdmin}
+
+// ApiToken 个人访问令牌模型（用于脚本/客户端上传，替代Session Cookie）
+type ApiToken struct {
+	Id         int        `gorm:"primaryKey" json:"id"`
+	UserId     int        `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null;default:''" json:"name"`                               // 令牌名称（备注）
+	TokenHash  string     `gorm:"not null;size:64;uniqueIndex" json:"-"`                         // 令牌SHA-256摘要，明文仅在创建时返回一次
+	Prefix     string     `gorm:"not null;size:16;default:''" json:"prefix"`                     // 令牌前缀，便于识别
+	Scopes     string     `gorm:"not null;default:''" json:"scopes"`                             // 权限范围（多个用逗号分隔）
+	AccessKey  string     `gorm:"size:32;not null;default:'';index" json:"access_key,omitempty"` // S3 访问密钥ID（为空表示未启用S3凭据）
+	SecretKey  string     `gorm:"size:512;not null;default:'';serializer:encrypted" json:"-"`    // S3 秘密访问密钥（SigV4 需要原文参与签名，加密存储）
+	ExpiresAt  *time.Time `json:"expires_at"`                                                    // 过期时间（为空表示永不过期）
+	LastUsedAt *time.Time `json:"last_used_at"`                                                  // 最后使用时间
+	LastUsedIP string     `gorm:"column:last_used_ip;default:''" json:"last_used_ip"`            // 最后使用IP
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// GetScopeList 解析权限范围为数组
+func (t *ApiToken) GetScopeList() []string {
+	if strings.TrimSpace(t.Scopes) == "" {
+		return []string{}
+	}
+	scopes := strings.Split(t.Scopes, ",")
+	result := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		trimmed := strings.TrimSpace(s)
+		if trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// HasScope 检查令牌是否拥有指定权限（admin 拥有全部权限）
+func (t *ApiToken) HasScope(scope string) bool {
+	for _, s := range t.GetScopeList() {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired 检查令牌是否已过期
+func (t *ApiToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// 审计操作
+const (
+	AuditAccountChange    = "account.change"     // 修改自己的登录信息
+	AuditSettingsUpdate   = "settings.update"    // 更新系统设置
+	AuditSessionsClear    = "sessions.clear"     // 清除所有会话
+	AuditImageDelete      = "image.delete"       // 删除图片（含存储文件）
+	AuditImageHide        = "image.hide"         // 删除图片记录（隐藏）
+	AuditUserCreate       = "user.create"        // 创建用户
+	AuditUserUpdate       = "user.update"        // 修改用户
+	AuditUserDelete       = "user.delete"        // 删除用户
+	AuditBackupRestore    = "backup.restore"     // 从备份恢复
+	AuditTwoFactorEnable  = "2fa.enable"         // 启用两步验证
+	AuditTwoFactorDisable = "2fa.disable"        // 关闭两步验证
+	AuditTwoFactorReset   = "2fa.reset"          // 管理员重置用户的两步验证
+	AuditTwoFactorEnforce = "2fa.enforce"        // 修改两步验证强制策略
+	AuditRecoveryCodes    = "2fa.recovery_codes" // 重新生成恢复码
+	AuditLoginUnlock      = "login.unlock"       // 解除登录锁定
+	AuditOIDCLink         = "oidc.link"          // 单点登录关联已有的本地用户
+	AuditRateLimitReset   = "ratelimit.reset"    // 清除上传限流计数
+)
+
+// AuditLog 审计日志，记录管理类和破坏性操作的操作者、来源和前后差异
+type AuditLog struct {
+	Id         int       `gorm:"primaryKey" json:"id"`
+	ActorId    int       `gorm:"not null;default:0;index" json:"actor_id"`    // 操作者用户ID
+	ActorName  string    `gorm:"size:191;default:''" json:"actor_name"`       // 操作时的用户名
+	TokenId    int       `gorm:"not null;default:0" json:"token_id"`          // 通过API令牌操作时的令牌ID
+	IP         string    `gorm:"column:ip;size:64;default:''" json:"ip"`      // 客户端IP
+	Action     string    `gorm:"not null;size:32;index" json:"action"`        // 操作类型
+	TargetType string    `gorm:"size:32;default:'';index" json:"target_type"` // 操作对象类型：user/settings/image/session/backup
+	TargetId   string    `gorm:"size:64;default:''" json:"target_id"`         // 操作对象标识
+	Diff       string    `gorm:"type:text" json:"diff"`                       // 变更字段（JSON）：{"字段":{"before":旧值,"after":新值}}，密钥类字段已脱敏
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
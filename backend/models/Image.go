@@ -8,20 +8,26 @@ import (
 
 // 图片模型
 type Image struct {
-	Id           int            `json:"id" gorm:"primaryKey"`
-	Url          string         `json:"url" gorm:"not null"`
-	Thumbnail    string         `json:"thumbnail"`
-	FileName     string         `json:"filename" gorm:"not null"`
-	FileSize     int64          `json:"file_size" gorm:"not null"`
-	MimeType     string         `json:"mimeType"`
-	Width        int            `json:"width"`
-	Height       int            `json:"height"`
-	Storage      string         `json:"storage" gorm:"default:default"`
-	UserId       int            `json:"user_id" gorm:"not null;default:1"`
-	MD5          string         `json:"md5"`
-	UUID         string         `json:"uuid" gorm:"not null;default:'00000000-0000-0000-0000-000000000000'"`
-	CreatedAt    time.Time      `json:"created_at"`
-	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
-	Hidden       bool           `json:"hidden" gorm:"default:false"`
-	ShowInRecent bool           `json:"show_in_recent" gorm:"default:true"`
+	Id               int            `json:"id" gorm:"primaryKey"`
+	Url              string         `json:"url" gorm:"not null"`
+	Thumbnail        string         `json:"thumbnail"`
+	FileName         string         `json:"filename" gorm:"not null"`
+	FileSize         int64          `json:"file_size" gorm:"not null;index"`
+	MimeType         string         `json:"mimeType" gorm:"size:128;index"`
+	Width            int            `json:"width" gorm:"index:idx_images_dimensions"`
+	Height           int            `json:"height" gorm:"index:idx_images_dimensions"`
+	Storage          string         `json:"storage" gorm:"size:64;default:default;index"`
+	StorageProfileId int            `json:"storage_profile_id" gorm:"not null;default:0;index"` // 存储配置方案ID（0表示系统设置中的存储配置）
+	UserId           int            `json:"user_id" gorm:"not null;default:1;index"`
+	MD5              string         `json:"md5"`
+	ContentHash      string         `json:"content_hash" gorm:"size:64;index"` // 原始文件内容的SHA-256，用于去重
+	ProcessKey       string         `json:"process_key" gorm:"size:16"`        // 上传时的处理设置摘要，与内容哈希一起作为去重依据
+	UUID             string         `json:"uuid" gorm:"not null;default:'00000000-0000-0000-0000-000000000000'"`
+	CreatedAt        time.Time      `json:"created_at" gorm:"index"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+	Hidden           bool           `json:"hidden" gorm:"default:false"`
+	Private          bool           `json:"private" gorm:"default:false;index"` // 私有图片仅能通过签名链接访问
+	Processing       bool           `json:"processing" gorm:"default:false"`    // 水印和格式转换由后台任务处理中，完成前不提供访问
+	ShowInRecent     bool           `json:"show_in_recent" gorm:"default:true"`
+	Tags             []string       `json:"tags,omitempty" gorm:"-"` // 图片标签（查询时填充）
 }
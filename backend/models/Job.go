@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 后台任务状态
+const (
+	JobPending   = "pending"   // 等待执行（含等待重试）
+	JobRunning   = "running"   // 执行中
+	JobSucceeded = "succeeded" // 已完成
+	JobFailed    = "failed"    // 重试次数用尽
+)
+
+// 后台任务类型
+const (
+	JobTypeVariant   = "variant"   // 添加水印、转换格式并覆盖写入主图
+	JobTypeThumbnail = "thumbnail" // 生成并写入缩略图
+	JobTypeNotify    = "notify"    // 发送Telegram上传通知
+	JobTypeWebhook   = "webhook"   // 投递Webhook事件
+)
+
+// Job 后台任务（上传后处理、Webhook投递等），持久化在数据库中，进程重启后继续执行
+type Job struct {
+	Id          int        `gorm:"primaryKey" json:"id"`
+	Type        string     `gorm:"not null;size:32;index" json:"type"`                     // 任务类型
+	Status      string     `gorm:"not null;size:16;default:'pending';index" json:"status"` // 任务状态
+	ImageId     int        `gorm:"not null;default:0;index" json:"image_id"`               // 关联图片ID
+	UserId      int        `gorm:"not null;default:0;index" json:"user_id"`                // 创建任务的用户ID
+	Payload     string     `gorm:"type:text" json:"payload,omitempty"`                     // 任务参数（JSON）
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`                     // 已尝试次数
+	MaxAttempts int        `gorm:"not null;default:5" json:"max_attempts"`                 // 最多尝试次数
+	LastError   string     `gorm:"type:text" json:"last_error"`                            // 最近一次错误
+	RunAt       time.Time  `gorm:"index" json:"run_at"`                                    // 最早可执行时间（失败后按退避时间推迟）
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// IsActive 任务是否仍在进行中
+func (j *Job) IsActive() bool {
+	return j.Status == JobPending || j.Status == JobRunning
+}
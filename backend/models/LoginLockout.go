@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// 登录失败计数的维度
+const (
+	LockoutKindIP       = "ip"       // 按客户端IP
+	LockoutKindUsername = "username" // 按登录用户名（含不存在的用户名）
+)
+
+// LoginLockout 登录失败计数与临时锁定状态（持久化，重启后仍然有效）
+type LoginLockout struct {
+	Id            int        `gorm:"primaryKey" json:"id"`
+	Kind          string     `gorm:"not null;size:16;uniqueIndex:idx_login_lockouts_subject,priority:1" json:"kind"`     // 维度：ip/username
+	Subject       string     `gorm:"not null;size:191;uniqueIndex:idx_login_lockouts_subject,priority:2" json:"subject"` // IP或用户名
+	Failures      int        `gorm:"not null;default:0" json:"failures"`                                                 // 连续失败次数
+	LastIP        string     `gorm:"column:last_ip;size:64;default:''" json:"last_ip"`                                   // 最近一次失败的来源IP
+	LastFailureAt time.Time  `gorm:"index" json:"last_failure_at"`                                                       // 最近一次失败时间
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until"`                                                          // 锁定截止时间
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// IsLocked 当前是否处于锁定状态
+func (l *LoginLockout) IsLocked(now time.Time) bool {
+	return l.LockedUntil != nil && l.LockedUntil.After(now)
+}
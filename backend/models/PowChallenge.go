@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// PowChallenge 已使用的工作量证明挑战（用于防止重放，过期后清理）
+type PowChallenge struct {
+	Id        string    `gorm:"primaryKey;size:32" json:"id"` // 挑战ID
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`      // 挑战过期时间
+}
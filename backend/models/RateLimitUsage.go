@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RateLimitUsage 上传限流的每日上传量计数（持久化，重启后仍然有效）
+// 请求频率按分钟恢复，只保存在内存中
+type RateLimitUsage struct {
+	Key               string    `gorm:"column:bucket_key;primaryKey;size:191" json:"key"` // 桶的键，如 user:1、ip:1.2.3.4
+	Rule              string    `gorm:"not null;size:16" json:"rule"`                     // 限流规则名称
+	RequestsPerMinute int       `gorm:"not null;default:0" json:"requests_per_minute"`    // 保存时的规则
+	BytesPerDay       int64     `gorm:"not null;default:0" json:"bytes_per_day"`          // 保存时的规则
+	BytesAvailable    float64   `gorm:"not null;default:0" json:"bytes_available"`        // 剩余上传量（可为负数）
+	RefilledAt        time.Time `gorm:"not null" json:"refilled_at"`                      // 剩余上传量的计算时间，加载后按经过的时间恢复
+	LastUsed          time.Time `gorm:"not null;index" json:"last_used"`                  // 最近一次使用时间
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RecoveryCode 两步验证恢复码（一次性，丢失验证器时代替验证码登录），只保存摘要
+type RecoveryCode struct {
+	Id        int        `gorm:"primaryKey" json:"id"`
+	UserId    int        `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null;size:64;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// S3Object S3兼容接口中的对象键与图片记录的映射
+// 存储桶是虚拟的：只是对象键的命名空间，实际文件按正常上传流程写入图床存储
+type S3Object struct {
+	Id          int       `gorm:"primaryKey" json:"id"`
+	UserId      int       `gorm:"not null;uniqueIndex:idx_s3_objects_key,priority:1" json:"user_id"`
+	Bucket      string    `gorm:"size:63;not null;uniqueIndex:idx_s3_objects_key,priority:2" json:"bucket"`
+	ObjectKey   string    `gorm:"size:512;not null;uniqueIndex:idx_s3_objects_key,priority:3" json:"key"`
+	ImageId     int       `gorm:"not null;index" json:"image_id"`
+	ETag        string    `gorm:"column:etag;size:64;not null;default:''" json:"etag"` // 对象内容的MD5（十六进制，对象按原始内容保存）
+	Size        int64     `gorm:"not null;default:0" json:"size"`                      // 存储后的对象大小（字节，与下载内容一致）
+	ContentType string    `gorm:"size:128;not null;default:''" json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
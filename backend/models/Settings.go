@@ -1,6 +1,7 @@
 package models
 
 import (
+	"slices"
 	"strings"
 )
 
@@ -8,23 +9,24 @@ import (
 // 注意：该表应只有一条记录（ID=1），所有配置项存储在同一条记录中
 type Settings struct {
 	ID                 int    `gorm:"primarykey;column:id" json:"id"`
-	SiteDomain         string `gorm:"column:site_domain;default:''" json:"site_domain"`                   // 网站域名（用于Telegram Webhook等，如 example.com）
-	SiteLogo           string `gorm:"column:site_logo;default:''" json:"site_logo"`                       // 网站Logo URL
-	OriginalImage      bool   `gorm:"column:original_image;default:false" json:"original_image"`          // 是否保存原图（默认保存）
-	SaveWebp           bool   `gorm:"column:save_webp;default:true" json:"save_webp"`                     // 是否保存webp格式（默认保存）
-	WebpQuality        int    `gorm:"column:webp_quality;default:95" json:"webp_quality"`                 // WebP压缩质量（1-100，默认95）
-	Thumbnail          bool   `gorm:"column:thumbnail;default:true" json:"thumbnail"`                     // 是否生成缩略图（默认生成）
-	Tourist            bool   `gorm:"column:tourist;default:false" json:"tourist"`                        // 是否允许游客上传（默认允许）
-	TGNotice           bool   `gorm:"column:tg_notice;default:false" json:"tg_notice"`                    // 是否启用TG通知（默认关闭）
-	TGWebhook          bool   `gorm:"column:tg_webhook;default:false" json:"tg_webhook"`                  // 是否启用TG Webhook上传（默认关闭）
-	PowVerify          bool   `gorm:"column:pow_verify;default:false" json:"pow_verify"`                  // 已废弃，保留兼容
-	Turnstile          bool   `gorm:"column:turnstile;default:false" json:"turnstile"`                    // 是否启用Cloudflare Turnstile验证
-	TurnstileSiteKey   string `gorm:"column:turnstile_site_key;default:''" json:"turnstile_site_key"`     // Turnstile 站点密钥
-	TurnstileSecretKey string `gorm:"column:turnstile_secret_key;default:''" json:"turnstile_secret_key"` // Turnstile 私密密钥
-	TGBotToken         string `gorm:"column:tg_bot_token;default:''" json:"tg_bot_token"`                 // TG机器人Token
-	TGReceivers        string `gorm:"column:tg_receivers;default:''" json:"tg_receivers"`                 // TG接收者（多个用逗号分隔）
-	TGChannelID        string `gorm:"column:tg_channel_id;default:''" json:"tg_channel_id"`             // TG频道ID（用于频道存储）
-	TGNoticeText       string `gorm:"column:tg_notice_text;default:''" json:"tg_notice_text"`             // TG通知文本
+	SiteDomain         string `gorm:"column:site_domain;default:''" json:"site_domain"`                                        // 网站域名（用于Telegram Webhook等，如 example.com）
+	SiteLogo           string `gorm:"column:site_logo;default:''" json:"site_logo"`                                            // 网站Logo URL
+	OriginalImage      bool   `gorm:"column:original_image;default:false" json:"original_image"`                               // 是否保存原图（默认保存）
+	SaveWebp           bool   `gorm:"column:save_webp;default:true" json:"save_webp"`                                          // 是否保存webp格式（默认保存）
+	WebpQuality        int    `gorm:"column:webp_quality;default:95" json:"webp_quality"`                                      // WebP压缩质量（1-100，默认95）
+	Thumbnail          bool   `gorm:"column:thumbnail;default:true" json:"thumbnail"`                                          // 是否生成缩略图（默认生成）
+	Tourist            bool   `gorm:"column:tourist;default:false" json:"tourist"`                                             // 是否允许游客上传（默认允许）
+	TGNotice           bool   `gorm:"column:tg_notice;default:false" json:"tg_notice"`                                         // 是否启用TG通知（默认关闭）
+	TGWebhook          bool   `gorm:"column:tg_webhook;default:false" json:"tg_webhook"`                                       // 是否启用TG Webhook上传（默认关闭）
+	PowVerify          bool   `gorm:"column:pow_verify;default:false" json:"pow_verify"`                                       // 是否启用工作量证明验证（无需外网，与Turnstile二选一）
+	PowDifficulty      int    `gorm:"column:pow_difficulty;default:18" json:"pow_difficulty"`                                  // 工作量证明难度（前导零位数，1-30）
+	Turnstile          bool   `gorm:"column:turnstile;default:false" json:"turnstile"`                                         // 是否启用Cloudflare Turnstile验证
+	TurnstileSiteKey   string `gorm:"column:turnstile_site_key;default:''" json:"turnstile_site_key"`                          // Turnstile 站点密钥
+	TurnstileSecretKey string `gorm:"column:turnstile_secret_key;default:'';serializer:encrypted" json:"turnstile_secret_key"` // Turnstile 私密密钥
+	TGBotToken         string `gorm:"column:tg_bot_token;default:'';serializer:encrypted" json:"tg_bot_token"`                 // TG机器人Token
+	TGReceivers        string `gorm:"column:tg_receivers;default:''" json:"tg_receivers"`                                      // TG接收者（多个用逗号分隔）
+	TGChannelID        string `gorm:"column:tg_channel_id;default:''" json:"tg_channel_id"`                                    // TG频道ID（用于频道存储）
+	TGNoticeText       string `gorm:"column:tg_notice_text;default:''" json:"tg_notice_text"`                                  // TG通知文本
 
 	// 水印设置
 	WatermarkEnable bool    `gorm:"column:watermark_enable;default:false" json:"watermark_enable"`    // 是否启用水印（默认不启用）
@@ -43,34 +45,62 @@ type Settings struct {
 	StoragePath string `gorm:"column:storage_path;default:'./uploads'" json:"storage_path"` // 本地存储路径（默认./uploads）
 	MaxFileSize int64  `gorm:"column:max_file_size;default:10485760" json:"max_file_size"`  // 最大上传大小（默认10MB）
 
+	// 当前生效的存储配置方案ID（0表示使用本表中的存储配置，仅运行时使用不持久化）
+	StorageProfileId int `gorm:"-" json:"-"`
+	// 上传时跳过水印和格式转换，原样写入后交由后台任务处理（仅运行时使用不持久化）
+	DeferProcessing bool `gorm:"-" json:"-"`
+
 	// S3配置（兼容S3协议的对象存储）
 	S3Endpoint  string `gorm:"column:s3_endpoint;default:''" json:"s3_endpoint"`
 	S3AccessKey string `gorm:"column:s3_access_key;default:''" json:"s3_access_key"`
-	S3SecretKey string `gorm:"column:s3_secret_key;default:''" json:"s3_secret_key"`
+	S3SecretKey string `gorm:"column:s3_secret_key;default:'';serializer:encrypted" json:"s3_secret_key"`
 	S3Bucket    string `gorm:"column:s3_bucket;default:''" json:"s3_bucket"`
 	S3CustomURL string `gorm:"column:s3_custom_url;default:''" json:"s3_custom_url"` // 自定义访问URL（可选）
 
 	// R2配置
 	R2Endpoint  string `gorm:"column:r2_endpoint;default:''" json:"r2_endpoint"`
 	R2AccessKey string `gorm:"column:r2_access_key;default:''" json:"r2_access_key"`
-	R2SecretKey string `gorm:"column:r2_secret_key;default:''" json:"r2_secret_key"`
+	R2SecretKey string `gorm:"column:r2_secret_key;default:'';serializer:encrypted" json:"r2_secret_key"`
 	R2Bucket    string `gorm:"column:r2_bucket;default:''" json:"r2_bucket"`
 	R2CustomURL string `gorm:"column:r2_custom_url;default:''" json:"r2_custom_url"` // 自定义访问URL（可选）
 
 	// WebDAV配置
 	WebdavURL  string `gorm:"column:webdav_url;default:''" json:"webdav_url"`
 	WebdavUser string `gorm:"column:webdav_user;default:''" json:"webdav_user"`
-	WebdavPass string `gorm:"column:webdav_pass;default:''" json:"webdav_pass"`
+	WebdavPass string `gorm:"column:webdav_pass;default:'';serializer:encrypted" json:"webdav_pass"`
 
 	// FTP配置
 	FTPHost string `gorm:"column:ftp_host;default:''" json:"ftp_host"`
 	FTPUser string `gorm:"column:ftp_user;default:''" json:"ftp_user"`
-	FTPPass string `gorm:"column:ftp_pass;default:''" json:"ftp_pass"`
+	FTPPass string `gorm:"column:ftp_pass;default:'';serializer:encrypted" json:"ftp_pass"`
 	FTPPort int    `gorm:"column:ftp_port;default:21" json:"ftp_port"`
 	// Custom API配置
-	CustomApiUrl    string `gorm:"column:custom_api_url;default:''" json:"custom_api_url"`         // 自定义API地址
-	CustomApiKey    string `gorm:"column:custom_api_key;default:''" json:"custom_api_key"`         // 自定义API Key
-	CustomApiDelUrl string `gorm:"column:custom_api_del_url;default:''" json:"custom_api_del_url"` // 自定义API删除URL模板
+	CustomApiUrl    string `gorm:"column:custom_api_url;default:''" json:"custom_api_url"`                      // 自定义API地址
+	CustomApiKey    string `gorm:"column:custom_api_key;default:'';serializer:encrypted" json:"custom_api_key"` // 自定义API Key
+	CustomApiDelUrl string `gorm:"column:custom_api_del_url;default:''" json:"custom_api_del_url"`              // 自定义API删除URL模板
+
+	// OpenID Connect 单点登录（授权码 + PKCE）
+	OIDCEnabled       bool   `gorm:"column:oidc_enabled;default:false" json:"oidc_enabled"`                               // 是否启用
+	OIDCIssuer        string `gorm:"column:oidc_issuer;default:''" json:"oidc_issuer"`                                    // 身份提供方地址（Issuer）
+	OIDCClientID      string `gorm:"column:oidc_client_id;default:''" json:"oidc_client_id"`                              // 客户端ID
+	OIDCClientSecret  string `gorm:"column:oidc_client_secret;default:'';serializer:encrypted" json:"oidc_client_secret"` // 客户端密钥（公共客户端留空）
+	OIDCScopes        string `gorm:"column:oidc_scopes;default:'openid profile email'" json:"oidc_scopes"`                // 请求的scope（空格分隔）
+	OIDCUsernameClaim string `gorm:"column:oidc_username_claim;default:'preferred_username'" json:"oidc_username_claim"`  // 作为用户名的声明
+	OIDCRoleClaim     string `gorm:"column:oidc_role_claim;default:''" json:"oidc_role_claim"`                            // 角色声明（如 groups、realm_access.roles，留空不同步角色）
+	OIDCRoleMapping   string `gorm:"column:oidc_role_mapping;default:''" json:"oidc_role_mapping"`                        // 角色映射（如 oneimg-admins=admin,designers=editor）
+	OIDCDefaultRole   int    `gorm:"column:oidc_default_role;default:4" json:"oidc_default_role"`                         // 未匹配角色映射时的角色（0表示拒绝登录）
+	OIDCAutoCreate    bool   `gorm:"column:oidc_auto_create;default:true" json:"oidc_auto_create"`                        // 首次登录时自动创建用户
+	OIDCLinkExisting  bool   `gorm:"column:oidc_link_existing;default:false" json:"oidc_link_existing"`                   // 首次登录时按已验证的邮箱关联已有的本地用户
+
+	// 上传限流（规则格式见 ratelimit.ParseRules）
+	UploadRateLimit  bool   `gorm:"column:upload_rate_limit;default:true" json:"upload_rate_limit"`                             // 是否启用上传限流
+	UploadRateLimits string `gorm:"column:upload_rate_limits;default:'tourist=10/100MB,ip=30/500MB'" json:"upload_rate_limits"` // 各角色每分钟请求数/每日上传量
+
+	// 要求所有注册用户启用两步验证（通过 /api/admin/2fa/enforce 修改）
+	TwoFactorRequired bool `gorm:"column:two_factor_required;not null;default:false" json:"two_factor_required"`
+
+	// Session版本号（清除所有会话时递增，内部使用不对外暴露）
+	SessionEpoch int64 `gorm:"column:session_epoch;not null;default:0" json:"-"`
 }
 
 // TableName 指定表名（避免GORM自动复数）
@@ -125,3 +155,20 @@ func (s *Settings) IsValidStorageConfig() bool {
 		return false
 	}
 }
+
+// SecretSettingKeys 密钥/密码类设置项（JSON字段名）：数据库中加密存储，接口只写不读，不随事件发送，审计日志中脱敏
+var SecretSettingKeys = []string{
+	"turnstile_secret_key",
+	"tg_bot_token",
+	"s3_secret_key",
+	"r2_secret_key",
+	"webdav_pass",
+	"ftp_pass",
+	"custom_api_key",
+	"oidc_client_secret",
+}
+
+// IsSecretSettingKey 是否为密钥/密码类设置项
+func IsSecretSettingKey(key string) bool {
+	return slices.Contains(SecretSettingKeys, key)
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// 存储迁移任务状态
+const (
+	MigrationPending   = "pending"   // 等待执行
+	MigrationRunning   = "running"   // 执行中
+	MigrationCompleted = "completed" // 已完成
+	MigrationFailed    = "failed"    // 执行出错中断
+	MigrationCancelled = "cancelled" // 已取消
+)
+
+// StorageMigration 存储迁移任务（将已有图片从一个存储复制到另一个存储）
+type StorageMigration struct {
+	Id              int        `gorm:"primaryKey" json:"id"`
+	Source          string     `gorm:"not null;size:64" json:"source"`                         // 来源存储
+	Target          string     `gorm:"not null;size:64" json:"target"`                         // 目标存储
+	SourceProfileId int        `gorm:"not null;default:0" json:"source_profile_id"`            // 来源存储配置方案ID（0表示系统设置）
+	TargetProfileId int        `gorm:"not null;default:0" json:"target_profile_id"`            // 目标存储配置方案ID（0表示系统设置）
+	Status          string     `gorm:"not null;size:16;default:'pending';index" json:"status"` // 任务状态
+	Total           int64      `gorm:"not null;default:0" json:"total"`                        // 待迁移图片总数
+	Migrated        int64      `gorm:"not null;default:0" json:"migrated"`                     // 已迁移数量
+	Failed          int64      `gorm:"not null;default:0" json:"failed"`                       // 失败数量
+	LastImageId     int        `gorm:"not null;default:0" json:"last_image_id"`                // 已处理到的图片ID，用于断点续传
+	LastError       string     `gorm:"type:text" json:"last_error"`                            // 最近一次错误
+	CreatedBy       int        `gorm:"not null;default:0" json:"created_by"`                   // 创建者用户ID
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+}
+
+// IsActive 任务是否仍在进行中
+func (m *StorageMigration) IsActive() bool {
+	return m.Status == MigrationPending || m.Status == MigrationRunning
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StorageProfileTypes 存储配置方案支持的存储类型
+var StorageProfileTypes = []string{"s3", "r2", "webdav", "ftp", "custom"}
+
+// StorageProfile 命名存储配置方案
+// 允许同时配置多套存储（如多个S3存储桶），图片通过 StorageProfileId 记录所属方案，
+// 切换系统默认存储后旧图片仍按原方案读取和删除
+type StorageProfile struct {
+	Id          int       `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null;size:64;uniqueIndex" json:"name"`          // 方案名称
+	Type        string    `gorm:"not null;size:16" json:"type"`                      // 存储类型：s3/r2/webdav/ftp/custom
+	Endpoint    string    `gorm:"default:''" json:"endpoint"`                        // S3/R2 Endpoint、WebDAV地址、FTP主机或自定义API地址
+	Bucket      string    `gorm:"default:''" json:"bucket"`                          // S3/R2 存储桶
+	AccessKey   string    `gorm:"default:''" json:"access_key"`                      // S3/R2 AccessKey
+	SecretKey   string    `gorm:"default:'';serializer:encrypted" json:"secret_key"` // S3/R2 SecretKey（加密存储）
+	CustomURL   string    `gorm:"default:''" json:"custom_url"`                      // S3/R2 自定义访问URL（可选）
+	Username    string    `gorm:"default:''" json:"username"`                        // WebDAV/FTP 用户名
+	Password    string    `gorm:"default:'';serializer:encrypted" json:"password"`   // WebDAV/FTP 密码（加密存储）
+	Port        int       `gorm:"default:21" json:"port"`                            // FTP 端口
+	ApiKey      string    `gorm:"default:'';serializer:encrypted" json:"api_key"`    // 自定义API Key（加密存储）
+	DeleteURL   string    `gorm:"default:''" json:"delete_url"`                      // 自定义API删除URL模板
+	UploadRoles string    `gorm:"size:32;default:''" json:"upload_roles"`            // 上传时可选择该方案的角色ID，逗号分隔（管理员始终可用）
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// IsValidStorageProfileType 检查存储类型是否可用于配置方案
+func IsValidStorageProfileType(storageType string) bool {
+	for _, t := range StorageProfileTypes {
+		if t == storageType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsUploadRole 该角色上传时是否可以选择此方案
+func (p *StorageProfile) AllowsUploadRole(role int) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	return slices.Contains(strings.Split(p.UploadRoles, ","), strconv.Itoa(role))
+}
+
+// Apply 将方案中的存储配置覆盖到系统设置副本上
+func (p *StorageProfile) Apply(setting Settings) Settings {
+	setting.StorageType = p.Type
+	setting.StorageProfileId = p.Id
+
+	switch p.Type {
+	case "s3":
+		setting.S3Endpoint = p.Endpoint
+		setting.S3Bucket = p.Bucket
+		setting.S3AccessKey = p.AccessKey
+		setting.S3SecretKey = p.SecretKey
+		setting.S3CustomURL = p.CustomURL
+	case "r2":
+		setting.R2Endpoint = p.Endpoint
+		setting.R2Bucket = p.Bucket
+		setting.R2AccessKey = p.AccessKey
+		setting.R2SecretKey = p.SecretKey
+		setting.R2CustomURL = p.CustomURL
+	case "webdav":
+		setting.WebdavURL = p.Endpoint
+		setting.WebdavUser = p.Username
+		setting.WebdavPass = p.Password
+	case "ftp":
+		setting.FTPHost = p.Endpoint
+		setting.FTPPort = p.Port
+		setting.FTPUser = p.Username
+		setting.FTPPass = p.Password
+	case "custom":
+		setting.CustomApiUrl = p.Endpoint
+		setting.CustomApiKey = p.ApiKey
+		setting.CustomApiDelUrl = p.DeleteURL
+	}
+	return setting
+}
+
+// IsValid 检查方案配置是否完整
+func (p *StorageProfile) IsValid() bool {
+	if p.Type == "ftp" {
+		return strings.TrimSpace(p.Endpoint) != ""
+	}
+	setting := p.Apply(Settings{})
+	return setting.IsValidStorageConfig()
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxTagLength 标签最大长度（字符数）
+const MaxTagLength = 64
+
+// 标签模型
+type Tag struct {
+	Id        int       `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:191;not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 图片与标签的关联（多对多）
+type ImageTag struct {
+	ImageId int `json:"image_id" gorm:"primaryKey;autoIncrement:false"`
+	TagId   int `json:"tag_id" gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+// NormalizeTagName 规范化标签名（去除首尾空白、合并空白、转小写），无效时返回空字符串
+func NormalizeTagName(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if utf8.RuneCountInString(name) > MaxTagLength {
+		return ""
+	}
+	return name
+}
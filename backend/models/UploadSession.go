@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// 分片上传会话状态
+const (
+	UploadSessionUploading  = "uploading"  // 接收分片中
+	UploadSessionCompleting = "completing" // 正在合并并写入存储
+)
+
+// UploadSession 分片（可断点续传）上传会话，分片暂存在本地磁盘，过期后自动清理
+type UploadSession struct {
+	Id               string    `gorm:"primaryKey;size:64" json:"id"`
+	UserId           int       `gorm:"not null;index" json:"user_id"`
+	UUID             string    `gorm:"size:64;not null;default:''" json:"-"` // 游客标识，游客只能操作自己的会话
+	FileName         string    `gorm:"not null;default:''" json:"filename"`
+	FileSize         int64     `gorm:"not null" json:"file_size"`                    // 文件总大小（字节）
+	ChunkSize        int64     `gorm:"not null" json:"chunk_size"`                   // 分片大小（字节），最后一片可以更小
+	TotalChunks      int       `gorm:"not null" json:"total_chunks"`                 // 分片总数
+	StorageProfileId int       `gorm:"not null;default:0" json:"storage_profile_id"` // 存储配置方案ID（0表示系统默认存储）
+	Hidden           bool      `gorm:"default:false" json:"hidden"`
+	Status           string    `gorm:"size:16;not null;default:uploading" json:"status"`
+	ExpiresAt        time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ChunkLength 指定分片的期望大小
+func (s *UploadSession) ChunkLength(index int) int64 {
+	if index == s.TotalChunks-1 {
+		return s.FileSize - int64(index)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
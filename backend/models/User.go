@@ -1,11 +1,66 @@
 package models
 
+// 用户角色
+const (
+	RoleAdmin    = 1 // 管理员：全部权限
+	RoleTourist  = 2 // 游客：基于指纹的临时身份，只能管理自己的图片
+	RoleEditor   = 3 // 编辑：可上传，并管理所有用户的图片
+	RoleUploader = 4 // 上传者：可上传并管理自己的图片
+	RoleViewer   = 5 // 访客：只读
+)
+
+// rolePermissions 各角色拥有的权限（与API令牌权限范围共用同一套标识）
+var rolePermissions = map[int][]string{
+	RoleAdmin:    {ScopeUpload, ScopeRead, ScopeDelete, ScopeAdmin},
+	RoleTourist:  {ScopeUpload, ScopeRead, ScopeDelete},
+	RoleEditor:   {ScopeUpload, ScopeRead, ScopeDelete},
+	RoleUploader: {ScopeUpload, ScopeRead, ScopeDelete},
+	RoleViewer:   {ScopeRead},
+}
+
 // 用户模型
 type User struct {
 	Id       int    `gorm:"primarykey;column:id" json:"id"`
-	Role     int    `gorm:"default:1;uniqueIndex:unique_idx" json:"role"`
-	Username string `json:"username"`
+	Role     int    `gorm:"default:1;index" json:"role"`
+	Username string `gorm:"size:191;uniqueIndex:idx_users_username" json:"username"`
 	Password string `json:"password"`
 	Nickname string `gorm:"column:nickname;default:''" json:"nickname"` // 昵称
 	Avatar   string `gorm:"column:avatar;default:''" json:"avatar"`     // 头像URL
+
+	// 配额设置（0表示不限制/使用全局配置）
+	StorageQuota int64 `gorm:"column:storage_quota;not null;default:0" json:"storage_quota"` // 存储配额（字节）
+	MaxFileSize  int64 `gorm:"column:max_file_size;not null;default:0" json:"max_file_size"` // 单文件大小上限（字节），覆盖全局配置
+
+	// 两步验证（TOTP）
+	TOTPEnabled  bool   `gorm:"column:totp_enabled;not null;default:false" json:"totp_enabled"` // 是否已启用
+	TOTPSecret   string `gorm:"column:totp_secret;default:'';serializer:encrypted" json:"-"`    // TOTP密钥（按设置密钥同样方式加密存储）
+	TOTPLastStep int64  `gorm:"column:totp_last_step;not null;default:0" json:"-"`              // 最近一次使用的时间步，防止验证码重放
+
+	// OpenID Connect 单点登录关联的外部身份（issuer + sub 唯一确定一个用户）
+	OIDCIssuer  string `gorm:"column:oidc_issuer;size:191;default:'';index:idx_users_oidc,priority:1" json:"-"`
+	OIDCSubject string `gorm:"column:oidc_subject;size:191;default:'';index:idx_users_oidc,priority:2" json:"-"`
+
+	// 邮箱（小写，由管理员设置），开启关联时身份提供方已验证的相同邮箱可关联到该用户
+	Email string `gorm:"column:email;size:191;default:'';index" json:"email"`
+}
+
+// IsValidRole 检查角色是否合法
+func IsValidRole(role int) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHasPermission 检查角色是否拥有指定权限
+func RoleHasPermission(role int, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManageAllImages 是否可以管理所有用户的图片
+func CanManageAllImages(role int) bool {
+	return role == RoleAdmin || role == RoleEditor
 }
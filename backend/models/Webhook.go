@@ -0,0 +1,61 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook 事件类型
+const (
+	EventImageUploaded   = "image.uploaded"
+	EventImageDeleted    = "image.deleted"
+	EventImageHidden     = "image.hidden"
+	EventSettingsUpdated = "settings.updated"
+	EventPing            = "ping" // 测试投递
+)
+
+// WebhookEvents 可订阅的事件
+var WebhookEvents = []string{EventImageUploaded, EventImageDeleted, EventImageHidden, EventSettingsUpdated}
+
+// Webhook 管理员配置的事件回调地址
+type Webhook struct {
+	Id        int       `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null;size:64" json:"name"`
+	Url       string    `gorm:"not null;size:1024" json:"url"`
+	Secret    string    `gorm:"not null;size:512;serializer:encrypted" json:"-"` // HMAC签名密钥（加密存储），只在创建/重置时返回
+	Events    string    `gorm:"not null;size:255" json:"events"`                 // 订阅的事件，逗号分隔
+	Enabled   bool      `gorm:"not null" json:"enabled"`                         // 是否启用
+	CreatedBy int       `gorm:"not null;default:0" json:"created_by"`            // 创建者用户ID
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EventList 订阅的事件列表
+func (w *Webhook) EventList() []string {
+	if w.Events == "" {
+		return nil
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Subscribes 是否订阅了指定事件
+func (w *Webhook) Subscribes(event string) bool {
+	return slices.Contains(w.EventList(), event)
+}
+
+// WebhookDelivery 每次投递尝试的记录
+type WebhookDelivery struct {
+	Id         int       `gorm:"primaryKey" json:"id"`
+	WebhookId  int       `gorm:"not null;index" json:"webhook_id"`
+	JobId      int       `gorm:"not null;default:0;index" json:"job_id"` // 对应的后台任务ID
+	EventId    string    `gorm:"not null;size:64;index" json:"event_id"` // 事件ID，同一事件的重试相同
+	Event      string    `gorm:"not null;size:64" json:"event"`
+	Attempt    int       `gorm:"not null;default:0" json:"attempt"`     // 第几次尝试
+	StatusCode int       `gorm:"not null;default:0" json:"status_code"` // 响应状态码，0表示请求未完成
+	Success    bool      `gorm:"not null" json:"success"`
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+	Response   string    `gorm:"type:text" json:"response,omitempty"` // 响应内容（截断）
+	DurationMs int64     `gorm:"not null;default:0" json:"duration_ms"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
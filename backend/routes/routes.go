@@ -10,6 +10,8 @@ import (
 	"oneimg/backend/config"
 	"oneimg/backend/controllers"
 	"oneimg/backend/middlewares"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/pow"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -22,6 +24,11 @@ func SetupRoutes(frontendFS embed.FS) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 
+	// 客户端IP只信任已配置的反向代理转发的请求头
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		panic("TRUSTED_PROXIES 配置无效：" + err.Error())
+	}
+
 	// 基础中间件
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
@@ -47,21 +54,59 @@ func SetupRoutes(frontendFS embed.FS) *gin.Engine {
 
 	// 静态资源
 	r.GET("/uploads/*path", controllers.ImageProxy)
+	r.GET("/share/albums/:token", controllers.AlbumSharePage)
 	r.StaticFile("/favicon.ico", "./frontend/dist/favicon.ico")
 
+	// S3兼容接口（路径风格，AWS Signature V4 认证）
+	s3 := r.Group("/s3", middlewares.S3AuthMiddleware())
+	{
+		s3.GET("", controllers.S3ListBuckets)
+		s3.GET("/", controllers.S3ListBuckets)
+		s3.PUT("/:bucket", controllers.S3CreateBucket)
+		s3.HEAD("/:bucket", controllers.S3HeadBucket)
+		s3.GET("/:bucket", controllers.S3ListObjects)
+		s3.POST("/:bucket", controllers.S3DeleteObjects)
+		s3.DELETE("/:bucket", controllers.S3DeleteBucket)
+		s3.PUT("/:bucket/*key", controllers.S3PutObject)
+		s3.GET("/:bucket/*key", controllers.S3GetObject)
+		s3.HEAD("/:bucket/*key", controllers.S3HeadObject)
+		s3.DELETE("/:bucket/*key", controllers.S3DeleteObject)
+		s3.POST("/:bucket/*key", controllers.S3PostObject)
+	}
+
+	// WebDAV服务端（将图库挂载为网络驱动器）
+	if cfg.WebDAVServerEnabled {
+		dav := r.Group(cfg.WebDAVServerPath, middlewares.DAVAuthMiddleware())
+		for _, method := range controllers.WebDAVMethods {
+			dav.Handle(method, "", controllers.WebDAVServer)
+			dav.Handle(method, "/*path", controllers.WebDAVServer)
+		}
+	}
+
 	// API路由分组
 	api := r.Group("/api")
 	{
 		// 公开接口（无需认证）
 		api.POST("/login", controllers.Login)
+		// 登录第二步（两步验证），此时会话尚未登录
+		api.POST("/login/2fa", controllers.LoginTwoFactor)
+		api.POST("/login/2fa/setup", controllers.LoginTwoFactorSetup)
+		api.POST("/login/2fa/enable", controllers.LoginTwoFactorEnable)
+		// OpenID Connect 单点登录（跳转到身份提供方及回调）
+		api.GET("/login/oidc", controllers.OIDCLogin)
+		api.GET("/login/oidc/callback", controllers.OIDCCallback)
 		api.POST("/logout", controllers.Logout)
 		api.GET("/logout", controllers.Logout)
 		// 返回登录设置
 		api.GET("/settings/login", controllers.GetLoginSettings)
+		// 工作量证明挑战（登录及游客上传）
+		api.GET("/pow/challenge", controllers.GetPowChallenge)
 		// 健康检查
 		api.Match([]string{"GET", "HEAD"}, "/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok", "time": time.Now().Unix()})
 		})
+		// 公开相册分享
+		api.GET("/share/albums/:token", controllers.GetSharedAlbum)
 		// Telegram Bot Webhook（公开端点，无需认证）
 		api.POST("/telegram/webhook", controllers.TelegramWebhook)
 
@@ -69,38 +114,143 @@ func SetupRoutes(frontendFS embed.FS) *gin.Engine {
 		auth := api.Group("")
 		auth.Use(middlewares.AuthMiddleware())
 		{
+			// API令牌权限范围
+			scopeRead := middlewares.ScopeMiddleware(models.ScopeRead)
+			scopeUpload := middlewares.ScopeMiddleware(models.ScopeUpload)
+			scopeDelete := middlewares.ScopeMiddleware(models.ScopeDelete)
+			// 游客上传的工作量证明（分片上传只在创建会话时校验）
+			powUpload := middlewares.PowMiddleware(pow.ScopeUpload)
+			// 上传限流（分片上传在创建会话和完成合并时计数）
+			rateLimit := middlewares.RateLimitMiddleware()
+
 			// 用户信息接口
-			auth.GET("/user/status", controllers.CheckLoginStatus)
-			auth.GET("/user/profile", controllers.GetUserProfile)
-			auth.PUT("/user/profile", controllers.UpdateUserProfile)
+			auth.GET("/user/status", scopeRead, controllers.CheckLoginStatus)
+			auth.GET("/user/profile", scopeRead, controllers.GetUserProfile)
+			auth.PUT("/user/profile", scopeUpload, controllers.UpdateUserProfile)
+
+			// API令牌管理（仅支持Session登录）
+			auth.GET("/tokens", controllers.ListApiTokens)
+			auth.POST("/tokens", controllers.CreateApiToken)
+			auth.DELETE("/tokens/:id", controllers.RevokeApiToken)
 
 			// 统计数据
-			auth.GET("/stats/dashboard", controllers.GetDashboardStats)
-			auth.GET("/stats/images", controllers.GetImageStats)
+			auth.GET("/stats/dashboard", scopeRead, controllers.GetDashboardStats)
+			auth.GET("/stats/images", scopeRead, controllers.GetImageStats)
 
 			// 图片相关接口
-			auth.POST("/upload", controllers.UploadImage)
-			auth.POST("/upload/images", controllers.UploadImages)
-			auth.POST("/upload/url", controllers.UploadImageByURL)
-			auth.DELETE("/images/:id", controllers.DeleteImage)
-			auth.DELETE("/images/:id/record", controllers.DeleteImageRecord) // Old endpoint for deletion
-			auth.DELETE("/images/:id/recent", controllers.DismissImage)      // New endpoint for dismissing from recent
-			auth.GET("/images", controllers.GetImageList)
-			auth.GET("/images/:id", controllers.GetImageDetail)
+			auth.POST("/upload", scopeUpload, rateLimit, powUpload, controllers.UploadImage)
+			auth.POST("/upload/images", scopeUpload, rateLimit, powUpload, controllers.UploadImages)
+			auth.POST("/upload/url", scopeUpload, rateLimit, powUpload, controllers.UploadImageByURL)
+			auth.POST("/upload/chunks", scopeUpload, rateLimit, powUpload, controllers.InitChunkUpload)
+			auth.GET("/upload/chunks/:id", scopeUpload, controllers.GetChunkUpload)
+			auth.PUT("/upload/chunks/:id/parts/:index", scopeUpload, controllers.UploadChunk)
+			auth.POST("/upload/chunks/:id/complete", scopeUpload, rateLimit, controllers.CompleteChunkUpload)
+			auth.DELETE("/upload/chunks/:id", scopeUpload, controllers.AbortChunkUpload)
+			auth.GET("/storage/profiles", scopeUpload, controllers.ListStorageProfileOptions)
+			auth.DELETE("/images/:id", scopeDelete, controllers.DeleteImage)
+			auth.DELETE("/images/:id/record", scopeDelete, controllers.DeleteImageRecord) // Old endpoint for deletion
+			auth.DELETE("/images/:id/recent", scopeUpload, controllers.DismissImage)      // New endpoint for dismissing from recent
+			auth.GET("/images", scopeRead, controllers.GetImageList)
+			auth.GET("/images/:id", scopeRead, controllers.GetImageDetail)
+			auth.POST("/images/:id/signed-url", scopeRead, controllers.CreateSignedURL)
+			auth.PUT("/images/:id/private", scopeUpload, controllers.SetImagePrivate)
+
+			// 标签
+			auth.GET("/tags", scopeRead, controllers.ListTags)
+			auth.POST("/images/tags", scopeUpload, controllers.TagImages)
+			auth.DELETE("/images/tags", scopeUpload, controllers.UntagImages)
+
+			// 相册
+			auth.GET("/albums", scopeRead, controllers.ListAlbums)
+			auth.POST("/albums", scopeUpload, controllers.CreateAlbum)
+			auth.GET("/albums/:id", scopeRead, controllers.GetAlbum)
+			auth.PUT("/albums/:id", scopeUpload, controllers.UpdateAlbum)
+			auth.DELETE("/albums/:id", scopeDelete, controllers.DeleteAlbum)
+			auth.POST("/albums/:id/images", scopeUpload, controllers.AddAlbumImages)
+			auth.DELETE("/albums/:id/images", scopeUpload, controllers.RemoveAlbumImages)
+			auth.POST("/albums/:id/images/move", scopeUpload, controllers.MoveAlbumImages)
+			auth.POST("/albums/:id/images/copy", scopeUpload, controllers.CopyAlbumImages)
+
+			// 后台任务（上传后处理）状态
+			auth.GET("/jobs", scopeRead, controllers.ListJobs)
+			auth.GET("/jobs/:id", scopeRead, controllers.GetJob)
+
+			// 修改自己的登录信息（注册用户均可）
+			auth.POST("/account/change", controllers.ChangeAccountInfo)
+
+			// 两步验证（仅支持Session登录）
+			auth.GET("/account/2fa", controllers.GetTwoFactorStatus)
+			auth.POST("/account/2fa/setup", controllers.SetupTwoFactor)
+			auth.POST("/account/2fa/enable", controllers.EnableTwoFactor)
+			auth.POST("/account/2fa/disable", controllers.DisableTwoFactor)
+			auth.POST("/account/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
 
 			// 需要管理员权限
 			auth.Use(middlewares.AdminOnlyMiddleware())
 			{
 				// 账户管理接口
-				auth.POST("/account/change", controllers.ChangeAccountInfo)
 				auth.POST("/sessions/clear", controllers.ClearAllSessions)
 
+				// 用户管理接口
+				auth.GET("/admin/users", controllers.ListUsers)
+				auth.POST("/admin/users", controllers.CreateUser)
+				auth.PUT("/admin/users/:id", controllers.UpdateUser)
+				auth.DELETE("/admin/users/:id", controllers.DeleteUser)
+				auth.DELETE("/admin/users/:id/2fa", controllers.ResetUserTwoFactor)
+				auth.PUT("/admin/2fa/enforce", controllers.EnforceTwoFactor)
+
 				// 系统设置接口
 				auth.Any("/settings/get", controllers.GetSettings)
 				auth.POST("/settings/update", controllers.UpdateSettings)
 
 				// 数据库状态接口
 				auth.GET("/database/status", controllers.GetDatabaseStatus)
+
+				// API令牌管理
+				auth.GET("/admin/tokens", controllers.AdminListApiTokens)
+				auth.POST("/admin/tokens", controllers.AdminCreateApiToken)
+				auth.DELETE("/admin/tokens/:id", controllers.AdminRevokeApiToken)
+
+				// 存储配置方案
+				auth.GET("/admin/storage/profiles", controllers.ListStorageProfiles)
+				auth.POST("/admin/storage/profiles", controllers.CreateStorageProfile)
+				auth.PUT("/admin/storage/profiles/:id", controllers.UpdateStorageProfile)
+				auth.DELETE("/admin/storage/profiles/:id", controllers.DeleteStorageProfile)
+
+				// 存储迁移任务
+				auth.GET("/admin/migrations", controllers.ListStorageMigrations)
+				auth.POST("/admin/migrations", controllers.StartStorageMigration)
+				auth.GET("/admin/migrations/:id", controllers.GetStorageMigration)
+				auth.POST("/admin/migrations/:id/resume", controllers.ResumeStorageMigration)
+				auth.POST("/admin/migrations/:id/cancel", controllers.CancelStorageMigration)
+
+				// 后台任务重试
+				auth.POST("/admin/jobs/:id/retry", controllers.RetryJob)
+
+				// Webhook
+				auth.GET("/admin/webhooks", controllers.ListWebhooks)
+				auth.POST("/admin/webhooks", controllers.CreateWebhook)
+				auth.PUT("/admin/webhooks/:id", controllers.UpdateWebhook)
+				auth.DELETE("/admin/webhooks/:id", controllers.DeleteWebhook)
+				auth.POST("/admin/webhooks/:id/test", controllers.TestWebhook)
+				auth.GET("/admin/webhooks/:id/deliveries", controllers.ListWebhookDeliveries)
+
+				// 备份与恢复
+				auth.GET("/admin/backup", controllers.ExportBackup)
+				auth.POST("/admin/backup/restore", controllers.RestoreBackup)
+
+				// 审计日志
+				auth.GET("/admin/audit-logs", controllers.ListAuditLogs)
+				auth.GET("/admin/audit-logs/export", controllers.ExportAuditLogs)
+
+				// 登录失败锁定
+				auth.GET("/admin/login-lockouts", controllers.ListLoginLockouts)
+				auth.DELETE("/admin/login-lockouts", controllers.ClearLoginLockouts)
+				auth.DELETE("/admin/login-lockouts/:id", controllers.DeleteLoginLockout)
+
+				// 上传限流计数
+				auth.GET("/admin/rate-limits", controllers.ListRateLimits)
+				auth.DELETE("/admin/rate-limits", controllers.ResetRateLimits)
 			}
 		}
 	}
@@ -0,0 +1,92 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"oneimg/backend/models"
+)
+
+// TokenPrefix 令牌统一前缀，便于在日志/代码仓库中识别泄露的令牌
+const TokenPrefix = "oneimg_"
+
+// Generate 生成新的令牌明文，返回明文和对应的摘要
+func Generate() (plain string, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("生成随机令牌失败：%v", err)
+	}
+	plain = TokenPrefix + hex.EncodeToString(b)
+	return plain, Hash(plain), nil
+}
+
+// GenerateS3Credentials 生成S3访问密钥对（AKID 为20位大写字母数字，与AWS格式一致）
+func GenerateS3Credentials() (accessKey string, secretKey string, err error) {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, 16+30)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("生成S3凭据失败：%v", err)
+	}
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	accessKey = "OIMG" + string(key)
+	secretKey = base64.RawURLEncoding.EncodeToString(b[16:])
+	return accessKey, secretKey, nil
+}
+
+// Hash 计算令牌摘要（数据库中只保存摘要）
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix 返回令牌的可展示前缀
+func DisplayPrefix(plain string) string {
+	if len(plain) <= len(TokenPrefix)+4 {
+		return plain
+	}
+	return plain[:len(TokenPrefix)+4]
+}
+
+// FromAuthorizationHeader 从 Authorization 头中提取 Bearer 令牌
+func FromAuthorizationHeader(header string) string {
+	header = strings.TrimSpace(header)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// NormalizeScopes 校验并去重权限范围
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		valid := false
+		for _, allowed := range models.AllScopes {
+			if s == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("不支持的权限范围：%s", s)
+		}
+		seen[s] = true
+		result = append(result, s)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("至少需要一个权限范围")
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redacted 脱敏后的占位值
+const Redacted = "[REDACTED]"
+
+// redactedFields 除系统设置中的密钥外，其他模型中需要脱敏的字段（JSON字段名）
+var redactedFields = []string{"password", "secret", "secret_key", "access_key", "api_key", "token"}
+
+// ignoredFields 不计入差异的字段
+var ignoredFields = []string{"updated_at"}
+
+// Change 单个字段的变更
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Record 记录一条审计日志
+// before/after 为操作前后的对象（结构体或 map，可为 nil），只保存发生变化的字段；
+// 写入失败只打印日志，不影响请求本身
+func Record(c *gin.Context, action, targetType string, targetId any, before, after any) {
+	entry := models.AuditLog{
+		ActorId:    c.GetInt("user_id"),
+		ActorName:  c.GetString("username"),
+		IP:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+	}
+	if targetId != nil {
+		entry.TargetId = fmt.Sprint(targetId)
+	}
+	if token, ok := c.Get("api_token"); ok {
+		if t, ok := token.(*models.ApiToken); ok {
+			entry.TokenId = t.Id
+		}
+	}
+
+	if changes := Diff(before, after); len(changes) > 0 {
+		data, err := json.Marshal(changes)
+		if err != nil {
+			log.Printf("审计日志差异序列化失败：%v", err)
+		} else {
+			entry.Diff = string(data)
+		}
+	}
+
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	if err := db.DB.Create(&entry).Error; err != nil {
+		log.Printf("写入审计日志失败：%v", err)
+	}
+}
+
+// Diff 比较操作前后的对象，返回发生变化的字段（密钥类字段已脱敏）
+func Diff(before, after any) map[string]Change {
+	b, a := toMap(before), toMap(after)
+
+	keys := make([]string, 0, len(b)+len(a))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make(map[string]Change)
+	for _, k := range keys {
+		if slices.Contains(ignoredFields, k) || reflect.DeepEqual(b[k], a[k]) {
+			continue
+		}
+		change := Change{Before: b[k], After: a[k]}
+		if isRedacted(k) {
+			change.Before = redact(change.Before)
+			change.After = redact(change.After)
+		}
+		changes[k] = change
+	}
+	return changes
+}
+
+// isRedacted 字段是否需要脱敏
+func isRedacted(key string) bool {
+	return models.IsSecretSettingKey(key) || slices.Contains(redactedFields, key)
+}
+
+// redact 非空值替换为占位值，保留“未设置”与“已设置”的区别
+func redact(value any) any {
+	if value == nil || value == "" {
+		return value
+	}
+	return Redacted
+}
+
+// toMap 按JSON字段名将对象展开为 map（json:"-" 的字段不会出现）
+func toMap(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
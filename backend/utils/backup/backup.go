@@ -0,0 +1,413 @@
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"oneimg/backend/models"
+	"oneimg/backend/utils/secrets"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// FormatVersion 备份格式版本，恢复时拒绝更高版本的备份
+const FormatVersion = 1
+
+// UploadsDir 本地存储目录
+const UploadsDir = "./uploads"
+
+// 备份包内的路径
+const (
+	manifestName  = "manifest.json"
+	tablesPrefix  = "tables/"
+	uploadsPrefix = "uploads/"
+)
+
+// batchSize 导出/导入时每批处理的行数
+const batchSize = 500
+
+// Models 需要备份的数据表（上传会话、迁移任务、后台任务、投递记录、工作量证明挑战和上传限流计数属于运行时状态，不备份；
+// 审计日志不随备份恢复被覆盖）
+// 加密字段按数据库中的密文导出，恢复时原样写入，需配置相同的主密钥（或将其加入旧密钥）才能读取
+var Models = []any{
+	&models.User{},
+	&models.Settings{},
+	&models.StorageProfile{},
+	&models.Image{},
+	&models.ImageTeleGram{},
+	&models.ApiToken{},
+	&models.Album{},
+	&models.AlbumImage{},
+	&models.Tag{},
+	&models.ImageTag{},
+	&models.S3Object{},
+	&models.Webhook{},
+	&models.RecoveryCode{},
+}
+
+// Manifest 备份清单
+type Manifest struct {
+	App         string           `json:"app"`
+	Format      int              `json:"format"`
+	CreatedAt   time.Time        `json:"created_at"`
+	DBType      string           `json:"db_type"` // 导出时的数据库类型（仅供参考，可恢复到任意类型）
+	Tables      map[string]int64 `json:"tables"`  // 表名 -> 行数
+	Uploads     bool             `json:"uploads"` // 是否包含本地存储文件
+	UploadFiles int              `json:"upload_files"`
+}
+
+// Export 将数据表（以及可选的本地存储文件）写入 zip 备份包
+// 每张表一个 JSON Lines 文件，字段名使用数据库列名，与数据库类型无关
+func Export(db *gorm.DB, dbType string, w io.Writer, includeUploads bool) (*Manifest, error) {
+	db = db.WithContext(secrets.WithRaw(context.Background()))
+	zw := zip.NewWriter(w)
+	manifest := &Manifest{
+		App:       "oneimg",
+		Format:    FormatVersion,
+		CreatedAt: time.Now(),
+		DBType:    dbType,
+		Tables:    make(map[string]int64),
+		Uploads:   includeUploads,
+	}
+
+	for _, model := range Models {
+		s, err := parseSchema(db, model)
+		if err != nil {
+			return nil, err
+		}
+		count, err := exportTable(db, s, zw)
+		if err != nil {
+			return nil, fmt.Errorf("导出数据表 %s 失败：%v", s.Table, err)
+		}
+		manifest.Tables[s.Table] = count
+	}
+
+	if includeUploads {
+		count, err := exportUploads(zw)
+		if err != nil {
+			return nil, fmt.Errorf("导出本地存储文件失败：%v", err)
+		}
+		manifest.UploadFiles = count
+	}
+
+	mw, err := zw.Create(manifestName)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+// exportTable 分批读取数据表并逐行写入
+func exportTable(db *gorm.DB, s *schema.Schema, zw *zip.Writer) (int64, error) {
+	w, err := zw.Create(tablesPrefix + s.Table + ".jsonl")
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	fields := columnFields(s)
+
+	var count int64
+	rows := reflect.New(reflect.SliceOf(s.ModelType))
+	query := db.Model(reflect.New(s.ModelType).Interface()).Unscoped()
+	for _, pk := range s.PrimaryFields {
+		query = query.Order(pk.DBName)
+	}
+	result := query.FindInBatches(rows.Interface(), batchSize, func(tx *gorm.DB, batch int) error {
+		slice := rows.Elem()
+		for i := 0; i < slice.Len(); i++ {
+			row := make(map[string]any, len(fields))
+			for _, field := range fields {
+				value, _ := field.ValueOf(tx.Statement.Context, slice.Index(i))
+				// 使用序列化器的字段写入数据库中的列值
+				if valuer, ok := value.(driver.Valuer); ok && field.Serializer != nil {
+					v, err := valuer.Value()
+					if err != nil {
+						return err
+					}
+					value = v
+				}
+				row[field.DBName] = value
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return count, result.Error
+	}
+	return count, bw.Flush()
+}
+
+// exportUploads 写入本地存储目录中的全部文件
+func exportUploads(zw *zip.Writer) (int, error) {
+	count := 0
+	err := filepath.WalkDir(UploadsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == UploadsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(UploadsDir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = uploadsPrefix + filepath.ToSlash(rel)
+		// 图片大多已压缩，直接存储
+		header.Method = zip.Store
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// ReadManifest 读取并校验备份清单
+func ReadManifest(zr *zip.Reader) (*Manifest, error) {
+	f, err := zr.Open(manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("备份文件无效：缺少 %s", manifestName)
+	}
+	defer f.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("备份清单解析失败：%v", err)
+	}
+	if manifest.App != "oneimg" {
+		return nil, fmt.Errorf("备份文件无效：不是 OneImg 备份")
+	}
+	if manifest.Format > FormatVersion {
+		return nil, fmt.Errorf("备份格式版本 %d 高于当前支持的版本 %d，请升级后再恢复", manifest.Format, FormatVersion)
+	}
+	return &manifest, nil
+}
+
+// Import 从备份包恢复数据：清空备份涉及的数据表后写入备份数据（同一事务内完成）
+// restoreUploads 为 true 且备份包含本地存储文件时，一并解压到本地存储目录
+func Import(db *gorm.DB, dbType string, zr *zip.Reader, restoreUploads bool) (*Manifest, error) {
+	manifest, err := ReadManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make([]*schema.Schema, 0, len(Models))
+	for _, model := range Models {
+		s, err := parseSchema(db, model)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+
+	restored := make(map[string]int64)
+	err = db.WithContext(secrets.WithRaw(context.Background())).Transaction(func(tx *gorm.DB) error {
+		for _, s := range schemas {
+			model := reflect.New(s.ModelType).Interface()
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
+				return fmt.Errorf("清空数据表 %s 失败：%v", s.Table, err)
+			}
+			count, err := importTable(tx, s, zr)
+			if err != nil {
+				return fmt.Errorf("恢复数据表 %s 失败：%v", s.Table, err)
+			}
+			restored[s.Table] = count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dbType == "postgresql" {
+		for _, s := range schemas {
+			resetSequence(db, s)
+		}
+	}
+
+	if restoreUploads && manifest.Uploads {
+		if _, err := importUploads(zr); err != nil {
+			return nil, fmt.Errorf("恢复本地存储文件失败：%v", err)
+		}
+	}
+
+	manifest.Tables = restored
+	return manifest, nil
+}
+
+// importTable 逐行解析并分批写入数据表，备份中没有该表时保持为空
+func importTable(tx *gorm.DB, s *schema.Schema, zr *zip.Reader) (int64, error) {
+	f, err := zr.Open(tablesPrefix + s.Table + ".jsonl")
+	if err != nil {
+		return 0, nil
+	}
+	defer f.Close()
+
+	fields := columnFields(s)
+	batch := reflect.MakeSlice(reflect.SliceOf(s.ModelType), 0, batchSize)
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		// Select("*") 写入全部字段，避免零值被数据库默认值覆盖
+		if err := tx.Select("*").Create(batch.Interface()).Error; err != nil {
+			return err
+		}
+		batch = batch.Slice(0, 0)
+		return nil
+	}
+
+	var count int64
+	dec := json.NewDecoder(f)
+	for {
+		var raw map[string]json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, err
+		}
+
+		row := reflect.New(s.ModelType).Elem()
+		for _, field := range fields {
+			data, ok := raw[field.DBName]
+			if !ok {
+				continue
+			}
+			value := reflect.New(field.FieldType)
+			if err := json.Unmarshal(data, value.Interface()); err != nil {
+				return count, fmt.Errorf("字段 %s 解析失败：%v", field.DBName, err)
+			}
+			if err := field.Set(tx.Statement.Context, row, value.Elem().Interface()); err != nil {
+				return count, err
+			}
+		}
+
+		batch = reflect.Append(batch, row)
+		count++
+		if batch.Len() >= batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+// importUploads 解压本地存储文件（覆盖同名文件）
+func importUploads(zr *zip.Reader) (int, error) {
+	count := 0
+	for _, f := range zr.File {
+		rel, ok := strings.CutPrefix(f.Name, uploadsPrefix)
+		if !ok || f.FileInfo().IsDir() {
+			continue
+		}
+		rel = path.Clean("/" + rel)[1:]
+		if rel == "" || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		target := filepath.Join(UploadsDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return count, err
+		}
+		if err := extractFile(f, target); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// resetSequence PostgreSQL 按显式ID写入后自增序列不会前进，需要同步到当前最大ID
+func resetSequence(db *gorm.DB, s *schema.Schema) {
+	pk := s.PrioritizedPrimaryField
+	if pk == nil || !pk.AutoIncrement {
+		return
+	}
+	db.Exec(fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+		s.Table, pk.DBName, pk.DBName, s.Table,
+	))
+}
+
+// parseSchema 解析模型对应的表结构
+func parseSchema(db *gorm.DB, model any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// columnFields 对应数据库列的字段
+func columnFields(s *schema.Schema) []*schema.Field {
+	fields := make([]*schema.Field, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.Readable && field.Creatable {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,238 @@
+package chunkupload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+)
+
+// 分片大小限制
+const (
+	DefaultChunkSize  = 5 * 1024 * 1024
+	MinChunkSize      = 256 * 1024
+	MaxChunkSize      = 50 * 1024 * 1024
+	MaxActiveSessions = 10 // 每个用户同时进行中的上传会话上限
+)
+
+// formMemory 合并后的文件超过该大小时由 multipart 写入临时文件，避免占用内存
+const formMemory = 32 << 20
+
+var (
+	dir    string
+	expire time.Duration
+)
+
+// Init 初始化分片暂存目录并启动过期清理
+func Init(stagingDir string, expireAfter time.Duration) {
+	dir = stagingDir
+	expire = expireAfter
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("创建分片上传暂存目录失败：%v", err)
+	}
+
+	go func() {
+		Cleanup()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			Cleanup()
+		}
+	}()
+}
+
+// Expire 会话有效期
+func Expire() time.Duration {
+	return expire
+}
+
+// NewId 生成随机会话ID
+func NewId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// sessionDir 会话的分片目录
+func sessionDir(id string) string {
+	return filepath.Join(dir, id)
+}
+
+func partPath(id string, index int) string {
+	return filepath.Join(sessionDir(id), fmt.Sprintf("part_%05d", index))
+}
+
+// SavePart 保存分片，长度必须与期望值完全一致
+// 先写临时文件再重命名，重复上传同一分片会覆盖旧数据，客户端可放心重试
+func SavePart(id string, index int, r io.Reader, size int64) error {
+	if err := os.MkdirAll(sessionDir(id), 0755); err != nil {
+		return fmt.Errorf("创建分片目录失败：%w", err)
+	}
+
+	target := partPath(id, index)
+	tmp, err := os.CreateTemp(sessionDir(id), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建分片文件失败：%w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, io.LimitReader(r, size+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入分片失败：%w", err)
+	}
+	if n != size {
+		return fmt.Errorf("分片大小不正确：期望 %d 字节，实际 %d 字节", size, n)
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// ReceivedParts 已接收的分片序号（升序）
+func ReceivedParts(id string, total int) []int {
+	parts := make([]int, 0, total)
+	for i := 0; i < total; i++ {
+		if _, err := os.Stat(partPath(id, i)); err == nil {
+			parts = append(parts, i)
+		}
+	}
+	return parts
+}
+
+// FileHeader 按顺序合并全部分片，构造与表单上传一致的文件头，交给现有的存储上传器处理
+// 调用方处理完后需调用 form.RemoveAll() 删除 multipart 生成的临时文件
+func FileHeader(session models.UploadSession, contentType string) (*multipart.FileHeader, *multipart.Form, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(session.FileName)))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		for i := 0; i < session.TotalChunks; i++ {
+			if err := appendPart(part, session.Id, i); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	form, err := multipart.NewReader(pr, writer.Boundary()).ReadForm(formMemory)
+	// 确保写入协程在读取出错时也能退出
+	pr.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("合并分片失败：%w", err)
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		form.RemoveAll()
+		return nil, nil, errors.New("合并分片失败：文件为空")
+	}
+	if files[0].Size != session.FileSize {
+		form.RemoveAll()
+		return nil, nil, fmt.Errorf("合并后的文件大小不正确：期望 %d 字节，实际 %d 字节", session.FileSize, files[0].Size)
+	}
+	return files[0], form, nil
+}
+
+// ReadHead 读取合并后文件的开头，用于识别文件类型
+func ReadHead(id string, n int) []byte {
+	file, err := os.Open(partPath(id, 0))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	buf := make([]byte, n)
+	read, _ := io.ReadFull(file, buf)
+	return buf[:read]
+}
+
+func appendPart(w io.Writer, id string, index int) error {
+	file, err := os.Open(partPath(id, index))
+	if err != nil {
+		return fmt.Errorf("分片 %d 不存在", index)
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
+
+// Remove 删除会话的全部分片
+func Remove(id string) {
+	if id == "" || dir == "" {
+		return
+	}
+	if err := os.RemoveAll(sessionDir(id)); err != nil {
+		log.Printf("删除分片目录失败 [%s]：%v", id, err)
+	}
+}
+
+// Cleanup 删除过期会话及其分片，同时清理没有对应会话记录的残留目录
+func Cleanup() {
+	db := database.GetDB()
+	if db == nil || db.DB == nil {
+		return
+	}
+
+	var expired []models.UploadSession
+	db.DB.Where("expires_at < ?", time.Now()).Find(&expired)
+	for _, session := range expired {
+		Remove(session.Id)
+		db.DB.Delete(&session)
+	}
+	if len(expired) > 0 {
+		log.Printf("已清理 %d 个过期的分片上传会话", len(expired))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var count int64
+		db.DB.Model(&models.UploadSession{}).Where("id = ?", entry.Name()).Count(&count)
+		if count == 0 {
+			Remove(entry.Name())
+		}
+	}
+}
+
+// ParseIndex 解析分片序号
+func ParseIndex(raw string, total int) (int, error) {
+	index, err := strconv.Atoi(raw)
+	if err != nil || index < 0 || index >= total {
+		return 0, fmt.Errorf("分片序号无效（应为 0-%d）", total-1)
+	}
+	return index, nil
+}
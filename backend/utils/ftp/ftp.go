@@ -241,6 +241,34 @@ func (f *FTPUtil) GetFileStreamReader(remotePath string) (io.ReadCloser, int64,
 	return resp, fileSize, nil
 }
 
+// FileSize 获取FTP文件大小（SIZE命令）
+func (f *FTPUtil) FileSize(remotePath string) (int64, error) {
+	client, err := f.GetClient()
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := client.FileSize(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("获取文件大小失败: %w", err)
+	}
+	return size, nil
+}
+
+// GetFileStreamReaderFrom 从指定偏移量开始流式获取FTP文件（REST + RETR），用于分段下载
+func (f *FTPUtil) GetFileStreamReaderFrom(remotePath string, offset int64) (io.ReadCloser, error) {
+	client, err := f.GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.RetrFrom(remotePath, uint64(offset))
+	if err != nil {
+		return nil, fmt.Errorf("获取文件流失败: %w", err)
+	}
+	return resp, nil
+}
+
 // ListFiles 列出指定目录下的文件（可选扩展）
 // remoteDir: 远程目录
 // 返回值: 文件列表、错误
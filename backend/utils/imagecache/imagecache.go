@@ -0,0 +1,270 @@
+package imagecache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry 缓存的衍生图片（水印/变换结果）
+type Entry struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// item LRU链表节点
+type item struct {
+	imageId int
+	name    string // 缓存键摘要，同时作为磁盘文件名
+	size    int64
+	entry   *Entry // 仅内存层使用
+}
+
+// lru 按字节数限制容量的LRU索引
+type lru struct {
+	max   int64
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newLRU(max int64) *lru {
+	return &lru{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(name string) (*item, bool) {
+	el, ok := l.items[name]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*item), true
+}
+
+// add 添加节点，返回因超出容量被淘汰的节点
+func (l *lru) add(it *item) []*item {
+	if old, ok := l.items[it.name]; ok {
+		l.remove(old)
+	}
+	l.items[it.name] = l.order.PushFront(it)
+	l.size += it.size
+
+	var evicted []*item
+	for l.size > l.max && l.order.Len() > 0 {
+		el := l.order.Back()
+		evicted = append(evicted, el.Value.(*item))
+		l.remove(el)
+	}
+	return evicted
+}
+
+func (l *lru) remove(el *list.Element) {
+	it := el.Value.(*item)
+	l.order.Remove(el)
+	delete(l.items, it.name)
+	l.size -= it.size
+}
+
+// removeImage 移除指定图片的全部节点
+func (l *lru) removeImage(imageId int) []*item {
+	var removed []*item
+	for el := l.order.Front(); el != nil; {
+		next := el.Next()
+		if it := el.Value.(*item); it.imageId == imageId {
+			removed = append(removed, it)
+			l.remove(el)
+		}
+		el = next
+	}
+	return removed
+}
+
+var (
+	mu     sync.Mutex
+	dir    string
+	memory *lru
+	disk   *lru
+)
+
+// Init 初始化缓存，memoryBytes/diskBytes 为0时禁用对应层
+// 磁盘层在启动时扫描已有文件重建索引，按修改时间近似LRU顺序
+func Init(cacheDir string, memoryBytes, diskBytes int64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	memory, disk = nil, nil
+	if memoryBytes > 0 {
+		memory = newLRU(memoryBytes)
+	}
+	if diskBytes <= 0 || cacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		log.Printf("创建衍生图片缓存目录失败，磁盘缓存已禁用: %v", err)
+		return
+	}
+	dir = cacheDir
+	disk = newLRU(diskBytes)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type found struct {
+		it      *item
+		modTime time.Time
+	}
+	files := make([]found, 0, len(entries))
+	for _, e := range entries {
+		imageId, ok := parseFileName(e.Name())
+		info, err := e.Info()
+		if !ok || err != nil || e.IsDir() {
+			continue
+		}
+		files = append(files, found{&item{imageId: imageId, name: e.Name(), size: info.Size()}, info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		for _, ev := range disk.add(f.it) {
+			os.Remove(filepath.Join(dir, ev.name))
+		}
+	}
+}
+
+// Key 生成缓存键：图片ID + 访问路径 + 规范化后的处理参数
+func Key(imageId int, path string, params ...string) string {
+	return fmt.Sprintf("%d|%s|%s", imageId, path, strings.Join(params, "|"))
+}
+
+// Get 读取缓存，内存未命中时回退到磁盘并回填内存
+func Get(imageId int, key string) (*Entry, bool) {
+	name := fileName(imageId, key)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if memory != nil {
+		if it, ok := memory.get(name); ok {
+			return it.entry, true
+		}
+	}
+	if disk == nil {
+		return nil, false
+	}
+	if _, ok := disk.get(name); !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// 文件被外部删除
+		if el, ok := disk.items[name]; ok {
+			disk.remove(el)
+		}
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := newEntry(data, http.DetectContentType(data), info.ModTime())
+	if memory != nil {
+		memory.add(&item{imageId: imageId, name: name, size: int64(len(data)), entry: entry})
+	}
+	return entry, true
+}
+
+// Set 写入缓存并返回缓存条目
+func Set(imageId int, key string, data []byte, contentType string) *Entry {
+	name := fileName(imageId, key)
+	entry := newEntry(data, contentType, time.Now())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	size := int64(len(data))
+	if memory != nil && size <= memory.max {
+		memory.add(&item{imageId: imageId, name: name, size: size, entry: entry})
+	}
+	if disk != nil && size <= disk.max {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			log.Printf("写入衍生图片缓存失败: %v", err)
+			return entry
+		}
+		for _, ev := range disk.add(&item{imageId: imageId, name: name, size: size}) {
+			os.Remove(filepath.Join(dir, ev.name))
+		}
+	}
+	return entry
+}
+
+// InvalidateImage 删除指定图片的全部衍生缓存
+func InvalidateImage(imageId int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if memory != nil {
+		memory.removeImage(imageId)
+	}
+	if disk != nil {
+		for _, it := range disk.removeImage(imageId) {
+			os.Remove(filepath.Join(dir, it.name))
+		}
+	}
+}
+
+// newEntry 构建缓存条目，ETag 取内容摘要
+func newEntry(data []byte, contentType string, modTime time.Time) *Entry {
+	sum := sha256.Sum256(data)
+	return &Entry{
+		Data:        data,
+		ContentType: contentType,
+		ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		ModTime:     modTime.UTC().Truncate(time.Second),
+	}
+}
+
+// fileName 缓存文件名：<图片ID>_<键摘要>
+func fileName(imageId int, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return strconv.Itoa(imageId) + "_" + hex.EncodeToString(sum[:16])
+}
+
+func parseFileName(name string) (int, bool) {
+	idx := strings.IndexByte(name, '_')
+	if idx <= 0 {
+		return 0, false
+	}
+	imageId, err := strconv.Atoi(name[:idx])
+	return imageId, err == nil
+}
+
+// Purge 清空全部衍生缓存（恢复备份后同一图片ID可能对应不同的图片）
+func Purge() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if memory != nil {
+		memory = newLRU(memory.max)
+	}
+	if disk != nil {
+		for name := range disk.items {
+			os.Remove(filepath.Join(dir, name))
+		}
+		disk = newLRU(disk.max)
+	}
+}
@@ -2,6 +2,8 @@ package images
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"image"
@@ -40,6 +42,18 @@ var (
 		"image/gif",
 		"image/svg+xml",
 	}
+	// 输出文件扩展名
+	outputExts = map[string]string{
+		"image/jpeg":    ".jpg",  // JPEG格式
+		"image/png":     ".png",  // PNG格式
+		"image/gif":     ".gif",  // GIF格式
+		"image/webp":    ".webp", // WebP格式
+		"image/svg+xml": ".svg",  // SVG格式
+		"image/bmp":     ".bmp",  // BMP格式
+		"image/tiff":    ".tiff", // TIFF格式
+		"image/heic":    ".heic", // HEIC格式
+		"image/heif":    ".heif", // HEIF格式
+	}
 	ErrUnsupportedFormat  = errors.New("unsupported image format")
 	ErrFileTooLarge       = errors.New("file size exceeds limit")
 	ErrMissingContentType = errors.New("missing content type")
@@ -67,6 +81,9 @@ type ProcessedImage struct {
 	MimeType        string // 最终MIME类型
 	OutputExt       string // 输出文件扩展名
 	UniqueFileName  string // 唯一文件名
+	ContentHash     string // 原始文件内容的SHA-256（十六进制）
+	ProcessKey      string // 处理设置摘要（见 ProcessKey）
+	Deferred        bool   // 主图尚未处理，需由后台任务完成（见 InspectBytes）
 }
 
 // ProcessImage 处理图片（压缩、获取尺寸等）
@@ -80,7 +97,15 @@ func (s *ImageService) ProcessImage(
 	if err != nil {
 		return nil, fmt.Errorf("read file failed: %w", err)
 	}
+	return s.ProcessBytes(fileBytes, header, setting)
+}
 
+// ProcessBytes 处理已读入内存的图片（调用方可先按内容哈希去重，命中时无需处理）
+func (s *ImageService) ProcessBytes(
+	fileBytes []byte,
+	header *multipart.FileHeader,
+	setting models.Settings,
+) (*ProcessedImage, error) {
 	// 验证文件完整性（检查实际读取大小是否与Header声明大小一致）
 	if header.Size > 0 && int64(len(fileBytes)) != header.Size {
 		return nil, fmt.Errorf("upload truncated: expected %d bytes, got %d bytes", header.Size, len(fileBytes))
@@ -105,33 +130,23 @@ func (s *ImageService) ProcessImage(
 		return nil, fmt.Errorf("process main image failed: %w", err)
 	}
 
-	// 5. 处理文件扩展名
-	outputExt := map[string]string{
-		"image/jpeg":    ".jpg",  // JPEG格式
-		"image/png":     ".png",  // PNG格式
-		"image/gif":     ".gif",  // GIF格式
-		"image/webp":    ".webp", // WebP格式
-		"image/svg+xml": ".svg",  // SVG格式
-		"image/bmp":     ".bmp",  // BMP格式
-		"image/tiff":    ".tiff", // TIFF格式
-		"image/heic":    ".heic", // HEIC格式
-		"image/heif":    ".heif", // HEIF格式
-	}
-
-	// 将主图转化成image.Image用于生成缩略图
-	reader := bytes.NewReader(processedBytes)
-	img, _, err = image.Decode(reader)
-	if err != nil {
-		return nil, fmt.Errorf("decode image failed: %w", err)
-	}
+	// 5. 生成缩略图（未开启或交由后台任务生成时跳过）
+	var thumbnailBytes []byte
+	if setting.Thumbnail {
+		// 将主图转化成image.Image用于生成缩略图
+		reader := bytes.NewReader(processedBytes)
+		img, _, err = image.Decode(reader)
+		if err != nil {
+			return nil, fmt.Errorf("decode image failed: %w", err)
+		}
 
-	// 6. 生成缩略图
-	thumbnailBytes, err := s.generateThumbnail(img, finalFormat, finalMimeType)
-	if err != nil {
-		return nil, fmt.Errorf("generate thumbnail failed: %w", err)
+		thumbnailBytes, err = s.generateThumbnail(img, finalFormat, finalMimeType)
+		if err != nil {
+			return nil, fmt.Errorf("generate thumbnail failed: %w", err)
+		}
 	}
 
-	// 7. 组装返回结果
+	// 6. 组装返回结果
 	return &ProcessedImage{
 		OriginalBytes:   fileBytes,
 		CompressedBytes: processedBytes,
@@ -140,11 +155,64 @@ func (s *ImageService) ProcessImage(
 		Height:          height,
 		Format:          finalFormat,
 		MimeType:        finalMimeType,
-		OutputExt:       outputExt[finalMimeType],
-		UniqueFileName:  generateUniqueFileName(outputExt[finalMimeType]),
+		OutputExt:       outputExts[finalMimeType],
+		UniqueFileName:  generateUniqueFileName(outputExts[finalMimeType]),
+		ContentHash:     ContentHash(fileBytes),
+		ProcessKey:      ProcessKey(setting),
 	}, nil
 }
 
+// InspectBytes 只读取图片头部获取尺寸，水印和格式转换交由后台任务完成（见 ProcessBytes）
+// 返回的 CompressedBytes 为原始内容，MimeType 和文件名按处理完成后的格式确定，处理前后对象键不变
+// 无需处理的图片 Deferred 为 false，原始内容即为最终结果
+func (s *ImageService) InspectBytes(
+	fileBytes []byte,
+	header *multipart.FileHeader,
+	setting models.Settings,
+) (*ProcessedImage, error) {
+	if header.Size > 0 && int64(len(fileBytes)) != header.Size {
+		return nil, fmt.Errorf("upload truncated: expected %d bytes, got %d bytes", header.Size, len(fileBytes))
+	}
+
+	mimeType := header.Header.Get("Content-Type")
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(fileBytes))
+	if err != nil || s.isSpecialFormat(format, mimeType) {
+		// 特殊格式保持原样，无法只读取头部的格式按原流程处理
+		return s.ProcessBytes(fileBytes, header, setting)
+	}
+
+	// 与 processMainImage 的格式选择保持一致
+	finalFormat, finalMimeType := format, mimeType
+	if strings.ToLower(format) == "webp" || setting.SaveWebp {
+		finalFormat, finalMimeType = "webp", "image/webp"
+	}
+
+	return &ProcessedImage{
+		OriginalBytes:   fileBytes,
+		CompressedBytes: fileBytes,
+		Width:           cfg.Width,
+		Height:          cfg.Height,
+		Format:          finalFormat,
+		MimeType:        finalMimeType,
+		OutputExt:       outputExts[finalMimeType],
+		UniqueFileName:  generateUniqueFileName(outputExts[finalMimeType]),
+		ContentHash:     ContentHash(fileBytes),
+		ProcessKey:      ProcessKey(setting),
+		Deferred:        needsProcessing(format, int64(len(fileBytes)), setting),
+	}, nil
+}
+
+// needsProcessing 按 processMainImage 的规则判断主图是否会被修改（特殊格式除外）
+func needsProcessing(format string, fileSize int64, setting models.Settings) bool {
+	if setting.WatermarkEnable {
+		return true
+	}
+	if strings.ToLower(format) == "webp" {
+		return !setting.OriginalImage && fileSize > CompressSizeThreshold
+	}
+	return setting.SaveWebp || !setting.OriginalImage
+}
+
 // processMainImage 处理主图片（拆分逻辑，提高可读性）
 func (s *ImageService) processMainImage(
 	fileBytes []byte,
@@ -231,6 +299,15 @@ func (s *ImageService) generateThumbnail(
 	return s.generateWebPThumbnail(img, ThumbnailMaxWidth, ThumbnailMaxHeight, ThumbnailQuality)
 }
 
+// GenerateThumbnail 由已保存的图片数据生成缩略图（后台任务使用）
+func (s *ImageService) GenerateThumbnail(data []byte, mimeType string) ([]byte, error) {
+	img, format, err := s.decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return s.generateThumbnail(img, format, mimeType)
+}
+
 // isSpecialFormat 检查是否为特殊格式（需要保持原格式）
 func (s *ImageService) isSpecialFormat(format, mimeType string) bool {
 	// 检查格式
@@ -377,6 +454,24 @@ func ReadFileContent(header *multipart.FileHeader) ([]byte, error) {
 	return io.ReadAll(file)
 }
 
+// ContentHash 计算文件内容哈希（SHA-256），用于内容去重
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ProcessKey 影响处理结果的设置摘要（水印、WebP转换、压缩）
+// 相同内容只有在处理设置也相同时才能复用已保存的对象，设置变更后重新上传会生成新文件
+func ProcessKey(setting models.Settings) string {
+	key := fmt.Sprintf("webp=%t|original=%t", setting.SaveWebp, setting.OriginalImage)
+	if setting.WatermarkEnable {
+		key += fmt.Sprintf("|watermark=%s|%s|%d|%s|%g",
+			setting.WatermarkText, setting.WatermarkPos, setting.WatermarkSize, setting.WatermarkColor, setting.WatermarkOpac)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
 // GetFileMimeType 获取文件MIME类型
 func GetFileMimeType(header *multipart.FileHeader) string {
 	return header.Header.Get("Content-Type")
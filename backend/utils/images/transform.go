@@ -0,0 +1,303 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/exp/slices"
+)
+
+// 变换限制，防止通过任意尺寸请求耗尽CPU和内存
+const (
+	TransformMaxSourcePixels = 50 * 1000 * 1000 // 原图最大像素数
+	TransformMinQuality      = 10
+	TransformMaxQuality      = 100
+	// TransformCropSteps 裁剪坐标按原图宽高的 1/20 对齐，限制不同裁剪参数的组合数量
+	TransformCropSteps = 20
+)
+
+// TransformSizes 允许的输出宽高（像素）
+var TransformSizes = []int{32, 64, 96, 128, 160, 200, 240, 256, 300, 320, 400, 480, 512, 600, 640, 720, 768, 800, 960, 1024, 1080, 1200, 1280, 1440, 1600, 1920, 2048, 2560, 3840}
+
+// TransformQualities 输出质量预设，请求的质量取最接近的预设值
+var TransformQualities = []int{40, 60, 75, 85, 95, 100}
+
+// 缩放模式
+const (
+	FitInside = "inside" // 等比缩放至不超过目标尺寸（默认）
+	FitCover  = "cover"  // 等比缩放后居中裁剪，填满目标尺寸
+	FitFill   = "fill"   // 拉伸至目标尺寸
+)
+
+// 输出格式
+const (
+	FormatAuto = "auto" // 客户端支持时输出webp，否则保持原格式
+	FormatWebP = "webp"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	// FormatAVIF 暂无可用的AVIF编码器，按WebP输出（响应 Content-Type 为实际格式）
+	FormatAVIF = "avif"
+)
+
+var transformFits = []string{FitInside, FitCover, FitFill}
+
+// transformSlots 限制同时进行的变换数量
+var transformSlots = make(chan struct{}, runtime.NumCPU())
+
+// TransformOptions 图片变换参数
+type TransformOptions struct {
+	Width   int             // 目标宽度（0表示按比例）
+	Height  int             // 目标高度（0表示按比例）
+	Fit     string          // 缩放模式
+	Crop    image.Rectangle // 缩放前按原图坐标裁剪的区域（为空表示不裁剪）
+	Format  string          // 输出格式（为空表示保持原格式）
+	Quality int             // 输出质量（webp/jpeg）
+}
+
+// IsEmpty 是否未请求任何变换
+func (o TransformOptions) IsEmpty() bool {
+	return o.Width == 0 && o.Height == 0 && o.Crop.Empty() && o.Format == "" && o.Quality == 0
+}
+
+// CacheKey 变换参数的规范化表示，可用作缓存键
+func (o TransformOptions) CacheKey() string {
+	return fmt.Sprintf("w%d_h%d_%s_c%d,%d,%d,%d_%s_q%d",
+		o.Width, o.Height, o.Fit,
+		o.Crop.Min.X, o.Crop.Min.Y, o.Crop.Dx(), o.Crop.Dy(),
+		o.Format, o.Quality)
+}
+
+// ParseTransform 解析变换参数
+// 支持 w、h、fit（inside/cover/fill）、crop（x,y,宽,高）、fmt（webp/jpeg/png/avif/auto）、q（10-100）
+// 宽高只允许预设值，裁剪按原图尺寸（srcWidth、srcHeight）对齐网格，质量取最接近的预设值，
+// 避免任意参数组合产生大量缓存键和解码
+// accept 为请求的 Accept 头，用于 fmt=auto 时协商格式
+func ParseTransform(query url.Values, accept string, srcWidth, srcHeight int) (TransformOptions, error) {
+	var opts TransformOptions
+
+	var err error
+	if opts.Width, err = parseTransformSize(query.Get("w"), "宽度"); err != nil {
+		return opts, err
+	}
+	if opts.Height, err = parseTransformSize(query.Get("h"), "高度"); err != nil {
+		return opts, err
+	}
+
+	opts.Fit = strings.ToLower(query.Get("fit"))
+	if opts.Fit == "" {
+		opts.Fit = FitInside
+	}
+	if !slices.Contains(transformFits, opts.Fit) {
+		return opts, fmt.Errorf("不支持的缩放模式：%s（可选 inside/cover/fill）", opts.Fit)
+	}
+	if opts.Fit != FitInside && (opts.Width == 0 || opts.Height == 0) {
+		return opts, fmt.Errorf("缩放模式 %s 需要同时指定宽度和高度", opts.Fit)
+	}
+
+	if raw := query.Get("crop"); raw != "" {
+		parts := strings.Split(raw, ",")
+		if len(parts) != 4 {
+			return opts, errors.New("裁剪参数格式应为 x,y,宽,高")
+		}
+		nums := make([]int, 4)
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || n < 0 {
+				return opts, errors.New("裁剪参数无效")
+			}
+			nums[i] = n
+		}
+		if nums[2] == 0 || nums[3] == 0 {
+			return opts, errors.New("裁剪区域不能为空")
+		}
+		if srcWidth <= 0 || srcHeight <= 0 {
+			return opts, errors.New("图片尺寸未知，不支持裁剪")
+		}
+		x, w := snapCrop(nums[0], nums[2], srcWidth)
+		y, h := snapCrop(nums[1], nums[3], srcHeight)
+		if w <= 0 || h <= 0 {
+			return opts, errors.New("裁剪区域超出图片范围")
+		}
+		opts.Crop = image.Rect(x, y, x+w, y+h)
+	}
+
+	switch format := strings.ToLower(query.Get("fmt")); format {
+	case "":
+	case "jpg", FormatJPEG:
+		opts.Format = FormatJPEG
+	case FormatWebP, FormatPNG:
+		opts.Format = format
+	case FormatAVIF:
+		opts.Format = FormatWebP
+	case FormatAuto:
+		if strings.Contains(accept, "image/webp") {
+			opts.Format = FormatWebP
+		}
+	default:
+		return opts, fmt.Errorf("不支持的输出格式：%s（可选 webp/jpeg/png/avif/auto）", format)
+	}
+
+	if raw := query.Get("q"); raw != "" {
+		q, err := strconv.Atoi(raw)
+		if err != nil || q < TransformMinQuality || q > TransformMaxQuality {
+			return opts, fmt.Errorf("质量参数需在%d-%d之间", TransformMinQuality, TransformMaxQuality)
+		}
+		opts.Quality = nearestQuality(q)
+	}
+
+	return opts, nil
+}
+
+// parseTransformSize 解析并校验尺寸，只允许预设值
+func parseTransformSize(raw, name string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || !slices.Contains(TransformSizes, size) {
+		return 0, fmt.Errorf("%s仅允许以下取值：%s", name, joinSizes())
+	}
+	return size, nil
+}
+
+// snapCrop 将一个方向上的裁剪起点和长度对齐到原图尺寸的网格，超出部分截断到图片边缘
+func snapCrop(offset, length, size int) (int, int) {
+	step := (size + TransformCropSteps - 1) / TransformCropSteps
+	offset = (offset + step/2) / step * step
+	length = max((length+step/2)/step*step, step)
+	return offset, min(length, size-offset)
+}
+
+// nearestQuality 取最接近的质量预设值
+func nearestQuality(q int) int {
+	best := TransformQualities[0]
+	for _, preset := range TransformQualities {
+		if abs(preset-q) < abs(best-q) {
+			best = preset
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func joinSizes() string {
+	parts := make([]string, len(TransformSizes))
+	for i, s := range TransformSizes {
+		parts[i] = strconv.Itoa(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Transform 按参数变换图片，返回新的图片数据和MIME类型
+func Transform(data []byte, opts TransformOptions) ([]byte, string, error) {
+	// 先读取头信息，拒绝超大图片，避免解码耗尽内存
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == nil && cfg.Width*cfg.Height > TransformMaxSourcePixels {
+		return nil, "", fmt.Errorf("原图尺寸过大（%dx%d），不支持变换", cfg.Width, cfg.Height)
+	}
+
+	transformSlots <- struct{}{}
+	defer func() { <-transformSlots }()
+
+	if ImageSvc == nil {
+		InitImageService()
+	}
+	img, format, err := ImageSvc.decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if img.Bounds().Dx()*img.Bounds().Dy() > TransformMaxSourcePixels {
+		return nil, "", errors.New("原图尺寸过大，不支持变换")
+	}
+
+	if !opts.Crop.Empty() {
+		region := opts.Crop.Add(img.Bounds().Min)
+		if !region.In(img.Bounds()) {
+			return nil, "", errors.New("裁剪区域超出图片范围")
+		}
+		img = imaging.Crop(img, region)
+	}
+
+	img = resizeForTransform(img, opts)
+
+	outFormat := opts.Format
+	if outFormat == "" {
+		switch format {
+		case "webp":
+			outFormat = FormatWebP
+		case "jpeg":
+			outFormat = FormatJPEG
+		default:
+			outFormat = FormatPNG
+		}
+	}
+	quality := opts.Quality
+	if quality == 0 {
+		quality = DefaultCompressQuality
+	}
+
+	buf := new(bytes.Buffer)
+	switch outFormat {
+	case FormatWebP:
+		out, err := ImageSvc.convertToWebP(img, quality)
+		if err != nil {
+			return nil, "", err
+		}
+		return out, "image/webp", nil
+	case FormatJPEG:
+		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("encode jpeg: %w", err)
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	default:
+		if err := png.Encode(buf, img); err != nil {
+			return nil, "", fmt.Errorf("encode png: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+}
+
+// resizeForTransform 按缩放模式调整尺寸，不放大原图
+func resizeForTransform(img image.Image, opts TransformOptions) image.Image {
+	if opts.Width == 0 && opts.Height == 0 {
+		return img
+	}
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+
+	switch opts.Fit {
+	case FitCover:
+		if opts.Width > srcW && opts.Height > srcH {
+			return img
+		}
+		return imaging.Fill(img, min(opts.Width, srcW), min(opts.Height, srcH), imaging.Center, imaging.Lanczos)
+	case FitFill:
+		return imaging.Resize(img, min(opts.Width, srcW), min(opts.Height, srcH), imaging.Lanczos)
+	default:
+		w, h := opts.Width, opts.Height
+		if (w == 0 || w >= srcW) && (h == 0 || h >= srcH) {
+			return img
+		}
+		if w == 0 {
+			return imaging.Resize(img, 0, h, imaging.Lanczos)
+		}
+		if h == 0 {
+			return imaging.Resize(img, w, 0, imaging.Lanczos)
+		}
+		return imaging.Fit(img, w, h, imaging.Lanczos)
+	}
+}
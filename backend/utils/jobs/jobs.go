@@ -0,0 +1,244 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// pollInterval 没有新任务通知时的轮询间隔（用于执行到期的重试任务）
+	pollInterval = 5 * time.Second
+	// jobTimeout 单个任务的执行时限
+	jobTimeout = 5 * time.Minute
+	// maxBackoff 重试等待时间上限
+	maxBackoff = 30 * time.Minute
+	// retention 已完成任务的保留时间
+	retention = 7 * 24 * time.Hour
+)
+
+// Handler 任务处理函数，返回错误时按退避时间重试
+type Handler func(ctx context.Context, job *models.Job) error
+
+var (
+	mu          sync.RWMutex
+	handlers    = map[string]Handler{}
+	wake        chan struct{}
+	maxAttempts = 5
+)
+
+// Register 注册任务类型的处理函数
+func Register(jobType string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[jobType] = handler
+}
+
+// Init 启动任务执行协程
+// 进程退出时处于执行中的任务会被重置为等待执行
+func Init(workers, attempts int) {
+	if attempts > 0 {
+		maxAttempts = attempts
+	}
+	Register(models.JobTypeVariant, runVariant)
+	Register(models.JobTypeThumbnail, runThumbnail)
+	Register(models.JobTypeNotify, runNotify)
+
+	db := database.GetDB().DB
+	db.Model(&models.Job{}).
+		Where("status = ?", models.JobRunning).
+		Updates(map[string]any{"status": models.JobPending, "run_at": time.Now()})
+
+	wake = make(chan struct{}, workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	go cleanup()
+}
+
+// Enqueue 创建任务，payload 会序列化为JSON保存
+func Enqueue(jobType string, imageId, userId int, payload any) (*models.Job, error) {
+	job := &models.Job{
+		Type:        jobType,
+		Status:      models.JobPending,
+		ImageId:     imageId,
+		UserId:      userId,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now(),
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = string(data)
+	}
+
+	if err := database.GetDB().DB.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("创建后台任务失败：%w", err)
+	}
+	notify()
+	return job, nil
+}
+
+// Retry 重新执行失败的任务
+func Retry(id int) (*models.Job, error) {
+	db := database.GetDB().DB
+	var job models.Job
+	if err := db.First(&job, id).Error; err != nil {
+		return nil, errors.New("任务不存在")
+	}
+	if job.Status != models.JobFailed {
+		return nil, errors.New("只能重试失败的任务")
+	}
+
+	updates := map[string]any{
+		"status":       models.JobPending,
+		"attempts":     0,
+		"max_attempts": maxAttempts,
+		"run_at":       time.Now(),
+		"finished_at":  nil,
+	}
+	// 条件更新，避免与并发的重试请求重复执行
+	res := db.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobFailed).Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, errors.New("更新任务失败")
+	}
+	db.First(&job, id)
+	notify()
+	return &job, nil
+}
+
+// DecodePayload 解析任务参数
+func DecodePayload(job *models.Job, v any) error {
+	if job.Payload == "" {
+		return errors.New("任务参数为空")
+	}
+	return json.Unmarshal([]byte(job.Payload), v)
+}
+
+// notify 唤醒一个空闲的执行协程
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// worker 循环领取并执行到期任务
+func worker() {
+	for {
+		job := claim()
+		if job == nil {
+			select {
+			case <-wake:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		execute(job)
+	}
+}
+
+// claim 领取一个到期任务：条件更新状态，更新成功才算领取（多副本部署时也不会重复执行）
+func claim() *models.Job {
+	db := database.GetDB().DB
+
+	var candidates []models.Job
+	err := db.Where("status = ? AND run_at <= ?", models.JobPending, time.Now()).
+		Order("id ASC").
+		Limit(10).
+		Find(&candidates).Error
+	if err != nil {
+		return nil
+	}
+
+	for _, job := range candidates {
+		res := db.Model(&models.Job{}).
+			Where("id = ? AND status = ?", job.Id, models.JobPending).
+			Updates(map[string]any{"status": models.JobRunning, "attempts": gorm.Expr("attempts + 1")})
+		if res.Error == nil && res.RowsAffected == 1 {
+			job.Status = models.JobRunning
+			job.Attempts++
+			return &job
+		}
+	}
+	return nil
+}
+
+// execute 执行任务并记录结果，失败时按指数退避重新排队
+func execute(job *models.Job) {
+	mu.RLock()
+	handler, ok := handlers[job.Type]
+	mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("未知的任务类型：%s", job.Type)
+	} else {
+		err = run(handler, job)
+	}
+
+	db := database.GetDB().DB
+	now := time.Now()
+	if err == nil {
+		db.Model(&models.Job{}).Where("id = ?", job.Id).Updates(map[string]any{
+			"status":      models.JobSucceeded,
+			"last_error":  "",
+			"finished_at": now,
+		})
+		return
+	}
+
+	updates := map[string]any{"last_error": err.Error()}
+	if !ok || job.Attempts >= job.MaxAttempts {
+		updates["status"] = models.JobFailed
+		updates["finished_at"] = now
+		log.Printf("后台任务 #%d（%s）失败：%v", job.Id, job.Type, err)
+	} else {
+		updates["status"] = models.JobPending
+		updates["run_at"] = now.Add(backoff(job.Attempts))
+	}
+	db.Model(&models.Job{}).Where("id = ?", job.Id).Updates(updates)
+}
+
+// run 在时限内执行处理函数，处理函数 panic 时按失败处理
+func run(handler Handler, job *models.Job) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务执行异常：%v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff 第 n 次失败后的等待时间：10s、20s、40s……，不超过 maxBackoff
+func backoff(attempts int) time.Duration {
+	d := 10 * time.Second
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// cleanup 定期删除超过保留时间的已完成任务（失败任务保留以便排查和重试）
+func cleanup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		database.GetDB().DB.
+			Where("status = ? AND finished_at < ?", models.JobSucceeded, time.Now().Add(-retention)).
+			Delete(&models.Job{})
+	}
+}
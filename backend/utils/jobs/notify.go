@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+
+	"oneimg/backend/models"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/telegram"
+)
+
+// runNotify 发送Telegram上传通知，使用执行时的通知配置
+func runNotify(ctx context.Context, job *models.Job) error {
+	var data telegram.PlaceholderData
+	if err := DecodePayload(job, &data); err != nil {
+		return err
+	}
+
+	setting, err := settings.GetSettings()
+	if err != nil {
+		return err
+	}
+	// 排队期间关闭了通知
+	if !setting.TGNotice {
+		return nil
+	}
+
+	return telegram.SendSimpleMsg(setting.TGBotToken, setting.TGReceivers, setting.TGNoticeText, data)
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/images"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/storage"
+
+	"gorm.io/gorm"
+)
+
+// runThumbnail 读取已保存的原图，生成缩略图写入同一存储并回写图片记录
+func runThumbnail(ctx context.Context, job *models.Job) error {
+	db := database.GetDB().DB
+
+	var image models.Image
+	if err := db.First(&image, job.ImageId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 图片已删除，无需处理
+			return nil
+		}
+		return err
+	}
+	if image.Thumbnail != "" {
+		return nil
+	}
+
+	setting, err := settings.ForImage(image)
+	if err != nil {
+		return err
+	}
+	backend, err := storage.New(image.Storage, setting)
+	if err != nil {
+		return err
+	}
+
+	obj, err := backend.Read(ctx, image)
+	if err != nil {
+		return err
+	}
+	thumb, err := images.ImageSvc.GenerateThumbnail(obj.Data, image.MimeType)
+	if err != nil {
+		return fmt.Errorf("生成缩略图失败：%w", err)
+	}
+	loc, err := backend.WriteThumbnail(ctx, obj.Key, thumb)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if loc.Telegram != nil {
+			err := tx.Model(&models.ImageTeleGram{}).
+				Where("file_name = ?", image.FileName).
+				Updates(map[string]any{
+					"tg_thumbnail_file_id":    loc.Telegram.TGThumbnailFileId,
+					"tg_thumbnail_message_id": loc.Telegram.TGThumbnailMessageId,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		// 内容去重时多条记录共用同一对象，一并更新
+		return tx.Model(&models.Image{}).
+			Where("url = ? AND storage = ? AND storage_profile_id = ? AND (thumbnail = '' OR thumbnail IS NULL)",
+				image.Url, image.Storage, image.StorageProfileId).
+			Update("thumbnail", loc.Thumbnail).Error
+	})
+}
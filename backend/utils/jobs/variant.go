@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/images"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/storage"
+
+	"gorm.io/gorm"
+)
+
+// VariantPayload 主图处理任务参数
+// 保存上传时的处理设置（不含凭据），任务执行前修改设置不影响已上传的图片
+type VariantPayload struct {
+	SaveWebp        bool    `json:"save_webp"`
+	OriginalImage   bool    `json:"original_image"`
+	WatermarkEnable bool    `json:"watermark_enable"`
+	WatermarkText   string  `json:"watermark_text"`
+	WatermarkPos    string  `json:"watermark_pos"`
+	WatermarkSize   int     `json:"watermark_size"`
+	WatermarkColor  string  `json:"watermark_color"`
+	WatermarkOpac   float64 `json:"watermark_opac"`
+	Thumbnail       bool    `json:"thumbnail"` // 处理完成后是否继续生成缩略图
+}
+
+// NewVariantPayload 由上传时的设置创建任务参数
+func NewVariantPayload(setting models.Settings) VariantPayload {
+	return VariantPayload{
+		SaveWebp:        setting.SaveWebp,
+		OriginalImage:   setting.OriginalImage,
+		WatermarkEnable: setting.WatermarkEnable,
+		WatermarkText:   setting.WatermarkText,
+		WatermarkPos:    setting.WatermarkPos,
+		WatermarkSize:   setting.WatermarkSize,
+		WatermarkColor:  setting.WatermarkColor,
+		WatermarkOpac:   setting.WatermarkOpac,
+		Thumbnail:       setting.Thumbnail,
+	}
+}
+
+// settings 还原为图片处理使用的设置
+func (p VariantPayload) settings() models.Settings {
+	return models.Settings{
+		SaveWebp:        p.SaveWebp,
+		OriginalImage:   p.OriginalImage,
+		WatermarkEnable: p.WatermarkEnable,
+		WatermarkText:   p.WatermarkText,
+		WatermarkPos:    p.WatermarkPos,
+		WatermarkSize:   p.WatermarkSize,
+		WatermarkColor:  p.WatermarkColor,
+		WatermarkOpac:   p.WatermarkOpac,
+	}
+}
+
+// runVariant 读取上传时原样保存的文件，添加水印、转换格式后覆盖写入同一对象键并回写图片记录
+// 完成后按上传时的设置继续创建缩略图任务
+func runVariant(ctx context.Context, job *models.Job) error {
+	var payload VariantPayload
+	if err := DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	db := database.GetDB().DB
+
+	var image models.Image
+	if err := db.First(&image, job.ImageId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 图片已删除，无需处理
+			return nil
+		}
+		return err
+	}
+	if !image.Processing {
+		return nil
+	}
+
+	setting, err := settings.ForImage(image)
+	if err != nil {
+		return err
+	}
+	backend, err := storage.New(image.Storage, setting)
+	if err != nil {
+		return err
+	}
+
+	obj, err := backend.Read(ctx, image)
+	if err != nil {
+		return err
+	}
+
+	// 记录中的MIME类型为处理后的格式，转换为WebP时按内容识别原始格式
+	mimeType := image.MimeType
+	if mimeType == "image/webp" {
+		mimeType = http.DetectContentType(obj.Data)
+	}
+	header := &multipart.FileHeader{
+		Filename: image.FileName,
+		Size:     int64(len(obj.Data)),
+		Header:   textproto.MIMEHeader{"Content-Type": {mimeType}},
+	}
+	processed, err := images.ImageSvc.ProcessBytes(obj.Data, header, payload.settings())
+	if err != nil {
+		return fmt.Errorf("处理图片失败：%w", err)
+	}
+
+	out := &storage.Object{
+		Key:      obj.Key,
+		FileName: obj.FileName,
+		MimeType: processed.MimeType,
+		Data:     processed.CompressedBytes,
+	}
+	loc, err := backend.Write(ctx, out)
+	if err != nil {
+		return err
+	}
+	if err := backend.Verify(ctx, out, loc); err != nil {
+		return err
+	}
+
+	// 多条记录共用同一对象时一并更新
+	err = db.Model(&models.Image{}).
+		Where("url = ? AND storage = ? AND storage_profile_id = ?", image.Url, image.Storage, image.StorageProfileId).
+		Updates(map[string]any{
+			"file_size":  len(processed.CompressedBytes),
+			"mime_type":  processed.MimeType,
+			"width":      processed.Width,
+			"height":     processed.Height,
+			"processing": false,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	if payload.Thumbnail && image.Thumbnail == "" {
+		_, err = Enqueue(models.JobTypeThumbnail, image.Id, image.UserId, nil)
+	}
+	return err
+}
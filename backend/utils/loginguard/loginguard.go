@@ -0,0 +1,163 @@
+package loginguard
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ipFactor 同一IP允许的失败次数是单个用户名的倍数（NAT 后可能有多个用户）
+	ipFactor = 4
+	// window 超过该时间没有新的失败则重新计数
+	window = 24 * time.Hour
+	// maxSubjectLength 用户名超出部分截断，与数据库字段长度一致
+	maxSubjectLength = 191
+)
+
+var (
+	maxFailures = 5
+	baseLockout = time.Minute
+	maxLockout  = time.Hour
+)
+
+// Init 设置锁定策略并定期清理过期记录
+// failures 为单个用户名连续失败多少次后开始锁定，之后每多失败一次锁定时长翻倍（不超过 max）
+func Init(failures int, base, max time.Duration) {
+	if failures > 0 {
+		maxFailures = failures
+	}
+	if base > 0 {
+		baseLockout = base
+	}
+	if max >= baseLockout {
+		maxLockout = max
+	}
+	go cleanup()
+}
+
+// Check 返回当前IP或用户名剩余的锁定时间，未锁定时为0
+func Check(ip, username string) time.Duration {
+	db := database.GetDB()
+	if db == nil {
+		return 0
+	}
+
+	now := time.Now()
+	var lockouts []models.LoginLockout
+	db.DB.Where("(kind = ? AND subject = ?) OR (kind = ? AND subject = ?)",
+		models.LockoutKindIP, ip, models.LockoutKindUsername, normalize(username)).
+		Where("locked_until > ?", now).
+		Find(&lockouts)
+
+	var wait time.Duration
+	for _, l := range lockouts {
+		if d := l.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Fail 记录一次登录失败（IP和用户名分别计数），返回因此触发的锁定时长
+func Fail(ip, username string) time.Duration {
+	wait := record(models.LockoutKindIP, ip, ip, maxFailures*ipFactor)
+	if username = normalize(username); username != "" {
+		if d := record(models.LockoutKindUsername, username, ip, maxFailures); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Succeed 登录成功后清除该用户名的失败计数
+// IP计数不清除，避免攻击者用自己的账号登录来重置对其他账号的猜测次数
+func Succeed(username string) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	db.DB.Where("kind = ? AND subject = ?", models.LockoutKindUsername, normalize(username)).
+		Delete(&models.LoginLockout{})
+}
+
+// lockoutDuration 第 failures 次失败后的锁定时长
+func lockoutDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := baseLockout
+	for i := threshold; i < failures && d < maxLockout; i++ {
+		d *= 2
+	}
+	return min(d, maxLockout)
+}
+
+// record 累加失败次数，达到阈值后设置锁定截止时间
+func record(kind, subject, ip string, threshold int) time.Duration {
+	db := database.GetDB()
+	if db == nil || subject == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	update := func(tx *gorm.DB) error {
+		now := time.Now()
+		var l models.LoginLockout
+		if err := tx.Where("kind = ? AND subject = ?", kind, subject).Limit(1).Find(&l).Error; err != nil {
+			return err
+		}
+		if l.Id == 0 {
+			l = models.LoginLockout{Kind: kind, Subject: subject}
+		} else if now.Sub(l.LastFailureAt) > window {
+			l.Failures = 0
+			l.LockedUntil = nil
+		}
+
+		l.Failures++
+		l.LastIP = ip
+		l.LastFailureAt = now
+		wait = lockoutDuration(l.Failures, threshold)
+		if wait > 0 {
+			until := now.Add(wait)
+			l.LockedUntil = &until
+		}
+		return tx.Save(&l).Error
+	}
+
+	// 并发的首次失败可能同时插入，唯一索引冲突时重试一次
+	err := db.DB.Transaction(update)
+	if err != nil {
+		err = db.DB.Transaction(update)
+	}
+	if err != nil {
+		log.Printf("记录登录失败次数失败：%v", err)
+	}
+	return wait
+}
+
+func normalize(username string) string {
+	username = strings.TrimSpace(username)
+	if len(username) > maxSubjectLength {
+		username = username[:maxSubjectLength]
+	}
+	return username
+}
+
+// cleanup 定期删除已过计数窗口且未锁定的记录
+func cleanup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		database.GetDB().DB.
+			Where("last_failure_at < ?", now.Add(-window)).
+			Where("locked_until IS NULL OR locked_until < ?", now).
+			Delete(&models.LoginLockout{})
+	}
+}
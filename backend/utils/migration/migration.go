@@ -0,0 +1,366 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/settings"
+	"oneimg/backend/utils/storage"
+
+	"gorm.io/gorm"
+)
+
+// batchSize 每批处理的图片数量
+const batchSize = 50
+
+var (
+	mu        sync.Mutex
+	activeId  int
+	cancelJob context.CancelFunc
+)
+
+// Start 创建并启动迁移任务（同一时间只允许一个任务运行）
+// 指定存储配置方案时，存储类型以方案为准
+func Start(source, target string, sourceProfileId, targetProfileId int, userId int) (*models.StorageMigration, error) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	target = strings.ToLower(strings.TrimSpace(target))
+
+	// 提前校验两端配置，避免任务启动后才失败
+	srcSetting, err := settings.ForStorage(source, sourceProfileId)
+	if err != nil {
+		return nil, fmt.Errorf("来源存储不可用：%w", err)
+	}
+	dstSetting, err := settings.ForStorage(target, targetProfileId)
+	if err != nil {
+		return nil, fmt.Errorf("目标存储不可用：%w", err)
+	}
+	if sourceProfileId > 0 {
+		source = srcSetting.GetEffectiveStorageType()
+	}
+	if targetProfileId > 0 {
+		target = dstSetting.GetEffectiveStorageType()
+	}
+
+	if source == "" || target == "" {
+		return nil, errors.New("来源存储和目标存储不能为空")
+	}
+	if source == target && sourceProfileId == targetProfileId {
+		return nil, errors.New("来源存储和目标存储不能相同")
+	}
+	if !storage.CanWrite(target) {
+		return nil, fmt.Errorf("存储类型 %s 不能作为迁移目标", target)
+	}
+	srcSetting.StorageType = source
+	dstSetting.StorageType = target
+	if _, err := storage.New(source, srcSetting); err != nil {
+		return nil, fmt.Errorf("来源存储不可用：%w", err)
+	}
+	if _, err := storage.New(target, dstSetting); err != nil {
+		return nil, fmt.Errorf("目标存储不可用：%w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if activeId != 0 {
+		return nil, errors.New("已有迁移任务正在运行")
+	}
+
+	db := database.GetDB().DB
+	var total int64
+	err = db.Model(&models.Image{}).
+		Where("storage = ? AND storage_profile_id = ?", source, sourceProfileId).
+		Count(&total).Error
+	if err != nil {
+		return nil, errors.New("统计待迁移图片失败")
+	}
+	if total == 0 {
+		return nil, errors.New("来源存储中没有需要迁移的图片")
+	}
+
+	job := &models.StorageMigration{
+		Source:          source,
+		Target:          target,
+		SourceProfileId: sourceProfileId,
+		TargetProfileId: targetProfileId,
+		Status:          models.MigrationRunning,
+		Total:           total,
+		CreatedBy:       userId,
+	}
+	if err := db.Create(job).Error; err != nil {
+		return nil, errors.New("创建迁移任务失败")
+	}
+
+	launch(job.Id)
+	return job, nil
+}
+
+// Resume 继续已中断（失败或取消）的迁移任务，从上次处理的位置开始
+func Resume(id int) (*models.StorageMigration, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if activeId != 0 {
+		return nil, errors.New("已有迁移任务正在运行")
+	}
+
+	db := database.GetDB().DB
+	var job models.StorageMigration
+	if err := db.First(&job, id).Error; err != nil {
+		return nil, errors.New("迁移任务不存在")
+	}
+	if job.Status == models.MigrationCompleted {
+		return nil, errors.New("迁移任务已完成")
+	}
+
+	job.Status = models.MigrationRunning
+	job.FinishedAt = nil
+	if err := db.Model(&job).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"finished_at": nil,
+	}).Error; err != nil {
+		return nil, errors.New("更新迁移任务失败")
+	}
+
+	launch(job.Id)
+	return &job, nil
+}
+
+// Cancel 取消正在运行的迁移任务，当前图片处理完后停止
+func Cancel(id int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if activeId == id && cancelJob != nil {
+		cancelJob()
+		return nil
+	}
+
+	// 任务不在内存中运行（例如进程重启前遗留的状态），直接标记为取消
+	db := database.GetDB().DB
+	var job models.StorageMigration
+	if err := db.First(&job, id).Error; err != nil {
+		return errors.New("迁移任务不存在")
+	}
+	if !job.IsActive() {
+		return errors.New("迁移任务未在运行")
+	}
+	return finish(db, job.Id, models.MigrationCancelled, "")
+}
+
+// IsRunning 指定任务是否正在当前进程中运行
+func IsRunning(id int) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return activeId == id
+}
+
+// ResumeInterrupted 服务启动时继续因进程退出而中断的迁移任务
+func ResumeInterrupted() {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+
+	var job models.StorageMigration
+	err := db.DB.Where("status IN ?", []string{models.MigrationPending, models.MigrationRunning}).
+		Order("id ASC").
+		First(&job).Error
+	if err != nil {
+		return
+	}
+
+	log.Printf("继续未完成的存储迁移任务 #%d（%s -> %s）", job.Id, job.Source, job.Target)
+	mu.Lock()
+	defer mu.Unlock()
+	launch(job.Id)
+}
+
+// launch 在后台运行任务，调用方需持有锁
+func launch(id int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	activeId = id
+	cancelJob = cancel
+
+	go func() {
+		defer func() {
+			mu.Lock()
+			activeId = 0
+			cancelJob = nil
+			mu.Unlock()
+			cancel()
+		}()
+		run(ctx, id)
+	}()
+}
+
+// run 执行迁移任务
+func run(ctx context.Context, id int) {
+	db := database.GetDB().DB
+
+	var job models.StorageMigration
+	if err := db.First(&job, id).Error; err != nil {
+		log.Printf("加载存储迁移任务 #%d 失败: %v", id, err)
+		return
+	}
+
+	src, err := newBackend(job.Source, job.SourceProfileId)
+	if err != nil {
+		finish(db, id, models.MigrationFailed, "来源存储不可用："+err.Error())
+		return
+	}
+	dst, err := newBackend(job.Target, job.TargetProfileId)
+	if err != nil {
+		finish(db, id, models.MigrationFailed, "目标存储不可用："+err.Error())
+		return
+	}
+	if job.Status != models.MigrationRunning {
+		db.Model(&job).Update("status", models.MigrationRunning)
+	}
+
+	for {
+		var batch []models.Image
+		err := db.Where("storage = ? AND storage_profile_id = ? AND id > ?", job.Source, job.SourceProfileId, job.LastImageId).
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil {
+			finish(db, id, models.MigrationFailed, "查询待迁移图片失败："+err.Error())
+			return
+		}
+		if len(batch) == 0 {
+			finish(db, id, models.MigrationCompleted, job.LastError)
+			log.Printf("存储迁移任务 #%d 完成：成功 %d，失败 %d", id, job.Migrated, job.Failed)
+			return
+		}
+
+		for _, image := range batch {
+			if ctx.Err() != nil {
+				finish(db, id, models.MigrationCancelled, job.LastError)
+				return
+			}
+
+			moved, err := migrateImage(ctx, db, src, dst, job.TargetProfileId, image)
+			if err != nil {
+				job.Failed++
+				job.LastError = fmt.Sprintf("图片 #%d：%v", image.Id, err)
+				log.Printf("存储迁移任务 #%d %s", id, job.LastError)
+			} else {
+				job.Migrated += moved
+			}
+			job.LastImageId = image.Id
+
+			// 每处理一张图片就保存进度，进程崩溃后可从断点继续
+			db.Model(&models.StorageMigration{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"migrated":      job.Migrated,
+				"failed":        job.Failed,
+				"last_image_id": job.LastImageId,
+				"last_error":    job.LastError,
+			})
+		}
+	}
+}
+
+// migrateImage 复制单张图片到目标存储并更新所有引用该文件的记录，返回更新的记录数
+// 来源文件保留不删除，确认迁移无误后可手动清理
+func migrateImage(ctx context.Context, db *gorm.DB, src, dst storage.Backend, targetProfileId int, image models.Image) (int64, error) {
+	// 后台任务会覆盖写入原存储中的文件，处理完成后再迁移
+	if image.Processing {
+		return 0, errors.New("图片处理中，请稍后重新迁移")
+	}
+
+	// 目标存储中已有相同内容（且处理设置相同）的文件时直接复用
+	if image.ContentHash != "" {
+		var existing models.Image
+		err := db.Where("content_hash = ? AND process_key = ? AND storage = ? AND storage_profile_id = ? AND processing = ?",
+			image.ContentHash, image.ProcessKey, dst.Name(), targetProfileId, false).
+			Order("id ASC").
+			First(&existing).Error
+		if err == nil {
+			return rewrite(db, image, dst.Name(), targetProfileId, &storage.Location{Url: existing.Url, Thumbnail: existing.Thumbnail})
+		}
+	}
+
+	obj, err := src.Read(ctx, image)
+	if err != nil {
+		return 0, err
+	}
+	if len(obj.Data) == 0 {
+		return 0, errors.New("来源文件为空")
+	}
+
+	loc, err := dst.Write(ctx, obj)
+	if err != nil {
+		return 0, err
+	}
+	if err := dst.Verify(ctx, obj, loc); err != nil {
+		return 0, err
+	}
+
+	// 原记录没有独立缩略图时沿用原图地址
+	if image.Thumbnail == image.Url || loc.Thumbnail == "" {
+		loc.Thumbnail = loc.Url
+	}
+	if image.Thumbnail == "" {
+		loc.Thumbnail = ""
+	}
+
+	return rewrite(db, image, dst.Name(), targetProfileId, loc)
+}
+
+// rewrite 在事务中更新存储、地址和缩略图，共享同一文件的记录一起更新
+func rewrite(db *gorm.DB, image models.Image, target string, targetProfileId int, loc *storage.Location) (int64, error) {
+	var affected int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if loc.Telegram != nil {
+			if err := tx.Where("file_name = ?", loc.Telegram.FileName).Delete(&models.ImageTeleGram{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(loc.Telegram).Error; err != nil {
+				return err
+			}
+		}
+
+		res := tx.Model(&models.Image{}).
+			Where("storage = ? AND storage_profile_id = ? AND url = ?", image.Storage, image.StorageProfileId, image.Url).
+			Updates(map[string]interface{}{
+				"storage":            target,
+				"storage_profile_id": targetProfileId,
+				"url":                loc.Url,
+				"thumbnail":          loc.Thumbnail,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		affected = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("更新图片记录失败：%w", err)
+	}
+	return affected, nil
+}
+
+// newBackend 按存储类型和配置方案创建存储后端
+func newBackend(storageType string, profileId int) (storage.Backend, error) {
+	setting, err := settings.ForStorage(storageType, profileId)
+	if err != nil {
+		return nil, err
+	}
+	return storage.New(storageType, setting)
+}
+
+// finish 结束任务并记录状态
+func finish(db *gorm.DB, id int, status, lastError string) error {
+	now := time.Now()
+	return db.Model(&models.StorageMigration{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"last_error":  lastError,
+		"finished_at": &now,
+	}).Error
+}
@@ -0,0 +1,315 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// discoveryTTL 发现文档和公钥的缓存时间
+	discoveryTTL = time.Hour
+	// jwksRefreshInterval 遇到未知公钥ID时重新获取公钥的最小间隔（身份提供方轮换密钥）
+	jwksRefreshInterval = time.Minute
+	// clockSkew 校验令牌时间时允许的时钟误差
+	clockSkew = time.Minute
+	// maxResponseSize 身份提供方响应的最大长度
+	maxResponseSize = 1 << 20
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Provider 身份提供方（从 /.well-known/openid-configuration 发现）
+type Provider struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+
+	fetchedAt time.Time
+	mu        sync.Mutex
+	keys      map[string]any // kid -> *rsa.PublicKey / *ecdsa.PublicKey
+	keysAt    time.Time
+}
+
+// Token 授权码换取的令牌
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Claims ID Token 及 UserInfo 中的声明
+type Claims map[string]any
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]*Provider{}
+)
+
+// Discover 获取身份提供方配置（按 issuer 缓存）
+func Discover(ctx context.Context, issuer string) (*Provider, error) {
+	issuer = strings.TrimSuffix(strings.TrimSpace(issuer), "/")
+	if issuer == "" {
+		return nil, fmt.Errorf("未配置 OIDC Issuer")
+	}
+
+	providersMu.Lock()
+	p, ok := providers[issuer]
+	providersMu.Unlock()
+	if ok && time.Since(p.fetchedAt) < discoveryTTL {
+		return p, nil
+	}
+
+	p = &Provider{}
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", "", p); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 配置失败：%v", err)
+	}
+	if strings.TrimSuffix(p.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC 配置中的 issuer（%s）与设置不一致", p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC 配置缺少必要的端点")
+	}
+	p.fetchedAt = time.Now()
+
+	providersMu.Lock()
+	providers[issuer] = p
+	providersMu.Unlock()
+	return p, nil
+}
+
+// AuthURL 构造授权请求地址（授权码模式 + PKCE S256）
+func (p *Provider) AuthURL(clientId, redirectURI string, scopes []string, state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", clientId)
+	v.Set("redirect_uri", redirectURI)
+	v.Set("scope", strings.Join(scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange 使用授权码和 PKCE 校验码换取令牌；clientSecret 为空时按公共客户端处理
+func (p *Provider) Exchange(ctx context.Context, clientId, clientSecret, redirectURI, code, verifier string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", verifier)
+
+	// 默认使用 client_secret_basic，提供方只支持 client_secret_post 时放在表单中
+	basic := clientSecret != ""
+	if basic && len(p.TokenAuthMethods) > 0 &&
+		!slices.Contains(p.TokenAuthMethods, "client_secret_basic") &&
+		slices.Contains(p.TokenAuthMethods, "client_secret_post") {
+		basic = false
+	}
+	if !basic && clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+	// 公共客户端必须携带 client_id，部分提供方使用 Basic 认证时同样要求
+	form.Set("client_id", clientId)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		// RFC 6749 2.3.1：客户端ID和密钥需先进行表单编码
+		req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌失败：%v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌响应失败：%v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.Unmarshal(body, &e)
+		if e.Error != "" {
+			return nil, fmt.Errorf("换取令牌失败：%s %s", e.Error, e.Description)
+		}
+		return nil, fmt.Errorf("换取令牌失败：HTTP %d", resp.StatusCode)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("令牌响应格式无效：%v", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("令牌响应中缺少 id_token，请确认 scope 包含 openid")
+	}
+	return &token, nil
+}
+
+// VerifyIDToken 校验 ID Token 的签名、签发者、受众、有效期和 nonce，返回其中的声明
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, clientId, nonce string) (Claims, error) {
+	claims, err := p.verifySignature(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return nil, fmt.Errorf("ID Token 签发者不匹配")
+	}
+	aud := claims.Strings("aud")
+	if !slices.Contains(aud, clientId) {
+		return nil, fmt.Errorf("ID Token 受众不匹配")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != clientId {
+		return nil, fmt.Errorf("ID Token 授权方不匹配")
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("ID Token 已过期")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("ID Token 签发时间无效")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("ID Token nonce 不匹配")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("ID Token 缺少 sub")
+	}
+	return claims, nil
+}
+
+// UserInfo 获取用户信息（UserInfo 端点返回的 sub 必须与 ID Token 一致）
+func (p *Provider) UserInfo(ctx context.Context, accessToken, sub string) (Claims, error) {
+	if p.UserinfoEndpoint == "" {
+		return nil, nil
+	}
+	var claims Claims
+	if err := getJSON(ctx, p.UserinfoEndpoint, accessToken, &claims); err != nil {
+		return nil, fmt.Errorf("获取用户信息失败：%v", err)
+	}
+	if got, _ := claims["sub"].(string); got != sub {
+		return nil, fmt.Errorf("用户信息 sub 不匹配")
+	}
+	return claims, nil
+}
+
+// NewVerifier 生成 PKCE 校验码（同样用于 state 和 nonce）
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge 计算 PKCE S256 挑战值
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// String 读取字符串声明，支持 "realm_access.roles" 形式的嵌套路径
+func (c Claims) String(path string) string {
+	switch v := c.lookup(path).(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Bool 读取布尔声明（部分提供方以字符串 "true" 返回 email_verified 等声明）
+func (c Claims) Bool(path string) bool {
+	switch v := c.lookup(path).(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Strings 读取字符串或字符串数组声明（如 groups、roles）
+func (c Claims) Strings(path string) []string {
+	switch v := c.lookup(path).(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (c Claims) lookup(path string) any {
+	if v, ok := c[path]; ok {
+		return v
+	}
+	var current any = map[string]any(c)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+// getJSON 请求并解析 JSON，accessToken 不为空时作为 Bearer 令牌
+func getJSON(ctx context.Context, endpoint, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,481 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testClientId     = "oneimg"
+	testClientSecret = "s3cret"
+	testRedirectURI  = "https://img.example.com/api/login/oidc/callback"
+)
+
+// testKey 测试用签名密钥
+type testKey struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+// testProvider 模拟身份提供方：发现文档、JWKS、令牌和用户信息端点
+type testProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	keys      []testKey // JWKS 中公布的公钥
+	signer    testKey   // 签发 ID Token 使用的密钥
+	codes     map[string]testCode
+	claims    map[string]any // 覆盖 ID Token 中的声明
+	jwksFetch atomic.Int32
+}
+
+type testCode struct {
+	nonce     string
+	challenge string
+}
+
+func newTestProvider(t *testing.T, signer testKey) *testProvider {
+	t.Helper()
+	p := &testProvider{t: t, keys: []testKey{signer}, signer: signer, codes: map[string]testCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/auth",
+			"token_endpoint":                        p.server.URL + "/token",
+			"userinfo_endpoint":                     p.server.URL + "/userinfo",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksFetch.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		keys := make([]map[string]any, 0, len(p.keys))
+		for _, k := range p.keys {
+			keys = append(keys, publicJWK(k))
+		}
+		writeJSON(w, map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, secret, _ := r.BasicAuth()
+		p.mu.Lock()
+		code, ok := p.codes[r.Form.Get("code")]
+		delete(p.codes, r.Form.Get("code"))
+		p.mu.Unlock()
+
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "invalid_grant", "error_description": "unknown code"})
+			return
+		case id != testClientId || secret != testClientSecret:
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, map[string]any{"error": "invalid_client"})
+			return
+		case Challenge(r.Form.Get("code_verifier")) != code.challenge:
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "at-alice",
+			"token_type":   "Bearer",
+			"id_token":     p.idToken(map[string]any{"nonce": code.nonce}),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at-alice" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, map[string]any{"sub": "sub-alice", "preferred_username": "alice", "groups": []string{"admins"}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize 模拟用户在身份提供方完成登录，返回授权码
+func (p *testProvider) authorize(authURL string) string {
+	p.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		p.t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+	code := "code-" + q.Get("state")
+	p.mu.Lock()
+	p.codes[code] = testCode{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	p.mu.Unlock()
+	return code
+}
+
+// idToken 使用当前签名密钥签发 ID Token，extra 与 p.claims 覆盖默认声明（值为 nil 时删除）
+func (p *testProvider) idToken(extra map[string]any) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now().Unix()
+	claims := map[string]any{
+		"iss": p.server.URL,
+		"sub": "sub-alice",
+		"aud": testClientId,
+		"exp": now + 300,
+		"iat": now,
+	}
+	for _, overrides := range []map[string]any{extra, p.claims} {
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+	}
+	return signJWT(p.t, p.signer, claims)
+}
+
+func (p *testProvider) discover(t *testing.T) *Provider {
+	t.Helper()
+	provider, err := Discover(context.Background(), p.server.URL)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	return provider
+}
+
+func newRSAKey(t *testing.T, kid, alg string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, alg: alg, key: key}
+}
+
+func newECKey(t *testing.T, kid, alg string, curve elliptic.Curve) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, alg: alg, key: key}
+}
+
+func publicJWK(k testKey) map[string]any {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pub := k.key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]any{"kid": k.kid, "kty": "RSA", "use": "sig", "alg": k.alg,
+			"n": enc(pub.N.Bytes()), "e": enc(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]any{"kid": k.kid, "kty": "EC", "use": "sig", "alg": k.alg,
+			"crv": pub.Curve.Params().Name, "x": enc(pub.X.FillBytes(make([]byte, size))), "y": enc(pub.Y.FillBytes(make([]byte, size)))}
+	}
+	return nil
+}
+
+func signJWT(t *testing.T, k testKey, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]any{"alg": k.alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var hash crypto.Hash
+	switch k.alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256([]byte(signed))
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384([]byte(signed))
+		digest = sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512([]byte(signed))
+		digest = sum[:]
+	}
+
+	var signature []byte
+	var err error
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		if strings.HasPrefix(k.alg, "PS") {
+			signature, err = rsa.SignPSS(rand.Reader, key, hash, digest, nil)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest)
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// TestAuthorizationCodeFlow 完整的授权码 + PKCE 流程
+func TestAuthorizationCodeFlow(t *testing.T) {
+	tp := newTestProvider(t, newRSAKey(t, "k1", "RS256"))
+	provider := tp.discover(t)
+
+	state, nonce, verifier := "state-1", "nonce-1", "verifier-0123456789-0123456789-0123456789"
+	authURL := provider.AuthURL(testClientId, testRedirectURI, []string{"openid", "profile"}, state, nonce, verifier)
+	q, _ := url.ParseQuery(authURL[strings.Index(authURL, "?")+1:])
+	if q.Get("code_challenge") != Challenge(verifier) || q.Get("redirect_uri") != testRedirectURI || q.Get("nonce") != nonce {
+		t.Fatalf("unexpected auth URL: %s", authURL)
+	}
+
+	code := tp.authorize(authURL)
+	token, err := provider.Exchange(context.Background(), testClientId, testClientSecret, testRedirectURI, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), token.IDToken, testClientId, nonce)
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.String("sub") != "sub-alice" {
+		t.Fatalf("sub = %q", claims.String("sub"))
+	}
+
+	info, err := provider.UserInfo(context.Background(), token.AccessToken, "sub-alice")
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if info.String("preferred_username") != "alice" || info.Strings("groups")[0] != "admins" {
+		t.Fatalf("unexpected userinfo: %v", info)
+	}
+	if _, err := provider.UserInfo(context.Background(), token.AccessToken, "sub-bob"); err == nil {
+		t.Fatal("UserInfo accepted a mismatched sub")
+	}
+}
+
+// TestExchangeRejectsWrongVerifier PKCE 校验码不匹配时换取令牌失败
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	tp := newTestProvider(t, newRSAKey(t, "k1", "RS256"))
+	provider := tp.discover(t)
+
+	code := tp.authorize(provider.AuthURL(testClientId, testRedirectURI, []string{"openid"}, "s", "n", "right-verifier"))
+	_, err := provider.Exchange(context.Background(), testClientId, testClientSecret, testRedirectURI, code, "wrong-verifier")
+	if err == nil || !strings.Contains(err.Error(), "PKCE") {
+		t.Fatalf("Exchange error = %v, want PKCE failure", err)
+	}
+}
+
+// TestVerifyIDTokenClaims 签发者、受众、授权方、有效期和 nonce 校验
+func TestVerifyIDTokenClaims(t *testing.T) {
+	tp := newTestProvider(t, newRSAKey(t, "k1", "RS256"))
+	provider := tp.discover(t)
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		nonce   string
+		wantErr string
+	}{
+		{name: "valid", claims: map[string]any{"nonce": "n"}, nonce: "n"},
+		{name: "audience array", claims: map[string]any{"nonce": "n", "aud": []string{"other", testClientId}, "azp": testClientId}, nonce: "n"},
+		{name: "nonce mismatch", claims: map[string]any{"nonce": "other"}, nonce: "n", wantErr: "nonce"},
+		{name: "nonce missing", claims: map[string]any{}, nonce: "n", wantErr: "nonce"},
+		{name: "wrong audience", claims: map[string]any{"nonce": "n", "aud": "other"}, nonce: "n", wantErr: "受众"},
+		{name: "wrong azp", claims: map[string]any{"nonce": "n", "aud": []string{"other", testClientId}, "azp": "other"}, nonce: "n", wantErr: "授权方"},
+		{name: "wrong issuer", claims: map[string]any{"nonce": "n", "iss": "https://evil.example.com"}, nonce: "n", wantErr: "签发者"},
+		{name: "expired", claims: map[string]any{"nonce": "n", "exp": now - 120}, nonce: "n", wantErr: "过期"},
+		{name: "expired within skew", claims: map[string]any{"nonce": "n", "exp": now - 30}, nonce: "n"},
+		{name: "missing exp", claims: map[string]any{"nonce": "n", "exp": nil}, nonce: "n", wantErr: "过期"},
+		{name: "issued in future", claims: map[string]any{"nonce": "n", "iat": now + 600}, nonce: "n", wantErr: "签发时间"},
+		{name: "missing sub", claims: map[string]any{"nonce": "n", "sub": nil}, nonce: "n", wantErr: "sub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), tp.idToken(tt.claims), testClientId, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestVerifySignatureAlgorithms RS/PS/ES 签名算法
+func TestVerifySignatureAlgorithms(t *testing.T) {
+	keys := []testKey{
+		newRSAKey(t, "rs256", "RS256"),
+		newRSAKey(t, "rs512", "RS512"),
+		newRSAKey(t, "ps256", "PS256"),
+		newECKey(t, "es256", "ES256", elliptic.P256()),
+		newECKey(t, "es384", "ES384", elliptic.P384()),
+		newECKey(t, "es512", "ES512", elliptic.P521()),
+	}
+	for _, key := range keys {
+		t.Run(key.alg, func(t *testing.T) {
+			tp := newTestProvider(t, key)
+			provider := tp.discover(t)
+			if _, err := provider.VerifyIDToken(context.Background(), tp.idToken(map[string]any{"nonce": "n"}), testClientId, "n"); err != nil {
+				t.Fatalf("VerifyIDToken: %v", err)
+			}
+		})
+	}
+}
+
+// TestVerifySignatureRejectsForgery 篡改载荷、伪造签名以及 none / HMAC 算法均被拒绝
+func TestVerifySignatureRejectsForgery(t *testing.T) {
+	signer := newRSAKey(t, "k1", "RS256")
+	tp := newTestProvider(t, signer)
+	provider := tp.discover(t)
+	valid := tp.idToken(map[string]any{"nonce": "n"})
+	parts := strings.Split(valid, ".")
+
+	tampered, _ := json.Marshal(map[string]any{"iss": tp.server.URL, "sub": "sub-admin", "aud": testClientId,
+		"exp": time.Now().Unix() + 300, "nonce": "n"})
+	otherKey := newRSAKey(t, "k1", "RS256")
+
+	tests := map[string]string{
+		"tampered payload": parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2],
+		"wrong key":        signJWT(t, otherKey, map[string]any{"iss": tp.server.URL, "sub": "sub-alice", "aud": testClientId, "exp": time.Now().Unix() + 300, "nonce": "n"}),
+		"alg none":         jwtWithHeader(map[string]any{"alg": "none", "kid": "k1"}, parts[1], ""),
+		"alg HS256":        jwtWithHeader(map[string]any{"alg": "HS256", "kid": "k1"}, parts[1], parts[2]),
+		"alg mismatch":     jwtWithHeader(map[string]any{"alg": "ES256", "kid": "k1"}, parts[1], parts[2]),
+		"malformed":        parts[0] + "." + parts[1],
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := provider.VerifyIDToken(context.Background(), token, testClientId, "n"); err == nil {
+				t.Fatal("forged token accepted")
+			}
+		})
+	}
+}
+
+func jwtWithHeader(header map[string]any, payload, signature string) string {
+	h, _ := json.Marshal(header)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + payload + "." + signature
+}
+
+// TestKeyRotation 身份提供方轮换密钥后，遇到未知 kid 时重新获取公钥（限制频率）
+func TestKeyRotation(t *testing.T) {
+	oldKey := newRSAKey(t, "old", "RS256")
+	newKey := newECKey(t, "new", "ES256", elliptic.P256())
+	tp := newTestProvider(t, oldKey)
+	provider := tp.discover(t)
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, tp.idToken(map[string]any{"nonce": "n"}), testClientId, "n"); err != nil {
+		t.Fatalf("VerifyIDToken with old key: %v", err)
+	}
+	if got := tp.jwksFetch.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+
+	// 公布新密钥并改用新密钥签发
+	tp.mu.Lock()
+	tp.keys = []testKey{oldKey, newKey}
+	tp.signer = newKey
+	tp.mu.Unlock()
+
+	// 刚获取过公钥，不会立即重新获取
+	if _, err := provider.VerifyIDToken(ctx, tp.idToken(map[string]any{"nonce": "n"}), testClientId, "n"); err == nil {
+		t.Fatal("unknown kid accepted before refresh")
+	}
+	if got := tp.jwksFetch.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times within refresh interval, want 1", got)
+	}
+
+	// 超过最小间隔后遇到未知 kid 重新获取
+	provider.mu.Lock()
+	provider.keysAt = time.Now().Add(-2 * jwksRefreshInterval)
+	provider.mu.Unlock()
+	if _, err := provider.VerifyIDToken(ctx, tp.idToken(map[string]any{"nonce": "n"}), testClientId, "n"); err != nil {
+		t.Fatalf("VerifyIDToken with rotated key: %v", err)
+	}
+	if got := tp.jwksFetch.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", got)
+	}
+
+	// 旧密钥撤下后，旧密钥签发的令牌在公钥缓存过期后不再有效
+	tp.mu.Lock()
+	tp.keys = []testKey{newKey}
+	tp.signer = oldKey
+	tp.mu.Unlock()
+	provider.mu.Lock()
+	provider.keysAt = time.Now().Add(-2 * discoveryTTL)
+	provider.mu.Unlock()
+	if _, err := provider.VerifyIDToken(ctx, tp.idToken(map[string]any{"nonce": "n"}), testClientId, "n"); err == nil {
+		t.Fatal("token signed with a revoked key accepted")
+	}
+}
+
+// TestDiscoverIssuerMismatch 发现文档中的 issuer 必须与配置一致
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": "https://evil.example.com/auth",
+			"token_endpoint":         "https://evil.example.com/token",
+			"jwks_uri":               "https://evil.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+
+	if _, err := Discover(context.Background(), server.URL); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Fatalf("Discover error = %v, want issuer mismatch", err)
+	}
+}
+
+// TestClaimsBool 布尔声明兼容字符串形式
+func TestClaimsBool(t *testing.T) {
+	claims := Claims{"a": true, "b": "true", "c": false, "d": "false", "e": 1.0}
+	for path, want := range map[string]bool{"a": true, "b": true, "c": false, "d": false, "e": false, "missing": false} {
+		if got := claims.Bool(path); got != want {
+			t.Errorf("Bool(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
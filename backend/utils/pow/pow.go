@@ -0,0 +1,158 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/bits"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+)
+
+// 挑战的使用场景，签发时写入挑战，校验时必须一致
+const (
+	ScopeLogin  = "login"
+	ScopeUpload = "upload"
+)
+
+const (
+	// Algorithm 求解方式：SHA-256(challenge + ":" + nonce) 的前 difficulty 位为0
+	Algorithm = "sha256"
+	// TTL 挑战有效期
+	TTL = 5 * time.Minute
+	// MinDifficulty / MaxDifficulty 难度（前导零位数）范围，每增加1位平均计算量翻倍
+	MinDifficulty = 1
+	MaxDifficulty = 30
+	// maxNonceLength 解答的最大长度
+	maxNonceLength = 64
+)
+
+var (
+	ErrMissing = errors.New("请完成工作量证明验证")
+	ErrInvalid = errors.New("工作量证明验证失败，请重新获取挑战")
+	ErrExpired = errors.New("工作量证明挑战已过期，请重新获取")
+	ErrReused  = errors.New("工作量证明挑战已使用，请重新获取")
+)
+
+var key []byte
+
+// payload 挑战内容（签名后下发，服务端不保存未使用的挑战）
+type payload struct {
+	Id         string `json:"id"`
+	Scope      string `json:"s"`
+	Difficulty int    `json:"d"`
+	Expires    int64  `json:"e"`
+}
+
+// Init 设置签名密钥并定期清理已过期的使用记录
+func Init(secret string) {
+	sum := sha256.Sum256([]byte("pow:" + secret))
+	key = sum[:]
+	go cleanup()
+}
+
+// Issue 签发挑战
+func Issue(scope string, difficulty int) (string, time.Time, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(TTL)
+	data, _ := json.Marshal(payload{
+		Id:         hex.EncodeToString(id),
+		Scope:      scope,
+		Difficulty: clamp(difficulty),
+		Expires:    expires.Unix(),
+	})
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded)), expires, nil
+}
+
+// Verify 校验解答，成功后挑战作废（同一挑战只能使用一次）
+// minDifficulty 为当前设置的难度，调高难度后按旧难度签发的挑战不再有效
+func Verify(challenge, nonce, scope string, minDifficulty int) error {
+	if challenge == "" || nonce == "" {
+		return ErrMissing
+	}
+	if len(nonce) > maxNonceLength {
+		return ErrInvalid
+	}
+
+	encoded, sig, ok := strings.Cut(challenge, ".")
+	if !ok {
+		return ErrInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, sign(encoded)) {
+		return ErrInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalid
+	}
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return ErrInvalid
+	}
+
+	expires := time.Unix(p.Expires, 0)
+	if time.Now().After(expires) {
+		return ErrExpired
+	}
+	if p.Scope != scope || p.Difficulty < clamp(minDifficulty) {
+		return ErrInvalid
+	}
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	if leadingZeros(sum[:]) < p.Difficulty {
+		return ErrInvalid
+	}
+
+	// 主键冲突说明已被使用（多实例部署时同样有效）
+	db := database.GetDB()
+	if db == nil {
+		return ErrInvalid
+	}
+	if err := db.DB.Create(&models.PowChallenge{Id: p.Id, ExpiresAt: expires}).Error; err != nil {
+		return ErrReused
+	}
+	return nil
+}
+
+// clamp 将难度限制在允许范围内
+func clamp(difficulty int) int {
+	return min(max(difficulty, MinDifficulty), MaxDifficulty)
+}
+
+func sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// leadingZeros 计算前导零位数
+func leadingZeros(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// cleanup 定期删除已过期的挑战使用记录（过期的挑战本身已无法通过校验）
+func cleanup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		database.GetDB().DB.Where("expires_at < ?", time.Now()).Delete(&models.PowChallenge{})
+	}
+}
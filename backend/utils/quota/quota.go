@@ -0,0 +1,68 @@
+package quota
+
+import (
+	"fmt"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+)
+
+// GetUser 获取注册用户（游客没有数据库记录，返回nil）
+func GetUser(userId int, role int) *models.User {
+	if role == models.RoleTourist {
+		return nil
+	}
+	db := database.GetDB()
+	if db == nil {
+		return nil
+	}
+	var user models.User
+	if err := db.DB.First(&user, userId).Error; err != nil {
+		return nil
+	}
+	return &user
+}
+
+// EffectiveMaxFileSize 获取用户生效的单文件大小上限
+// 优先级：用户覆盖配置 > 系统设置 > 环境变量
+func EffectiveMaxFileSize(user *models.User, settingMax int64, envMax int64) int64 {
+	if user != nil && user.MaxFileSize > 0 {
+		return user.MaxFileSize
+	}
+	if settingMax > 0 {
+		return settingMax
+	}
+	return envMax
+}
+
+// UsedStorage 统计用户已使用的存储空间（字节）
+func UsedStorage(userId int) (int64, error) {
+	db := database.GetDB()
+	if db == nil {
+		return 0, fmt.Errorf("数据库未初始化")
+	}
+	var used struct {
+		Total int64
+	}
+	err := db.DB.Model(&models.Image{}).
+		Where("user_id = ?", userId).
+		Select("COALESCE(SUM(file_size), 0) as total").
+		Scan(&used).Error
+	return used.Total, err
+}
+
+// CheckStorageQuota 校验上传 incoming 字节后是否超出用户存储配额
+func CheckStorageQuota(user *models.User, incoming int64) error {
+	if user == nil || user.StorageQuota <= 0 {
+		return nil
+	}
+	used, err := UsedStorage(user.Id)
+	if err != nil {
+		return fmt.Errorf("统计已用空间失败：%v", err)
+	}
+	if used+incoming > user.StorageQuota {
+		return fmt.Errorf("存储空间不足（已用 %.2f MB / 配额 %.2f MB）",
+			float64(used)/1024/1024, float64(user.StorageQuota)/1024/1024)
+	}
+	return nil
+}
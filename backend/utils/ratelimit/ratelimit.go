@@ -0,0 +1,402 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// 限流规则名称：注册用户按角色，游客另按IP汇总（游客可随时更换身份），Telegram 按 Chat ID
+const (
+	RuleAdmin    = "admin"
+	RuleEditor   = "editor"
+	RuleUploader = "uploader"
+	RuleTourist  = "tourist"
+	RuleIP       = "ip"
+	RuleTelegram = "telegram"
+)
+
+const (
+	// idleTTL 计数已恢复满额且超过该时间未使用的桶会被清理
+	idleTTL = time.Hour
+	// contextKey 本次请求的限流对象，保存后用于按实际上传大小扣减
+	contextKey = "rate_limit_subjects"
+)
+
+var roleRules = map[int]string{
+	models.RoleAdmin:    RuleAdmin,
+	models.RoleEditor:   RuleEditor,
+	models.RoleUploader: RuleUploader,
+	models.RoleTourist:  RuleTourist,
+}
+
+// Rule 限流规则，0 表示不限制
+type Rule struct {
+	Requests int   `json:"requests_per_minute"` // 每分钟请求数
+	Bytes    int64 `json:"bytes_per_day"`       // 每日上传字节数
+}
+
+// Subject 限流对象
+type Subject struct {
+	Key   string // 桶的键，如 user:1、tourist:<uuid>、ip:1.2.3.4
+	Rule  string
+	Limit Rule
+}
+
+// bucket 令牌桶：请求数按每分钟、字节数按每24小时匀速恢复
+type bucket struct {
+	rule     string
+	limit    Rule
+	requests float64
+	bytes    float64
+	updated  time.Time
+	lastUsed time.Time
+}
+
+// Counter 计数快照（管理员查看）
+type Counter struct {
+	Key               string    `json:"key"`
+	Rule              string    `json:"rule"`
+	RequestsPerMinute int       `json:"requests_per_minute"`
+	RequestsAvailable int       `json:"requests_available"`
+	BytesPerDay       int64     `json:"bytes_per_day"`
+	BytesAvailable    int64     `json:"bytes_available"`
+	LastUsed          time.Time `json:"last_used"`
+}
+
+var (
+	mu      sync.Mutex
+	buckets = map[string]*bucket{}
+)
+
+// Init 加载持久化的上传量计数并启动过期计数清理
+// 上传量计数同时写入数据库，重启后仍然有效；请求频率计数只保存在内存中，重启后恢复满额
+func Init() {
+	load()
+	go cleanup()
+}
+
+// ParseRules 解析规则，格式：规则名=每分钟请求数/每日上传量，多个用逗号分隔
+// 上传量支持 KB/MB/GB/TB 后缀，0 表示不限制，如 tourist=10/100MB,ip=30/500MB,uploader=60/0
+func ParseRules(rules string) (map[string]Rule, error) {
+	result := map[string]Rule{}
+	for _, item := range strings.Split(rules, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("限流规则格式错误：%s（应为 规则名=请求数/上传量）", item)
+		}
+		switch name {
+		case RuleAdmin, RuleEditor, RuleUploader, RuleTourist, RuleIP, RuleTelegram:
+		default:
+			return nil, fmt.Errorf("未知的限流规则：%s", name)
+		}
+
+		requests, bytes, _ := strings.Cut(value, "/")
+		var rule Rule
+		var err error
+		if rule.Requests, err = strconv.Atoi(strings.TrimSpace(requests)); err != nil || rule.Requests < 0 {
+			return nil, fmt.Errorf("限流规则 %s 的请求数无效：%s", name, requests)
+		}
+		if rule.Bytes, err = parseSize(bytes); err != nil {
+			return nil, fmt.Errorf("限流规则 %s 的上传量无效：%s", name, bytes)
+		}
+		result[name] = rule
+	}
+	return result, nil
+}
+
+// Subjects 当前请求的限流对象：注册用户（含API令牌）按用户，游客按身份和IP
+func Subjects(c *gin.Context, rules map[string]Rule) []Subject {
+	role := c.GetInt("user_role")
+	if role == models.RoleTourist {
+		return compact(rules,
+			Subject{Key: "tourist:" + c.GetString("username"), Rule: RuleTourist},
+			Subject{Key: "ip:" + c.ClientIP(), Rule: RuleIP},
+		)
+	}
+	return compact(rules, Subject{Key: fmt.Sprintf("user:%d", c.GetInt("user_id")), Rule: roleRules[role]})
+}
+
+// TelegramSubjects Telegram Bot 上传的限流对象
+func TelegramSubjects(chatID int64, rules map[string]Rule) []Subject {
+	return compact(rules, Subject{Key: fmt.Sprintf("telegram:%d", chatID), Rule: RuleTelegram})
+}
+
+// Allow 检查并占用一次请求，超出限制时返回需要等待的时间（不占用）
+// 上传量在请求前只检查是否已用尽，上传完成后通过 Consume 按实际大小扣减
+func Allow(subjects []Subject) time.Duration {
+	if len(subjects) == 0 {
+		return 0
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	list := make([]*bucket, len(subjects))
+	for i, s := range subjects {
+		b := get(s, now)
+		list[i] = b
+		if s.Limit.Requests > 0 && b.requests < 1 {
+			wait = max(wait, refillTime(1-b.requests, float64(s.Limit.Requests)/60))
+		}
+		if s.Limit.Bytes > 0 && b.bytes < 1 {
+			wait = max(wait, refillTime(1-b.bytes, float64(s.Limit.Bytes)/86400))
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	for i, b := range list {
+		if subjects[i].Limit.Requests > 0 {
+			b.requests--
+		}
+		b.lastUsed = now
+	}
+	return 0
+}
+
+// Consume 按实际上传大小扣减上传量（可扣为负数，之后的请求需等待恢复）
+func Consume(subjects []Subject, size int64) {
+	if len(subjects) == 0 || size <= 0 {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	usages := make([]models.RateLimitUsage, 0, len(subjects))
+	for _, s := range subjects {
+		if s.Limit.Bytes > 0 {
+			b := get(s, now)
+			b.bytes -= float64(size)
+			usages = append(usages, b.usage(s.Key))
+		}
+	}
+	save(usages)
+}
+
+// Bind 保存本次请求的限流对象
+func Bind(c *gin.Context, subjects []Subject) {
+	c.Set(contextKey, subjects)
+}
+
+// ConsumeRequest 按本次请求绑定的限流对象扣减上传量
+func ConsumeRequest(c *gin.Context, size int64) {
+	if subjects, ok := c.Get(contextKey); ok {
+		Consume(subjects.([]Subject), size)
+	}
+}
+
+// Snapshot 当前所有计数（prefix 按键前缀筛选，如 ip:、tourist:）
+func Snapshot(prefix string) []Counter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	counters := make([]Counter, 0, len(buckets))
+	for key, b := range buckets {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		b.refill(now)
+		counters = append(counters, Counter{
+			Key:               key,
+			Rule:              b.rule,
+			RequestsPerMinute: b.limit.Requests,
+			RequestsAvailable: int(math.Floor(b.requests)),
+			BytesPerDay:       b.limit.Bytes,
+			BytesAvailable:    int64(math.Floor(b.bytes)),
+			LastUsed:          b.lastUsed,
+		})
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].LastUsed.After(counters[j].LastUsed) })
+	return counters
+}
+
+// Reset 清除计数（恢复满额），key 为空时清除全部，返回清除的数量
+func Reset(key string) int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if key == "" {
+		n := len(buckets)
+		buckets = map[string]*bucket{}
+		remove()
+		return n
+	}
+	if _, ok := buckets[key]; !ok {
+		return 0
+	}
+	delete(buckets, key)
+	remove(key)
+	return 1
+}
+
+// compact 填入规则并去掉不限制的对象
+func compact(rules map[string]Rule, subjects ...Subject) []Subject {
+	result := subjects[:0]
+	for _, s := range subjects {
+		limit, ok := rules[s.Rule]
+		if !ok || (limit.Requests == 0 && limit.Bytes == 0) {
+			continue
+		}
+		s.Limit = limit
+		result = append(result, s)
+	}
+	return result
+}
+
+// get 获取或创建桶（调用方持有锁），新建的桶为满额
+func get(s Subject, now time.Time) *bucket {
+	b, ok := buckets[s.Key]
+	if !ok {
+		b = &bucket{requests: float64(s.Limit.Requests), bytes: float64(s.Limit.Bytes), updated: now, lastUsed: now}
+		buckets[s.Key] = b
+	}
+	b.rule = s.Rule
+	b.limit = s.Limit
+	b.refill(now)
+	return b
+}
+
+// refill 按经过的时间恢复额度（规则调低后同时收紧到新的上限）
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.updated = now
+	b.requests = min(b.requests+elapsed*float64(b.limit.Requests)/60, float64(b.limit.Requests))
+	b.bytes = min(b.bytes+elapsed*float64(b.limit.Bytes)/86400, float64(b.limit.Bytes))
+}
+
+// usage 桶的上传量计数（调用方持有锁）
+func (b *bucket) usage(key string) models.RateLimitUsage {
+	return models.RateLimitUsage{
+		Key:               key,
+		Rule:              b.rule,
+		RequestsPerMinute: b.limit.Requests,
+		BytesPerDay:       b.limit.Bytes,
+		BytesAvailable:    b.bytes,
+		RefilledAt:        b.updated,
+		LastUsed:          b.lastUsed,
+	}
+}
+
+// load 从数据库恢复上传量计数，请求频率恢复满额
+func load() {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	var usages []models.RateLimitUsage
+	if err := db.DB.Find(&usages).Error; err != nil {
+		log.Printf("加载上传限流计数失败：%v", err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, u := range usages {
+		buckets[u.Key] = &bucket{
+			rule:     u.Rule,
+			limit:    Rule{Requests: u.RequestsPerMinute, Bytes: u.BytesPerDay},
+			requests: float64(u.RequestsPerMinute),
+			bytes:    u.BytesAvailable,
+			updated:  u.RefilledAt,
+			lastUsed: u.LastUsed,
+		}
+	}
+}
+
+// save 写入上传量计数（调用方持有锁，保证与内存中的顺序一致）
+func save(usages []models.RateLimitUsage) {
+	db := database.GetDB()
+	if db == nil || len(usages) == 0 {
+		return
+	}
+	if err := db.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&usages).Error; err != nil {
+		log.Printf("保存上传限流计数失败：%v", err)
+	}
+}
+
+// remove 删除上传量计数，未指定键时删除全部
+func remove(keys ...string) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	query := db.DB.Where("1 = 1")
+	if len(keys) > 0 {
+		query = db.DB.Where("bucket_key IN ?", keys)
+	}
+	if err := query.Delete(&models.RateLimitUsage{}).Error; err != nil {
+		log.Printf("删除上传限流计数失败：%v", err)
+	}
+}
+
+// refillTime 恢复 amount 额度需要的时间
+func refillTime(amount, perSecond float64) time.Duration {
+	return time.Duration(math.Ceil(amount/perSecond)) * time.Second
+}
+
+// parseSize 解析上传量，如 500MB、2GB、1048576
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小：%s", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// cleanup 定期清理已恢复满额且长时间未使用的桶
+func cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		mu.Lock()
+		now := time.Now()
+		var removed []string
+		for key, b := range buckets {
+			b.refill(now)
+			if now.Sub(b.lastUsed) > idleTTL &&
+				b.requests >= float64(b.limit.Requests) && b.bytes >= float64(b.limit.Bytes) {
+				delete(buckets, key)
+				removed = append(removed, key)
+			}
+		}
+		if len(removed) > 0 {
+			remove(removed...)
+		}
+		mu.Unlock()
+	}
+}
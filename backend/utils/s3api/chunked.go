@@ -0,0 +1,133 @@
+package s3api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxChunkSize 单个 aws-chunked 分块的上限，防止恶意请求占用内存
+const maxChunkSize = 16 << 20
+
+// hashingReader 读取结束时校验请求体的 SHA-256
+type hashingReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected string
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.h.Sum(nil)) != h.expected {
+		return n, ErrContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader 解码 aws-chunked 请求体
+// sig 不为空时校验每个分块的签名（STREAMING-AWS4-HMAC-SHA256-PAYLOAD）
+type chunkedReader struct {
+	r       *bufio.Reader
+	sig     *Signature
+	key     []byte
+	prevSig string
+	buf     []byte
+	done    bool
+	err     error
+}
+
+func newChunkedReader(body io.Reader, sig *Signature, key []byte) *chunkedReader {
+	cr := &chunkedReader{r: bufio.NewReader(body), sig: sig, key: key}
+	if sig != nil {
+		cr.prevSig = sig.Signature
+	}
+	return cr
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		if cr.done {
+			return 0, io.EOF
+		}
+		cr.err = cr.nextChunk()
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// nextChunk 读取一个分块：<十六进制长度>[;chunk-signature=<签名>]\r\n<数据>\r\n
+func (cr *chunkedReader) nextChunk() error {
+	line, err := cr.readLine()
+	if err != nil {
+		return err
+	}
+	sizeStr, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return ErrIncompleteBody.WithMessage("aws-chunked 分块格式错误")
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		return ErrIncompleteBody
+	}
+
+	if cr.sig != nil {
+		chunkSig, ok := strings.CutPrefix(strings.TrimSpace(ext), "chunk-signature=")
+		if !ok {
+			return ErrSignatureDoesNotMatch
+		}
+		stringToSign := strings.Join([]string{
+			Algorithm + "-PAYLOAD",
+			cr.sig.AmzDate,
+			cr.sig.Scope(),
+			cr.prevSig,
+			emptyPayloadSHA256,
+			sha256Hex(data),
+		}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(cr.key, []byte(stringToSign)))
+		if !hmac.Equal([]byte(expected), []byte(chunkSig)) {
+			return ErrSignatureDoesNotMatch
+		}
+		cr.prevSig = chunkSig
+	}
+
+	if size == 0 {
+		// 最后一个分块之后可能跟随校验和等尾部字段，读到空行为止
+		for {
+			trailer, err := cr.readLine()
+			if err != nil || trailer == "" {
+				break
+			}
+		}
+		cr.done = true
+		return nil
+	}
+
+	if crlf, err := cr.readLine(); err != nil || crlf != "" {
+		return ErrIncompleteBody.WithMessage("aws-chunked 分块格式错误")
+	}
+	cr.buf = data
+	return nil
+}
+
+func (cr *chunkedReader) readLine() (string, error) {
+	line, err := cr.r.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", ErrIncompleteBody
+		}
+		return "", err
+	}
+	return string(bytes.TrimRight(line, "\r\n")), nil
+}
@@ -0,0 +1,256 @@
+package s3api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SigV4 相关常量
+const (
+	Algorithm          = "AWS4-HMAC-SHA256"
+	UnsignedPayload    = "UNSIGNED-PAYLOAD"
+	StreamingPayload   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	StreamingTrailer   = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	MaxClockSkew       = 15 * time.Minute
+	MaxPresignExpires  = 7 * 24 * time.Hour
+	amzDateFormat      = "20060102T150405Z"
+	emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Signature 从请求中解析出的签名信息
+type Signature struct {
+	AccessKeyId   string
+	Date          string // 凭据日期（yyyymmdd）
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+	AmzDate       string // 请求时间（ISO8601 基本格式）
+	PayloadHash   string
+	Presigned     bool
+}
+
+// Scope 凭据范围
+func (s *Signature) Scope() string {
+	return s.Date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+// ParseSignature 解析 Authorization 头或预签名URL中的签名信息，并校验请求时间
+func ParseSignature(r *http.Request) (*Signature, error) {
+	if query := r.URL.Query(); query.Get("X-Amz-Algorithm") != "" {
+		return parsePresigned(query)
+	}
+
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, ErrAccessDenied.WithMessage("缺少签名信息")
+	}
+	rest, ok := strings.CutPrefix(auth, Algorithm+" ")
+	if !ok {
+		return nil, ErrSignatureVersion
+	}
+
+	sig := &Signature{}
+	for _, field := range strings.Split(rest, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			if err := sig.parseCredential(value); err != nil {
+				return nil, err
+			}
+		case "SignedHeaders":
+			sig.SignedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.Signature = value
+		}
+	}
+	if sig.AccessKeyId == "" || len(sig.SignedHeaders) == 0 || sig.Signature == "" {
+		return nil, ErrAuthorizationHeaderMalformed
+	}
+
+	sig.AmzDate = r.Header.Get("X-Amz-Date")
+	requestTime, err := time.Parse(amzDateFormat, sig.AmzDate)
+	if err != nil {
+		return nil, ErrAccessDenied.WithMessage("X-Amz-Date 无效")
+	}
+	if skew := time.Since(requestTime); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return nil, ErrRequestTimeTooSkewed
+	}
+	if !strings.HasPrefix(sig.AmzDate, sig.Date) {
+		return nil, ErrAuthorizationHeaderMalformed
+	}
+
+	sig.PayloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if sig.PayloadHash == "" {
+		return nil, ErrInvalidRequest.WithMessage("缺少 X-Amz-Content-Sha256 请求头")
+	}
+	return sig, nil
+}
+
+// parsePresigned 解析预签名URL
+func parsePresigned(query url.Values) (*Signature, error) {
+	if query.Get("X-Amz-Algorithm") != Algorithm {
+		return nil, ErrSignatureVersion
+	}
+	sig := &Signature{
+		SignedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		Signature:     query.Get("X-Amz-Signature"),
+		AmzDate:       query.Get("X-Amz-Date"),
+		PayloadHash:   UnsignedPayload,
+		Presigned:     true,
+	}
+	if err := sig.parseCredential(query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+	if sig.Signature == "" || !strings.HasPrefix(sig.AmzDate, sig.Date) {
+		return nil, ErrAuthorizationQueryParametersError
+	}
+
+	requestTime, err := time.Parse(amzDateFormat, sig.AmzDate)
+	if err != nil {
+		return nil, ErrAuthorizationQueryParametersError
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	expires := time.Duration(seconds) * time.Second
+	if err != nil || expires <= 0 || expires > MaxPresignExpires {
+		return nil, ErrAuthorizationQueryParametersError
+	}
+	if time.Until(requestTime) > MaxClockSkew {
+		return nil, ErrRequestTimeTooSkewed
+	}
+	if time.Now().After(requestTime.Add(expires)) {
+		return nil, ErrAccessDenied.WithMessage("预签名链接已过期")
+	}
+	return sig, nil
+}
+
+// parseCredential 解析 AKID/日期/区域/服务/aws4_request
+func (s *Signature) parseCredential(value string) error {
+	parts := strings.Split(value, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || parts[3] != "s3" {
+		return ErrAuthorizationHeaderMalformed
+	}
+	s.AccessKeyId, s.Date, s.Region, s.Service = parts[0], parts[1], parts[2], parts[3]
+	return nil
+}
+
+// Verify 使用密钥重新计算签名并比较
+func (s *Signature) Verify(r *http.Request, secret string) error {
+	expected := hex.EncodeToString(hmacSHA256(s.signingKey(secret), []byte(s.stringToSign(r))))
+	if !hmac.Equal([]byte(expected), []byte(s.Signature)) {
+		return ErrSignatureDoesNotMatch
+	}
+	return nil
+}
+
+// Body 按 X-Amz-Content-Sha256 的声明包装请求体
+// 声明了摘要时在读取结束后校验；aws-chunked 编码时解码分块并校验每块签名
+func (s *Signature) Body(r *http.Request, secret string) (io.Reader, error) {
+	switch s.PayloadHash {
+	case UnsignedPayload:
+		return r.Body, nil
+	case StreamingPayload:
+		return newChunkedReader(r.Body, s, s.signingKey(secret)), nil
+	case StreamingTrailer:
+		return newChunkedReader(r.Body, nil, nil), nil
+	}
+	if len(s.PayloadHash) != sha256.Size*2 {
+		return nil, ErrNotImplemented.WithMessage("不支持的负载签名方式：" + s.PayloadHash)
+	}
+	return &hashingReader{r: r.Body, h: sha256.New(), expected: s.PayloadHash}, nil
+}
+
+func (s *Signature) signingKey(secret string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), []byte(s.Date))
+	key = hmacSHA256(key, []byte(s.Region))
+	key = hmacSHA256(key, []byte(s.Service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+func (s *Signature) stringToSign(r *http.Request) string {
+	return strings.Join([]string{
+		Algorithm,
+		s.AmzDate,
+		s.Scope(),
+		sha256Hex([]byte(s.canonicalRequest(r))),
+	}, "\n")
+}
+
+func (s *Signature) canonicalRequest(r *http.Request) string {
+	headers := make([]string, 0, len(s.SignedHeaders))
+	for _, name := range s.SignedHeaders {
+		headers = append(headers, name+":"+canonicalHeaderValue(r, name))
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		s.canonicalQuery(r.URL.Query()),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(s.SignedHeaders, ";"),
+		s.PayloadHash,
+	}, "\n")
+}
+
+func (s *Signature) canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		if s.Presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaderValue 规范化请求头值（Host 和 Content-Length 不在 r.Header 中）
+func canonicalHeaderValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		return strconv.FormatInt(r.ContentLength, 10)
+	}
+	values := r.Header.Values(name)
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// uriEncode 按 SigV4 规则编码，仅保留 A-Z a-z 0-9 - _ . ~（路径中保留 /）
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' && !encodeSlash {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{ch})))
+	}
+	return b.String()
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
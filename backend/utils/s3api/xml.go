@@ -0,0 +1,179 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error S3 错误响应
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// WithMessage 返回带自定义说明的同类错误
+func (e *Error) WithMessage(message string) *Error {
+	return &Error{Status: e.Status, Code: e.Code, Message: message}
+}
+
+// 常用错误
+var (
+	ErrAccessDenied                      = &Error{http.StatusForbidden, "AccessDenied", "拒绝访问"}
+	ErrInvalidAccessKeyId                = &Error{http.StatusForbidden, "InvalidAccessKeyId", "访问密钥ID不存在或已失效"}
+	ErrSignatureDoesNotMatch             = &Error{http.StatusForbidden, "SignatureDoesNotMatch", "请求签名不匹配"}
+	ErrSignatureVersion                  = &Error{http.StatusBadRequest, "InvalidRequest", "仅支持 AWS4-HMAC-SHA256 签名"}
+	ErrAuthorizationHeaderMalformed      = &Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", "Authorization 请求头格式错误"}
+	ErrAuthorizationQueryParametersError = &Error{http.StatusBadRequest, "AuthorizationQueryParametersError", "预签名参数错误"}
+	ErrRequestTimeTooSkewed              = &Error{http.StatusForbidden, "RequestTimeTooSkewed", "请求时间与服务器时间相差过大"}
+	ErrContentSHA256Mismatch             = &Error{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "请求体摘要与 X-Amz-Content-Sha256 不一致"}
+	ErrIncompleteBody                    = &Error{http.StatusBadRequest, "IncompleteBody", "请求体不完整"}
+	ErrInvalidRequest                    = &Error{http.StatusBadRequest, "InvalidRequest", "请求无效"}
+	ErrInvalidArgument                   = &Error{http.StatusBadRequest, "InvalidArgument", "参数无效"}
+	ErrInvalidBucketName                 = &Error{http.StatusBadRequest, "InvalidBucketName", "存储桶名称无效"}
+	ErrNoSuchBucket                      = &Error{http.StatusNotFound, "NoSuchBucket", "存储桶不存在"}
+	ErrNoSuchKey                         = &Error{http.StatusNotFound, "NoSuchKey", "对象不存在"}
+	ErrBucketNotEmpty                    = &Error{http.StatusConflict, "BucketNotEmpty", "存储桶不为空"}
+	ErrBadDigest                         = &Error{http.StatusBadRequest, "BadDigest", "Content-MD5 与请求体不一致"}
+	ErrEntityTooLarge                    = &Error{http.StatusBadRequest, "EntityTooLarge", "文件大小超过限制"}
+	ErrMalformedXML                      = &Error{http.StatusBadRequest, "MalformedXML", "XML格式错误"}
+	ErrNotImplemented                    = &Error{http.StatusNotImplemented, "NotImplemented", "不支持该操作"}
+	ErrSlowDown                          = &Error{http.StatusServiceUnavailable, "SlowDown", "请求过于频繁，请稍后重试"}
+	ErrInternalError                     = &Error{http.StatusInternalServerError, "InternalError", "服务器内部错误"}
+)
+
+// TimeFormat 列表中的时间格式
+const TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// FormatTime 格式化为 S3 列表使用的 UTC 时间
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+// WriteError 返回 S3 格式的错误，非 *Error 类型按内部错误处理
+func WriteError(c *gin.Context, err error) {
+	s3Err, ok := err.(*Error)
+	if !ok {
+		s3Err = ErrInternalError.WithMessage(err.Error())
+	}
+	if c.Request.Method == http.MethodHead {
+		c.AbortWithStatus(s3Err.Status)
+		return
+	}
+	c.Abort()
+	WriteXML(c, s3Err.Status, errorResponse{
+		Code:     s3Err.Code,
+		Message:  s3Err.Message,
+		Resource: c.Request.URL.Path,
+	})
+}
+
+// WriteXML 返回 XML 响应
+func WriteXML(c *gin.Context, status int, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "application/xml", append([]byte(xml.Header), data...))
+}
+
+// Owner 对象/存储桶所有者
+type Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// Bucket 存储桶
+type Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+// ListAllMyBucketsResult ListBuckets 响应
+type ListAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   Owner    `xml:"Owner"`
+	Buckets []Bucket `xml:"Buckets>Bucket"`
+}
+
+// Content 列表中的对象
+type Content struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// CommonPrefix 按分隔符折叠的公共前缀
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// ListBucketResult ListObjects（V1/V2）响应，按版本填充对应字段
+type ListBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Marker                *string        `xml:"Marker"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	KeyCount              *int           `xml:"KeyCount"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	Contents              []Content      `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// LocationConstraint GetBucketLocation 响应
+type LocationConstraint struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Region  string   `xml:",chardata"`
+}
+
+// DeleteRequest DeleteObjects 请求
+type DeleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+// DeletedObject 删除成功的对象
+type DeletedObject struct {
+	Key string `xml:"Key"`
+}
+
+// DeleteError 删除失败的对象
+type DeleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// DeleteResult DeleteObjects 响应
+type DeleteResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []DeletedObject `xml:"Deleted"`
+	Errors  []DeleteError   `xml:"Error"`
+}
@@ -0,0 +1,430 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"oneimg/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 查询语法（空格分隔，多个条件为 AND 关系，值含空格时使用双引号）：
+//
+//	tag:风景 -tag:草稿          包含/排除标签
+//	type:png mime:image/*       MIME类型（扩展名、完整类型或通配）
+//	size:>1mb size:100kb..2mb   文件大小
+//	width:>=1920 height:<1080   尺寸
+//	storage:s3                  存储方式
+//	date:2025-01 date:2025-01-01..2025-03-31 after:2025-01-01 before:2025-02-01
+//	user:alice user:3           上传者（用户名、用户ID或游客UUID）
+//	其他文字                    文件名模糊匹配，-前缀表示排除
+//
+// 同一类别的 type/storage/user 多次出现时为 OR 关系
+
+// maxTerms 单次查询最多条件数
+const maxTerms = 32
+
+// likeEscape LIKE 转义字符（三种数据库均支持以 ESCAPE 指定）
+const likeEscape = "!"
+
+var uuidRegex = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// 扩展名与MIME类型对照
+var extMimeTypes = map[string]string{
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"svg":  "image/svg+xml",
+	"bmp":  "image/bmp",
+	"avif": "image/avif",
+	"ico":  "image/x-icon",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+}
+
+// Comparison 数值/时间比较条件
+type Comparison struct {
+	Column string
+	Op     string // = > >= < <=
+	Value  any
+}
+
+// Query 解析后的查询
+type Query struct {
+	Keywords        []string
+	ExcludeKeywords []string
+	Tags            []string
+	ExcludeTags     []string
+	MimeTypes       []string // 以 / 结尾表示前缀匹配
+	Storages        []string
+	Uploaders       []string
+	Comparisons     []Comparison
+}
+
+// Parse 解析查询字符串
+func Parse(input string) (*Query, error) {
+	terms, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) > maxTerms {
+		return nil, fmt.Errorf("查询条件过多（最多%d个）", maxTerms)
+	}
+
+	q := &Query{}
+	for _, term := range terms {
+		negate := false
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			negate = true
+			term = term[1:]
+		}
+
+		key, value, hasKey := strings.Cut(term, ":")
+		key = strings.ToLower(key)
+		if !hasKey || !isKnownKey(key) {
+			// 普通关键字（包括值中含冒号但不是已知字段的情况）
+			if negate {
+				q.ExcludeKeywords = append(q.ExcludeKeywords, term)
+			} else {
+				q.Keywords = append(q.Keywords, term)
+			}
+			continue
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("条件 %s 缺少值", key)
+		}
+		if negate && key != "tag" {
+			return nil, fmt.Errorf("条件 %s 不支持取反", key)
+		}
+
+		switch key {
+		case "tag":
+			tag := models.NormalizeTagName(value)
+			if tag == "" {
+				return nil, fmt.Errorf("标签无效：%s", value)
+			}
+			if negate {
+				q.ExcludeTags = append(q.ExcludeTags, tag)
+			} else {
+				q.Tags = append(q.Tags, tag)
+			}
+		case "type", "mime":
+			q.MimeTypes = append(q.MimeTypes, parseMimeType(value))
+		case "storage":
+			q.Storages = append(q.Storages, strings.ToLower(value))
+		case "user", "uploader":
+			q.Uploaders = append(q.Uploaders, value)
+		case "size":
+			cmps, err := parseRange("file_size", value, parseSize)
+			if err != nil {
+				return nil, err
+			}
+			q.Comparisons = append(q.Comparisons, cmps...)
+		case "width", "height":
+			cmps, err := parseRange(key, value, parseInt)
+			if err != nil {
+				return nil, err
+			}
+			q.Comparisons = append(q.Comparisons, cmps...)
+		case "date":
+			cmps, err := parseDateRange(value)
+			if err != nil {
+				return nil, err
+			}
+			q.Comparisons = append(q.Comparisons, cmps...)
+		case "after":
+			cmps, err := parseDateRange(">=" + value)
+			if err != nil {
+				return nil, err
+			}
+			q.Comparisons = append(q.Comparisons, cmps...)
+		case "before":
+			cmps, err := parseDateRange("<" + value)
+			if err != nil {
+				return nil, err
+			}
+			q.Comparisons = append(q.Comparisons, cmps...)
+		}
+	}
+
+	return q, nil
+}
+
+// Apply 将查询编译为GORM条件，tx 为图片表查询
+func (q *Query) Apply(tx *gorm.DB) *gorm.DB {
+	// 子查询使用独立的会话，避免与主查询条件互相干扰
+	newDB := func() *gorm.DB { return tx.Session(&gorm.Session{NewDB: true}) }
+
+	for _, kw := range q.Keywords {
+		tx = tx.Where("LOWER(file_name) LIKE ? ESCAPE '"+likeEscape+"'", likePattern(kw))
+	}
+	for _, kw := range q.ExcludeKeywords {
+		tx = tx.Where("LOWER(file_name) NOT LIKE ? ESCAPE '"+likeEscape+"'", likePattern(kw))
+	}
+
+	for _, tag := range q.Tags {
+		tx = tx.Where("id IN (?)", tagImageIds(newDB(), tag))
+	}
+	for _, tag := range q.ExcludeTags {
+		tx = tx.Where("id NOT IN (?)", tagImageIds(newDB(), tag))
+	}
+
+	if len(q.MimeTypes) > 0 {
+		cond := newDB()
+		for _, mt := range q.MimeTypes {
+			if strings.HasSuffix(mt, "/") {
+				cond = cond.Or("LOWER(mime_type) LIKE ? ESCAPE '"+likeEscape+"'", escapeLike(mt)+"%")
+			} else {
+				cond = cond.Or("LOWER(mime_type) = ?", mt)
+			}
+		}
+		tx = tx.Where(cond)
+	}
+
+	if len(q.Storages) > 0 {
+		tx = tx.Where("storage IN ?", q.Storages)
+	}
+
+	if len(q.Uploaders) > 0 {
+		cond := newDB()
+		for _, u := range q.Uploaders {
+			if id, err := strconv.Atoi(u); err == nil {
+				cond = cond.Or("user_id = ?", id)
+			} else if uuidRegex.MatchString(u) {
+				cond = cond.Or("uuid = ?", strings.ToLower(u))
+			} else {
+				cond = cond.Or("user_id IN (?)", newDB().Model(&models.User{}).Select("id").Where("username = ?", u))
+			}
+		}
+		tx = tx.Where(cond)
+	}
+
+	for _, cmp := range q.Comparisons {
+		tx = tx.Where(cmp.Column+" "+cmp.Op+" ?", cmp.Value)
+	}
+
+	return tx
+}
+
+// tagImageIds 带有指定标签的图片ID子查询
+func tagImageIds(db *gorm.DB, tag string) *gorm.DB {
+	return db.Model(&models.ImageTag{}).
+		Select("image_tags.image_id").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("tags.name = ?", tag)
+}
+
+// tokenize 按空白切分查询，支持双引号包裹含空格的值
+func tokenize(input string) ([]string, error) {
+	var terms []string
+	var current strings.Builder
+	inQuote := false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("查询中的引号未闭合")
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms, nil
+}
+
+// isKnownKey 是否为支持的查询字段
+func isKnownKey(key string) bool {
+	switch key {
+	case "tag", "type", "mime", "storage", "user", "uploader", "size", "width", "height", "date", "after", "before":
+		return true
+	}
+	return false
+}
+
+// parseMimeType 将扩展名或通配类型转换为MIME类型（前缀匹配以 / 结尾）
+func parseMimeType(value string) string {
+	value = strings.ToLower(strings.TrimPrefix(value, "."))
+	if mt, ok := extMimeTypes[value]; ok {
+		return mt
+	}
+	if strings.HasSuffix(value, "/*") {
+		return strings.TrimSuffix(value, "*")
+	}
+	if strings.Contains(value, "/") {
+		return value
+	}
+	return "image/" + value
+}
+
+// parseRange 解析比较表达式：>x >=x <x <=x =x x a..b
+func parseRange(column, value string, parse func(string) (int64, error)) ([]Comparison, error) {
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		var cmps []Comparison
+		if lo != "" {
+			v, err := parse(lo)
+			if err != nil {
+				return nil, err
+			}
+			cmps = append(cmps, Comparison{Column: column, Op: ">=", Value: v})
+		}
+		if hi != "" {
+			v, err := parse(hi)
+			if err != nil {
+				return nil, err
+			}
+			cmps = append(cmps, Comparison{Column: column, Op: "<=", Value: v})
+		}
+		if len(cmps) == 0 {
+			return nil, fmt.Errorf("范围无效：%s", value)
+		}
+		return cmps, nil
+	}
+
+	op, raw := splitOperator(value)
+	v, err := parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return []Comparison{{Column: column, Op: op, Value: v}}, nil
+}
+
+// parseDateRange 解析日期条件，日期可为 YYYY、YYYY-MM 或 YYYY-MM-DD，代表对应的整段时间
+func parseDateRange(value string) ([]Comparison, error) {
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		var cmps []Comparison
+		if lo != "" {
+			start, _, err := parseDate(lo)
+			if err != nil {
+				return nil, err
+			}
+			cmps = append(cmps, Comparison{Column: "created_at", Op: ">=", Value: start})
+		}
+		if hi != "" {
+			_, end, err := parseDate(hi)
+			if err != nil {
+				return nil, err
+			}
+			cmps = append(cmps, Comparison{Column: "created_at", Op: "<", Value: end})
+		}
+		if len(cmps) == 0 {
+			return nil, fmt.Errorf("日期范围无效：%s", value)
+		}
+		return cmps, nil
+	}
+
+	op, raw := splitOperator(value)
+	start, end, err := parseDate(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case ">":
+		return []Comparison{{Column: "created_at", Op: ">=", Value: end}}, nil
+	case ">=":
+		return []Comparison{{Column: "created_at", Op: ">=", Value: start}}, nil
+	case "<":
+		return []Comparison{{Column: "created_at", Op: "<", Value: start}}, nil
+	case "<=":
+		return []Comparison{{Column: "created_at", Op: "<", Value: end}}, nil
+	default:
+		return []Comparison{
+			{Column: "created_at", Op: ">=", Value: start},
+			{Column: "created_at", Op: "<", Value: end},
+		}, nil
+	}
+}
+
+// parseDate 解析日期，返回该时间段的起止时间 [start, end)
+func parseDate(value string) (time.Time, time.Time, error) {
+	layouts := []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, value, time.Local); err == nil {
+			return t, l.next(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("日期格式无效：%s（支持 YYYY、YYYY-MM、YYYY-MM-DD）", value)
+}
+
+// splitOperator 拆分比较运算符
+func splitOperator(value string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, strings.TrimPrefix(value, op)
+		}
+	}
+	return "=", value
+}
+
+// parseInt 解析整数
+func parseInt(value string) (int64, error) {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("数值无效：%s", value)
+	}
+	return v, nil
+}
+
+// parseSize 解析文件大小，支持 b/kb/mb/gb 单位（1024进制）
+func parseSize(value string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"gb", 1 << 30}, {"g", 1 << 30},
+		{"mb", 1 << 20}, {"m", 1 << 20},
+		{"kb", 1 << 10}, {"k", 1 << 10},
+		{"b", 1},
+	}
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			factor = u.factor
+			lower = strings.TrimSuffix(lower, u.suffix)
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(lower, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("文件大小无效：%s", value)
+	}
+	return int64(v * factor), nil
+}
+
+// likePattern 生成不区分大小写的包含匹配模式
+func likePattern(keyword string) string {
+	return "%" + escapeLike(strings.ToLower(keyword)) + "%"
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	r := strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+	return r.Replace(s)
+}
@@ -0,0 +1,256 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// prefix 加密值前缀，完整格式：enc:v1:<主密钥ID>:<加密后的数据密钥>:<密文>
+// 每个值使用随机数据密钥（AES-256-GCM）加密，数据密钥再由主密钥加密（信封加密），
+// 更换主密钥时只需重新加密数据密钥
+const prefix = "enc:v1:"
+
+// masterKey 主密钥
+type masterKey struct {
+	id   string // SHA-256 前8位，用于区分加密时使用的主密钥
+	aead cipher.AEAD
+}
+
+var (
+	current *masterKey
+	keys    = map[string]*masterKey{}
+)
+
+func init() {
+	// 模型中通过 gorm:"serializer:encrypted" 启用透明加解密
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Init 加载主密钥，key 为空时不加密（已加密的值仍可用 oldKeys 解密）
+func Init(key string, oldKeys []string) error {
+	current = nil
+	keys = map[string]*masterKey{}
+
+	for _, k := range oldKeys {
+		mk, err := parseKey(k)
+		if err != nil {
+			return fmt.Errorf("SETTINGS_ENCRYPTION_OLD_KEYS 无效：%v", err)
+		}
+		keys[mk.id] = mk
+	}
+	if key == "" {
+		return nil
+	}
+	mk, err := parseKey(key)
+	if err != nil {
+		return fmt.Errorf("SETTINGS_ENCRYPTION_KEY 无效：%v", err)
+	}
+	keys[mk.id] = mk
+	current = mk
+	return nil
+}
+
+// Enabled 是否配置了主密钥
+func Enabled() bool {
+	return current != nil
+}
+
+// IsEncrypted 值是否为加密格式
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// NeedsRewrap 值是否需要按当前主密钥重新写入：
+// 已配置主密钥时明文或旧密钥加密的值需要加密，未配置时已加密的值需要还原为明文
+func NeedsRewrap(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return current != nil
+	}
+	return current == nil || keyId(value) != current.id
+}
+
+// Encrypt 使用当前主密钥加密，未配置主密钥或值为空时原样返回
+func Encrypt(plain string) (string, error) {
+	if current == nil || plain == "" {
+		return plain, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(current.aead, dataKey, []byte(current.id))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plain), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + current.id + ":" +
+		base64.RawURLEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt 解密，明文值原样返回
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("加密值格式无效")
+	}
+	mk, ok := keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("缺少主密钥 %s，请检查 SETTINGS_ENCRYPTION_KEY / SETTINGS_ENCRYPTION_OLD_KEYS", parts[0])
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("加密值格式无效")
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("加密值格式无效")
+	}
+
+	dataKey, err := open(mk.aead, wrapped, []byte(mk.id))
+	if err != nil {
+		return "", fmt.Errorf("数据密钥解密失败：%v", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(aead, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败：%v", err)
+	}
+	return string(plain), nil
+}
+
+// rawContextKey 原样读写标记
+type rawContextKey struct{}
+
+// WithRaw 返回不做加解密的上下文：读取时保留数据库中的密文，写入时原样写入
+// 用于备份导出与恢复，备份包中的敏感字段保持加密状态
+func WithRaw(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rawContextKey{}, true)
+}
+
+func isRaw(ctx context.Context) bool {
+	raw, _ := ctx.Value(rawContextKey{}).(bool)
+	return raw
+}
+
+// Serializer GORM 序列化器：写入数据库前加密，读取后解密，内存中始终为明文
+type Serializer struct{}
+
+// Scan 读取数据库值并解密
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("字段 %s 的值类型无效：%T", field.Name, dbValue)
+	}
+
+	if isRaw(ctx) {
+		return field.Set(ctx, dst, value)
+	}
+	plain, err := Decrypt(value)
+	if err != nil {
+		return fmt.Errorf("字段 %s %v", field.DBName, err)
+	}
+	return field.Set(ctx, dst, plain)
+}
+
+// Value 加密后写入数据库
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	plain, _ := fieldValue.(string)
+	if isRaw(ctx) {
+		return plain, nil
+	}
+	return Encrypt(plain)
+}
+
+// parseKey 解析 base64 或 hex 编码的32字节主密钥
+func parseKey(encoded string) (*masterKey, error) {
+	var raw []byte
+	for _, decode := range []func(string) ([]byte, error){
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+	} {
+		if b, err := decode(encoded); err == nil && len(b) == 32 {
+			raw = b
+			break
+		}
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("需要 base64 或 hex 编码的32字节密钥")
+	}
+
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// keyId 加密值中的主密钥ID
+func keyId(value string) string {
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密，随机 nonce 置于密文之前
+func seal(aead cipher.AEAD, plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+func open(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("密文长度无效")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
@@ -0,0 +1,67 @@
+package settings
+
+import (
+	"fmt"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+)
+
+// ApplyProfile 将存储配置方案覆盖到设置上，profileId 为0时保持系统设置不变
+func ApplyProfile(setting *models.Settings, profileId int) error {
+	if profileId <= 0 {
+		return nil
+	}
+	profile, err := findProfile(profileId)
+	if err != nil {
+		return err
+	}
+	*setting = profile.Apply(*setting)
+	return nil
+}
+
+// ApplyUploadProfile 上传请求指定存储配置方案时，先校验当前角色是否可以使用该方案
+func ApplyUploadProfile(setting *models.Settings, profileId, role int) error {
+	if profileId <= 0 {
+		return nil
+	}
+	profile, err := findProfile(profileId)
+	if err != nil || !profile.AllowsUploadRole(role) {
+		return fmt.Errorf("存储配置方案不存在或无权使用（ID：%d）", profileId)
+	}
+	*setting = profile.Apply(*setting)
+	return nil
+}
+
+// findProfile 按ID查询存储配置方案
+func findProfile(profileId int) (*models.StorageProfile, error) {
+	db := database.GetDB()
+	if db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+	var profile models.StorageProfile
+	if err := db.DB.First(&profile, profileId).Error; err != nil {
+		return nil, fmt.Errorf("存储配置方案不存在（ID：%d）", profileId)
+	}
+	return &profile, nil
+}
+
+// ForStorage 获取指定存储类型和配置方案对应的设置副本
+func ForStorage(storageType string, profileId int) (models.Settings, error) {
+	setting, err := GetSettings()
+	if err != nil {
+		return setting, err
+	}
+	if err := ApplyProfile(&setting, profileId); err != nil {
+		return setting, err
+	}
+	if storageType != "" {
+		setting.StorageType = storageType
+	}
+	return setting, nil
+}
+
+// ForImage 获取读取/删除该图片时应使用的设置（按图片记录的存储类型和配置方案）
+func ForImage(image models.Image) (models.Settings, error) {
+	return ForStorage(image.Storage, image.StorageProfileId)
+}
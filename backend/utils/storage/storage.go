@@ -0,0 +1,685 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/ftp"
+	"oneimg/backend/utils/s3"
+	"oneimg/backend/utils/telegram"
+	"oneimg/backend/utils/webdav"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// 存储类型
+const (
+	TypeDefault  = "default"
+	TypeS3       = "s3"
+	TypeR2       = "r2"
+	TypeWebDAV   = "webdav"
+	TypeFTP      = "ftp"
+	TypeTelegram = "telegram"
+	TypeCustom   = "custom"
+)
+
+// Object 一个图片对象（原图及缩略图）
+type Object struct {
+	Key       string // 原图对象键，如 uploads/2025/01/xxx.webp
+	ThumbKey  string // 缩略图对象键，空表示没有独立缩略图
+	FileName  string
+	MimeType  string
+	Data      []byte
+	ThumbData []byte
+}
+
+// Location 对象写入后的访问地址
+type Location struct {
+	Url       string
+	Thumbnail string
+	Telegram  *models.ImageTeleGram // 写入Telegram时需要保存的文件ID
+}
+
+// Backend 存储后端，用于在不同存储之间读写图片对象
+type Backend interface {
+	// Name 存储类型标识（与 Image.Storage 一致）
+	Name() string
+	// Read 读取图片记录对应的原图和缩略图
+	Read(ctx context.Context, image models.Image) (*Object, error)
+	// Write 写入对象并返回新的访问地址
+	Write(ctx context.Context, obj *Object) (*Location, error)
+	// WriteThumbnail 为已存在的原图（对象键 key）单独写入缩略图，返回的 Location 只包含缩略图信息
+	WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error)
+	// Verify 校验写入结果（比较文件大小）
+	Verify(ctx context.Context, obj *Object, loc *Location) error
+}
+
+// New 根据存储类型创建后端，凭据取自系统设置
+func New(storageType string, setting models.Settings) (Backend, error) {
+	switch strings.ToLower(storageType) {
+	case TypeDefault:
+		return &localBackend{}, nil
+	case TypeS3, TypeR2:
+		s := setting
+		s.StorageType = strings.ToLower(storageType)
+		client, err := s3.NewS3Client(s)
+		if err != nil {
+			return nil, err
+		}
+		return &s3Backend{name: s.StorageType, client: client, setting: s}, nil
+	case TypeWebDAV:
+		if setting.WebdavURL == "" {
+			return nil, errors.New("WebDAV配置未设置")
+		}
+		return &webdavBackend{client: webdav.Client(webdav.Config{
+			BaseURL:  setting.WebdavURL,
+			Username: setting.WebdavUser,
+			Password: setting.WebdavPass,
+			Timeout:  60 * time.Second,
+		})}, nil
+	case TypeFTP:
+		if setting.FTPHost == "" {
+			return nil, errors.New("FTP配置未设置")
+		}
+		return &ftpBackend{config: ftp.FTPConfig{
+			Host:     setting.FTPHost,
+			Port:     setting.FTPPort,
+			User:     setting.FTPUser,
+			Password: setting.FTPPass,
+			Timeout:  60,
+		}}, nil
+	case TypeTelegram:
+		if setting.TGBotToken == "" {
+			return nil, errors.New("Telegram BotToken 未设置")
+		}
+		target := setting.TGChannelID
+		if target == "" {
+			target = setting.TGReceivers
+		}
+		client := telegram.NewClient(setting.TGBotToken)
+		client.Timeout = 60 * time.Second
+		client.Retry = 3
+		return &telegramBackend{client: client, target: target}, nil
+	case TypeCustom:
+		return &customBackend{}, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储类型：%s", storageType)
+	}
+}
+
+// CanWrite 存储类型是否可作为迁移目标
+// 自定义API由远端决定文件地址且不支持覆盖写入，只能作为迁移来源
+func CanWrite(storageType string) bool {
+	switch strings.ToLower(storageType) {
+	case TypeDefault, TypeS3, TypeR2, TypeWebDAV, TypeFTP, TypeTelegram:
+		return true
+	}
+	return false
+}
+
+// ObjectKeys 根据图片记录推导原图和缩略图的对象键
+func ObjectKeys(image models.Image, setting models.Settings) (string, string) {
+	key := keyFromURL(image.Url, image, setting)
+	thumbKey := ""
+	if image.Thumbnail != "" && image.Thumbnail != image.Url {
+		thumbKey = keyFromURL(image.Thumbnail, image, setting)
+	}
+	return key, thumbKey
+}
+
+// keyFromURL 将访问地址转换为对象键（uploads/年/月/文件名）
+func keyFromURL(rawURL string, image models.Image, setting models.Settings) string {
+	if strings.HasPrefix(rawURL, "/") {
+		return strings.TrimPrefix(rawURL, "/")
+	}
+
+	// S3/R2 自定义域名
+	for _, base := range []string{setting.S3CustomURL, setting.R2CustomURL} {
+		base = strings.TrimRight(base, "/")
+		if base != "" && strings.HasPrefix(rawURL, base+"/") {
+			return strings.TrimPrefix(rawURL, base+"/")
+		}
+	}
+
+	// 外部地址（如自定义API）按上传时间归档
+	name := image.FileName
+	if name == "" {
+		if u, err := url.Parse(rawURL); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+	return path.Join("uploads", image.CreatedAt.Format("2006/01"), name)
+}
+
+// thumbnailKey 由原图键推导缩略图键
+func thumbnailKey(key string) string {
+	return path.Join(path.Dir(key), "thumbnails", path.Base(key))
+}
+
+// checkSize 比较写入前后的大小
+func checkSize(name string, expected, actual int64) error {
+	if expected != actual {
+		return fmt.Errorf("%s大小不一致（期望 %d 字节，实际 %d 字节）", name, expected, actual)
+	}
+	return nil
+}
+
+// ---------- 本地存储 ----------
+
+type localBackend struct{}
+
+func (b *localBackend) Name() string { return TypeDefault }
+
+func (b *localBackend) Read(ctx context.Context, image models.Image) (*Object, error) {
+	obj := &Object{FileName: image.FileName, MimeType: image.MimeType}
+	obj.Key, obj.ThumbKey = ObjectKeys(image, models.Settings{})
+
+	data, err := os.ReadFile(filepath.FromSlash(obj.Key))
+	if err != nil {
+		return nil, fmt.Errorf("读取本地文件失败：%w", err)
+	}
+	obj.Data = data
+
+	if obj.ThumbKey != "" {
+		// 缩略图缺失不影响迁移
+		if thumb, err := os.ReadFile(filepath.FromSlash(obj.ThumbKey)); err == nil {
+			obj.ThumbData = thumb
+		}
+	}
+	return obj, nil
+}
+
+func (b *localBackend) Write(ctx context.Context, obj *Object) (*Location, error) {
+	if err := writeLocalFile(obj.Key, obj.Data); err != nil {
+		return nil, err
+	}
+	loc := &Location{Url: "/" + obj.Key}
+
+	if len(obj.ThumbData) > 0 {
+		thumbKey := thumbnailKey(obj.Key)
+		if err := writeLocalFile(thumbKey, obj.ThumbData); err != nil {
+			return nil, err
+		}
+		loc.Thumbnail = "/" + thumbKey
+	}
+	return loc, nil
+}
+
+func (b *localBackend) WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error) {
+	thumbKey := thumbnailKey(key)
+	if err := writeLocalFile(thumbKey, data); err != nil {
+		return nil, err
+	}
+	return &Location{Thumbnail: "/" + thumbKey}, nil
+}
+
+func (b *localBackend) Verify(ctx context.Context, obj *Object, loc *Location) error {
+	info, err := os.Stat(filepath.FromSlash(strings.TrimPrefix(loc.Url, "/")))
+	if err != nil {
+		return fmt.Errorf("校验本地文件失败：%w", err)
+	}
+	if err := checkSize("原图", int64(len(obj.Data)), info.Size()); err != nil {
+		return err
+	}
+	if loc.Thumbnail != "" {
+		info, err := os.Stat(filepath.FromSlash(strings.TrimPrefix(loc.Thumbnail, "/")))
+		if err != nil {
+			return fmt.Errorf("校验本地缩略图失败：%w", err)
+		}
+		return checkSize("缩略图", int64(len(obj.ThumbData)), info.Size())
+	}
+	return nil
+}
+
+// writeLocalFile 写入本地文件（自动创建目录）
+func writeLocalFile(key string, data []byte) error {
+	fullPath := filepath.FromSlash(key)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("创建目录失败：%w", err)
+	}
+	if err := os.WriteFile(fullPath, data, 0644); err != nil {
+		return fmt.Errorf("写入本地文件失败：%w", err)
+	}
+	return nil
+}
+
+// ---------- S3/R2 ----------
+
+type s3Backend struct {
+	name    string
+	client  *awss3.Client
+	setting models.Settings
+}
+
+func (b *s3Backend) Name() string { return b.name }
+
+func (b *s3Backend) bucket() string {
+	if b.name == TypeR2 {
+		return b.setting.R2Bucket
+	}
+	return b.setting.S3Bucket
+}
+
+func (b *s3Backend) customURL() string {
+	if b.name == TypeR2 {
+		return strings.TrimRight(b.setting.R2CustomURL, "/")
+	}
+	return strings.TrimRight(b.setting.S3CustomURL, "/")
+}
+
+func (b *s3Backend) get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(b.bucket()),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (b *s3Backend) put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := b.client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket:      aws.String(b.bucket()),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (b *s3Backend) size(ctx context.Context, key string) (int64, error) {
+	head, err := b.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(b.bucket()),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.ToInt64(head.ContentLength), nil
+}
+
+func (b *s3Backend) Read(ctx context.Context, image models.Image) (*Object, error) {
+	obj := &Object{FileName: image.FileName, MimeType: image.MimeType}
+	obj.Key, obj.ThumbKey = ObjectKeys(image, b.setting)
+
+	data, err := b.get(ctx, obj.Key)
+	if err != nil {
+		return nil, fmt.Errorf("读取S3/R2对象失败：%w", err)
+	}
+	obj.Data = data
+
+	if obj.ThumbKey != "" {
+		if thumb, err := b.get(ctx, obj.ThumbKey); err == nil {
+			obj.ThumbData = thumb
+		}
+	}
+	return obj, nil
+}
+
+func (b *s3Backend) Write(ctx context.Context, obj *Object) (*Location, error) {
+	if err := b.put(ctx, obj.Key, obj.Data, obj.MimeType); err != nil {
+		return nil, fmt.Errorf("写入S3/R2对象失败：%w", err)
+	}
+
+	// 与上传逻辑一致：配置了自定义域名时原图使用自定义域名
+	loc := &Location{Url: "/" + obj.Key}
+	if base := b.customURL(); base != "" {
+		loc.Url = base + "/" + obj.Key
+	}
+
+	if len(obj.ThumbData) > 0 {
+		thumbKey := thumbnailKey(obj.Key)
+		if err := b.put(ctx, thumbKey, obj.ThumbData, "image/webp"); err != nil {
+			return nil, fmt.Errorf("写入S3/R2缩略图失败：%w", err)
+		}
+		loc.Thumbnail = "/" + thumbKey
+	}
+	return loc, nil
+}
+
+func (b *s3Backend) WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error) {
+	thumbKey := thumbnailKey(key)
+	if err := b.put(ctx, thumbKey, data, http.DetectContentType(data)); err != nil {
+		return nil, fmt.Errorf("写入S3/R2缩略图失败：%w", err)
+	}
+	return &Location{Thumbnail: "/" + thumbKey}, nil
+}
+
+func (b *s3Backend) Verify(ctx context.Context, obj *Object, loc *Location) error {
+	size, err := b.size(ctx, obj.Key)
+	if err != nil {
+		return fmt.Errorf("校验S3/R2对象失败：%w", err)
+	}
+	if err := checkSize("原图", int64(len(obj.Data)), size); err != nil {
+		return err
+	}
+	if loc.Thumbnail != "" {
+		size, err := b.size(ctx, strings.TrimPrefix(loc.Thumbnail, "/"))
+		if err != nil {
+			return fmt.Errorf("校验S3/R2缩略图失败：%w", err)
+		}
+		return checkSize("缩略图", int64(len(obj.ThumbData)), size)
+	}
+	return nil
+}
+
+// ---------- WebDAV ----------
+
+type webdavBackend struct {
+	client *webdav.WebDAVClient
+}
+
+func (b *webdavBackend) Name() string { return TypeWebDAV }
+
+func (b *webdavBackend) get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.client.WebDAVGetFile(ctx, "/"+key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码：%d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (b *webdavBackend) Read(ctx context.Context, image models.Image) (*Object, error) {
+	obj := &Object{FileName: image.FileName, MimeType: image.MimeType}
+	obj.Key, obj.ThumbKey = ObjectKeys(image, models.Settings{})
+
+	data, err := b.get(ctx, obj.Key)
+	if err != nil {
+		return nil, fmt.Errorf("读取WebDAV文件失败：%w", err)
+	}
+	obj.Data = data
+
+	if obj.ThumbKey != "" {
+		if thumb, err := b.get(ctx, obj.ThumbKey); err == nil {
+			obj.ThumbData = thumb
+		}
+	}
+	return obj, nil
+}
+
+func (b *webdavBackend) Write(ctx context.Context, obj *Object) (*Location, error) {
+	if err := b.client.WebDAVUpload(ctx, "/"+obj.Key, bytes.NewReader(obj.Data)); err != nil {
+		return nil, fmt.Errorf("写入WebDAV文件失败：%w", err)
+	}
+	loc := &Location{Url: "/" + obj.Key}
+
+	if len(obj.ThumbData) > 0 {
+		thumbKey := thumbnailKey(obj.Key)
+		if err := b.client.WebDAVUpload(ctx, "/"+thumbKey, bytes.NewReader(obj.ThumbData)); err != nil {
+			return nil, fmt.Errorf("写入WebDAV缩略图失败：%w", err)
+		}
+		loc.Thumbnail = "/" + thumbKey
+	}
+	return loc, nil
+}
+
+func (b *webdavBackend) WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error) {
+	thumbKey := thumbnailKey(key)
+	if err := b.client.WebDAVUpload(ctx, "/"+thumbKey, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("写入WebDAV缩略图失败：%w", err)
+	}
+	return &Location{Thumbnail: "/" + thumbKey}, nil
+}
+
+func (b *webdavBackend) Verify(ctx context.Context, obj *Object, loc *Location) error {
+	data, err := b.get(ctx, obj.Key)
+	if err != nil {
+		return fmt.Errorf("校验WebDAV文件失败：%w", err)
+	}
+	if err := checkSize("原图", int64(len(obj.Data)), int64(len(data))); err != nil {
+		return err
+	}
+	if loc.Thumbnail != "" {
+		thumb, err := b.get(ctx, strings.TrimPrefix(loc.Thumbnail, "/"))
+		if err != nil {
+			return fmt.Errorf("校验WebDAV缩略图失败：%w", err)
+		}
+		return checkSize("缩略图", int64(len(obj.ThumbData)), int64(len(thumb)))
+	}
+	return nil
+}
+
+// ---------- FTP ----------
+
+type ftpBackend struct {
+	config ftp.FTPConfig
+}
+
+func (b *ftpBackend) Name() string { return TypeFTP }
+
+func (b *ftpBackend) Read(ctx context.Context, image models.Image) (*Object, error) {
+	obj := &Object{FileName: image.FileName, MimeType: image.MimeType}
+	obj.Key, obj.ThumbKey = ObjectKeys(image, models.Settings{})
+
+	client := ftp.NewFTPUtil(b.config)
+	defer client.Close()
+
+	data, _, err := client.GetFileStream(obj.Key)
+	if err != nil {
+		return nil, fmt.Errorf("读取FTP文件失败：%w", err)
+	}
+	obj.Data = data
+
+	if obj.ThumbKey != "" {
+		if thumb, _, err := client.GetFileStream(obj.ThumbKey); err == nil {
+			obj.ThumbData = thumb
+		}
+	}
+	return obj, nil
+}
+
+func (b *ftpBackend) Write(ctx context.Context, obj *Object) (*Location, error) {
+	client := ftp.NewFTPUtil(b.config)
+	defer client.Close()
+
+	if err := client.UploadImage(obj.Key, obj.Data, obj.MimeType); err != nil {
+		return nil, fmt.Errorf("写入FTP文件失败：%w", err)
+	}
+	loc := &Location{Url: "/" + obj.Key}
+
+	if len(obj.ThumbData) > 0 {
+		thumbKey := thumbnailKey(obj.Key)
+		if err := client.UploadImage(thumbKey, obj.ThumbData, "image/webp"); err != nil {
+			return nil, fmt.Errorf("写入FTP缩略图失败：%w", err)
+		}
+		loc.Thumbnail = "/" + thumbKey
+	}
+	return loc, nil
+}
+
+func (b *ftpBackend) WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error) {
+	client := ftp.NewFTPUtil(b.config)
+	defer client.Close()
+
+	thumbKey := thumbnailKey(key)
+	if err := client.UploadImage(thumbKey, data, http.DetectContentType(data)); err != nil {
+		return nil, fmt.Errorf("写入FTP缩略图失败：%w", err)
+	}
+	return &Location{Thumbnail: "/" + thumbKey}, nil
+}
+
+func (b *ftpBackend) Verify(ctx context.Context, obj *Object, loc *Location) error {
+	client := ftp.NewFTPUtil(b.config)
+	defer client.Close()
+
+	_, size, err := client.GetFileStream(obj.Key)
+	if err != nil {
+		return fmt.Errorf("校验FTP文件失败：%w", err)
+	}
+	if err := checkSize("原图", int64(len(obj.Data)), size); err != nil {
+		return err
+	}
+	if loc.Thumbnail != "" {
+		_, size, err := client.GetFileStream(strings.TrimPrefix(loc.Thumbnail, "/"))
+		if err != nil {
+			return fmt.Errorf("校验FTP缩略图失败：%w", err)
+		}
+		return checkSize("缩略图", int64(len(obj.ThumbData)), size)
+	}
+	return nil
+}
+
+// ---------- Telegram ----------
+
+type telegramBackend struct {
+	client *telegram.Config
+	target string
+}
+
+func (b *telegramBackend) Name() string { return TypeTelegram }
+
+func (b *telegramBackend) download(fileId string) ([]byte, error) {
+	reader, err := telegram.GetTelegramFileStreamReader(b.client, telegram.ParseFileIdFromTelegramPath(fileId))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (b *telegramBackend) Read(ctx context.Context, image models.Image) (*Object, error) {
+	obj := &Object{FileName: image.FileName, MimeType: image.MimeType}
+	obj.Key, obj.ThumbKey = ObjectKeys(image, models.Settings{})
+
+	db := database.GetDB()
+	if db == nil {
+		return nil, errors.New("数据库未初始化")
+	}
+	var tg models.ImageTeleGram
+	if err := db.DB.Where("file_name = ?", image.FileName).First(&tg).Error; err != nil {
+		return nil, fmt.Errorf("未找到Telegram文件信息：%w", err)
+	}
+
+	data, err := b.download(tg.TGFileId)
+	if err != nil {
+		return nil, fmt.Errorf("下载Telegram文件失败：%w", err)
+	}
+	obj.Data = data
+
+	if obj.ThumbKey != "" && tg.TGThumbnailFileId != "" {
+		if thumb, err := b.download(tg.TGThumbnailFileId); err == nil {
+			obj.ThumbData = thumb
+		}
+	}
+	return obj, nil
+}
+
+func (b *telegramBackend) Write(ctx context.Context, obj *Object) (*Location, error) {
+	fileId, messageId, err := b.client.UploadPhotoByBytes(b.target, obj.Data, obj.FileName, "迁移图片: "+obj.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("上传到Telegram失败：%w", err)
+	}
+	loc := &Location{
+		Url: "/" + obj.Key,
+		Telegram: &models.ImageTeleGram{
+			TGFileId:    fileId,
+			TGMessageId: messageId,
+			FileName:    obj.FileName,
+		},
+	}
+
+	if len(obj.ThumbData) > 0 {
+		thumbId, thumbMessageId, err := b.client.UploadPhotoByBytes(b.target, obj.ThumbData, "thumbnail_"+obj.FileName, "缩略图: "+obj.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("上传缩略图到Telegram失败：%w", err)
+		}
+		loc.Telegram.TGThumbnailFileId = thumbId
+		loc.Telegram.TGThumbnailMessageId = thumbMessageId
+		// 代理按 /thumbnails/*.webp 识别Telegram缩略图
+		loc.Thumbnail = "/" + thumbnailKey(strings.TrimSuffix(obj.Key, path.Ext(obj.Key))+".webp")
+	}
+	return loc, nil
+}
+
+func (b *telegramBackend) WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error) {
+	fileName := path.Base(key)
+	thumbId, thumbMessageId, err := b.client.UploadPhotoByBytes(b.target, data, "thumbnail_"+fileName, "缩略图: "+fileName)
+	if err != nil {
+		return nil, fmt.Errorf("上传缩略图到Telegram失败：%w", err)
+	}
+	return &Location{
+		Thumbnail: "/" + thumbnailKey(strings.TrimSuffix(key, path.Ext(key))+".webp"),
+		Telegram: &models.ImageTeleGram{
+			TGThumbnailFileId:    thumbId,
+			TGThumbnailMessageId: thumbMessageId,
+			FileName:             fileName,
+		},
+	}, nil
+}
+
+// Verify Telegram 会重新压缩照片，无法逐字节比较，只校验文件可下载且非空
+func (b *telegramBackend) Verify(ctx context.Context, obj *Object, loc *Location) error {
+	if loc.Telegram == nil {
+		return errors.New("缺少Telegram文件信息")
+	}
+	data, err := b.download(loc.Telegram.TGFileId)
+	if err != nil {
+		return fmt.Errorf("校验Telegram文件失败：%w", err)
+	}
+	if len(data) == 0 {
+		return errors.New("Telegram文件为空")
+	}
+	return nil
+}
+
+// ---------- 自定义API（只读） ----------
+
+type customBackend struct{}
+
+func (b *customBackend) Name() string { return TypeCustom }
+
+func (b *customBackend) Read(ctx context.Context, image models.Image) (*Object, error) {
+	obj := &Object{FileName: image.FileName, MimeType: image.MimeType}
+	obj.Key, _ = ObjectKeys(image, models.Settings{})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, image.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: 60 * time.Second}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载自定义API图片失败：%w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载自定义API图片失败，状态码：%d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	obj.Data = data
+	return obj, nil
+}
+
+func (b *customBackend) Write(ctx context.Context, obj *Object) (*Location, error) {
+	return nil, errors.New("自定义API不支持作为迁移目标")
+}
+
+func (b *customBackend) WriteThumbnail(ctx context.Context, key string, data []byte) (*Location, error) {
+	return nil, errors.New("自定义API不支持写入缩略图")
+}
+
+func (b *customBackend) Verify(ctx context.Context, obj *Object, loc *Location) error {
+	return errors.New("自定义API不支持作为迁移目标")
+}
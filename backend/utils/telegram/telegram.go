@@ -30,11 +30,17 @@ func ParseFileIdFromTelegramPath(path string) string {
 
 // 【关键修改】导出方法（首字母大写），供Proxy.go调用
 func GetTelegramFileStreamReader(client *Config, fileId string) (io.ReadCloser, error) {
+	reader, _, err := GetTelegramFileStream(client, fileId)
+	return reader, err
+}
+
+// GetTelegramFileStream 获取文件流及文件大小（大小未知时为-1）
+func GetTelegramFileStream(client *Config, fileId string) (io.ReadCloser, int64, error) {
 	var lastErr error
 	for i := 0; i <= client.Retry; i++ {
-		reader, err := getTelegramFileStreamReaderOnce(client, fileId)
+		reader, size, err := getTelegramFileStreamReaderOnce(client, fileId)
 		if err == nil {
-			return reader, nil
+			return reader, size, nil
 		}
 		lastErr = err
 		if i < client.Retry {
@@ -43,49 +49,49 @@ func GetTelegramFileStreamReader(client *Config, fileId string) (io.ReadCloser,
 			continue
 		}
 	}
-	return nil, fmt.Errorf("重试%d次后仍获取文件流失败: %w", client.Retry, lastErr)
+	return nil, 0, fmt.Errorf("重试%d次后仍获取文件流失败: %w", client.Retry, lastErr)
 }
 
 // 内部方法（小写，不导出）
-func getTelegramFileStreamReaderOnce(client *Config, fileId string) (io.ReadCloser, error) {
+func getTelegramFileStreamReaderOnce(client *Config, fileId string) (io.ReadCloser, int64, error) {
 	fileURL := fmt.Sprintf("https://api.telegram.org/bot%s/getFile", client.BotToken)
 	reqBody := []byte(fmt.Sprintf(`{"file_id":"%s"}`, fileId))
 
 	req, err := http.NewRequest("POST", fileURL, strings.NewReader(string(reqBody)))
 	if err != nil {
-		return nil, fmt.Errorf("创建getFile请求失败: %w", err)
+		return nil, 0, fmt.Errorf("创建getFile请求失败: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 
 	httpClient := &http.Client{Timeout: client.Timeout}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("调用getFile接口失败: %w", err)
+		return nil, 0, fmt.Errorf("调用getFile接口失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var fileResp FileResponse
 	if err := json.NewDecoder(resp.Body).Decode(&fileResp); err != nil {
-		return nil, fmt.Errorf("解析getFile响应失败: %w", err)
+		return nil, 0, fmt.Errorf("解析getFile响应失败: %w", err)
 	}
 	if !fileResp.OK {
-		return nil, fmt.Errorf("telegram API 错误 [code:%d]: %s", fileResp.ErrorCode, fileResp.Description)
+		return nil, 0, fmt.Errorf("telegram API 错误 [code:%d]: %s", fileResp.ErrorCode, fileResp.Description)
 	}
 	if fileResp.Result.FilePath == "" {
-		return nil, errors.New("未获取到文件下载路径")
+		return nil, 0, errors.New("未获取到文件下载路径")
 	}
 
 	downloadURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", client.BotToken, fileResp.Result.FilePath)
 	downloadResp, err := httpClient.Get(downloadURL)
 	if err != nil {
-		return nil, fmt.Errorf("创建下载请求失败: %w", err)
+		return nil, 0, fmt.Errorf("创建下载请求失败: %w", err)
 	}
 	if downloadResp.StatusCode != http.StatusOK {
 		downloadResp.Body.Close()
-		return nil, fmt.Errorf("下载请求失败，HTTP状态码: %d", downloadResp.StatusCode)
+		return nil, 0, fmt.Errorf("下载请求失败，HTTP状态码: %d", downloadResp.StatusCode)
 	}
 
-	return downloadResp.Body, nil
+	return downloadResp.Body, downloadResp.ContentLength, nil
 }
 
 // 其他核心方法（NewClient、UploadPhotoByBytes、SendMsg等）保持不变...
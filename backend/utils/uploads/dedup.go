@@ -0,0 +1,74 @@
+package uploads
+
+import (
+	"fmt"
+	"mime/multipart"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/interfaces"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/images"
+)
+
+// processUpload 读取并处理上传文件
+// 相同内容已按相同处理设置保存在当前存储时直接返回已有对象，跳过解码、水印和格式转换
+func processUpload(fileHeader *multipart.FileHeader, setting *models.Settings) (*images.ProcessedImage, *interfaces.ImageUploadResult, error) {
+	fileBytes, err := images.ReadFileContent(fileHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contentHash := images.ContentHash(fileBytes)
+	processKey := images.ProcessKey(*setting)
+	if existing := findExistingObject(contentHash, processKey, setting.StorageType, setting.StorageProfileId); existing != nil {
+		return nil, existing, nil
+	}
+
+	// 水印和格式转换交由后台任务时只读取尺寸，原样写入
+	process := images.ImageSvc.ProcessBytes
+	if setting.DeferProcessing {
+		process = images.ImageSvc.InspectBytes
+	}
+	processedImage, err := process(fileBytes, fileHeader, *setting)
+	if err != nil {
+		return nil, nil, fmt.Errorf("图片处理失败: %v", err)
+	}
+	return processedImage, nil, nil
+}
+
+// findExistingObject 查找同一存储（及存储配置方案）中内容和处理设置都相同的已有对象，存在时直接复用，避免重复存储
+// 私有图片独占其文件，不参与复用（设为私有时会先复制出独立文件）；后台任务尚未处理完成的文件也不复用
+func findExistingObject(contentHash, processKey, storage string, profileId int) *interfaces.ImageUploadResult {
+	db := database.GetDB()
+	if contentHash == "" || db == nil {
+		return nil
+	}
+
+	var existing models.Image
+	err := db.DB.Where("content_hash = ? AND process_key = ? AND storage = ? AND storage_profile_id = ?", contentHash, processKey, storage, profileId).
+		Where("processing = ?", false).
+		Where("url NOT IN (?)", db.DB.Model(&models.Image{}).Unscoped().Select("url").Where("private = ?", true)).
+		Order("id ASC").
+		First(&existing).Error
+	if err != nil {
+		return nil
+	}
+
+	return &interfaces.ImageUploadResult{
+		Success:      true,
+		Message:      "上传成功（文件已存在，复用已有文件）",
+		FileName:     existing.FileName,
+		FileSize:     existing.FileSize,
+		MimeType:     existing.MimeType,
+		URL:          existing.Url,
+		ThumbnailURL: existing.Thumbnail,
+		Storage:      existing.Storage,
+		Width:        existing.Width,
+		Height:       existing.Height,
+		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
+		ContentHash:  contentHash,
+		ProcessKey:   processKey,
+		Deduplicated: true,
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"oneimg/backend/interfaces"
 	"oneimg/backend/models"
 	"oneimg/backend/utils/result"
+	"oneimg/backend/utils/settings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -71,7 +73,16 @@ func (uc *UploadContext) ParseAndValidateFiles(maxFileSize int64) ([]*multipart.
 }
 
 // GetStorageUploader 根据存储类型获取上传器实例
+// 请求中指定了 storage_profile_id 时，先将对应的存储配置方案覆盖到 setting 上
 func (uc *UploadContext) GetStorageUploader(setting *models.Settings) (interfaces.StorageUploader, error) {
+	profileId, err := uc.requestedProfileId()
+	if err != nil {
+		return nil, err
+	}
+	if err := settings.ApplyUploadProfile(setting, profileId, uc.c.GetInt("user_role")); err != nil {
+		return nil, err
+	}
+
 	switch setting.GetEffectiveStorageType() {
 	case "default":
 		return &DefaultUploader{}, nil
@@ -89,3 +100,19 @@ func (uc *UploadContext) GetStorageUploader(setting *models.Settings) (interface
 		return nil, fmt.Errorf("不支持的存储类型：%s", setting.StorageType)
 	}
 }
+
+// requestedProfileId 读取请求指定的存储配置方案ID（表单字段或查询参数）
+func (uc *UploadContext) requestedProfileId() (int, error) {
+	raw := uc.c.PostForm("storage_profile_id")
+	if raw == "" {
+		raw = uc.c.Query("storage_profile_id")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	profileId, err := strconv.Atoi(raw)
+	if err != nil || profileId < 0 {
+		return 0, errors.New("存储配置方案ID无效")
+	}
+	return profileId, nil
+}
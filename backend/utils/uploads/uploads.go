@@ -47,17 +47,13 @@ func (u *S3R2Uploader) Upload(c *gin.Context, cfg *config.Config, setting *model
 		return nil, fmt.Errorf("图片验证失败: %v", err)
 	}
 
-	// 打开文件
-	file, err := fileHeader.Open()
+	// 处理图片（相同内容已按相同设置保存在当前存储时直接引用已有对象）
+	processedImage, existing, err := processUpload(fileHeader, setting)
 	if err != nil {
-		return nil, fmt.Errorf("打开文件失败: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	// 处理图片
-	processedImage, err := images.ImageSvc.ProcessImage(file, fileHeader, *setting)
-	if err != nil {
-		return nil, fmt.Errorf("图片处理失败: %v", err)
+	if existing != nil {
+		return existing, nil
 	}
 
 	uniqueFileName := processedImage.UniqueFileName
@@ -138,6 +134,9 @@ func (u *S3R2Uploader) Upload(c *gin.Context, cfg *config.Config, setting *model
 		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
 		Width:        processedImage.Width,
 		Height:       processedImage.Height,
+		ContentHash:  processedImage.ContentHash,
+		ProcessKey:   processedImage.ProcessKey,
+		Deferred:     processedImage.Deferred,
 	}, nil
 }
 
@@ -148,17 +147,13 @@ func (u *WebDAVUploader) Upload(c *gin.Context, cfg *config.Config, setting *mod
 		return nil, fmt.Errorf("图片验证失败: %v", err)
 	}
 
-	// 打开文件
-	file, err := fileHeader.Open()
+	// 处理图片（相同内容已按相同设置保存在当前存储时直接引用已有对象）
+	processedImage, existing, err := processUpload(fileHeader, setting)
 	if err != nil {
-		return nil, fmt.Errorf("打开文件失败: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	// 处理图片
-	processedImage, err := images.ImageSvc.ProcessImage(file, fileHeader, *setting)
-	if err != nil {
-		return nil, fmt.Errorf("图片处理失败: %v", err)
+	if existing != nil {
+		return existing, nil
 	}
 
 	// 生成唯一文件名
@@ -208,6 +203,9 @@ func (u *WebDAVUploader) Upload(c *gin.Context, cfg *config.Config, setting *mod
 		Storage:      setting.StorageType,
 		Width:        processedImage.Width,
 		Height:       processedImage.Height,
+		ContentHash:  processedImage.ContentHash,
+		ProcessKey:   processedImage.ProcessKey,
+		Deferred:     processedImage.Deferred,
 		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
 	}, nil
 }
@@ -219,23 +217,19 @@ func (u *FTPUploader) Upload(c *gin.Context, cfg *config.Config, setting *models
 		return nil, fmt.Errorf("图片验证失败: %v", err)
 	}
 
-	// 2. 打开文件
-	file, err := fileHeader.Open()
+	// 2. 读取并处理图片（相同内容已按相同设置保存在当前存储时直接引用已有对象）
+	processedImage, existing, err := processUpload(fileHeader, setting)
 	if err != nil {
-		return nil, fmt.Errorf("打开文件失败: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	// 3. 处理图片（压缩、生成缩略图等）
-	processedImage, err := images.ImageSvc.ProcessImage(file, fileHeader, *setting)
-	if err != nil {
-		return nil, fmt.Errorf("图片处理失败: %v", err)
+	if existing != nil {
+		return existing, nil
 	}
 
-	// 4. 生成唯一文件名
+	// 3. 生成唯一文件名
 	uniqueFileName := processedImage.UniqueFileName
 
-	// 5. 构建FTP目录结构（年/月）
+	// 4. 构建FTP目录结构（年/月）
 	now := time.Now()
 	year := now.Format("2006")
 	month := now.Format("01")
@@ -286,6 +280,9 @@ func (u *FTPUploader) Upload(c *gin.Context, cfg *config.Config, setting *models
 		Storage:      setting.StorageType,
 		Width:        processedImage.Width,
 		Height:       processedImage.Height,
+		ContentHash:  processedImage.ContentHash,
+		ProcessKey:   processedImage.ProcessKey,
+		Deferred:     processedImage.Deferred,
 		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
 	}, nil
 }
@@ -297,17 +294,13 @@ func (u *DefaultUploader) Upload(c *gin.Context, cfg *config.Config, setting *mo
 		return nil, fmt.Errorf("图片验证失败: %v", err)
 	}
 
-	// 打开文件
-	file, err := fileHeader.Open()
+	// 处理图片（相同内容已按相同设置保存在当前存储时直接引用已有对象）
+	processedImage, existing, err := processUpload(fileHeader, setting)
 	if err != nil {
-		return nil, fmt.Errorf("打开文件失败: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	// 处理图片
-	processedImage, err := images.ImageSvc.ProcessImage(file, fileHeader, *setting)
-	if err != nil {
-		return nil, fmt.Errorf("图片处理失败: %v", err)
+	if existing != nil {
+		return existing, nil
 	}
 
 	uniqueFileName := processedImage.UniqueFileName
@@ -360,6 +353,9 @@ func (u *DefaultUploader) Upload(c *gin.Context, cfg *config.Config, setting *mo
 		MimeType:     processedImage.MimeType,
 		Width:        processedImage.Width,
 		Height:       processedImage.Height,
+		ContentHash:  processedImage.ContentHash,
+		ProcessKey:   processedImage.ProcessKey,
+		Deferred:     processedImage.Deferred,
 		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
 	}, nil
 }
@@ -371,20 +367,16 @@ func (u *TelegramUploader) Upload(c *gin.Context, cfg *config.Config, setting *m
 		return nil, fmt.Errorf("图片验证失败: %v", err)
 	}
 
-	// 2. 打开文件
-	file, err := fileHeader.Open()
+	// 2. 读取并处理图片（相同内容已按相同设置保存在当前存储时直接引用已有对象）
+	processedImage, existing, err := processUpload(fileHeader, setting)
 	if err != nil {
-		return nil, fmt.Errorf("打开文件失败: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	// 3. 处理图片
-	processedImage, err := images.ImageSvc.ProcessImage(file, fileHeader, *setting)
-	if err != nil {
-		return nil, fmt.Errorf("图片处理失败: %v", err)
+	if existing != nil {
+		return existing, nil
 	}
 
-	// 4. 基础参数校验
+	// 3. 基础参数校验
 	if setting.TGBotToken == "" {
 		return nil, fmt.Errorf("telegram bot token 不能为空")
 	}
@@ -396,14 +388,14 @@ func (u *TelegramUploader) Upload(c *gin.Context, cfg *config.Config, setting *m
 	year := now.Format("2006")
 	month := now.Format("01")
 
-	// 5. 初始化TG客户端
+	// 4. 初始化TG客户端
 	tgClient := telegram.NewClient(setting.TGBotToken)
 	tgClient.Timeout = 60 * time.Second
 	tgClient.Retry = 3
 
 	uniqueFileName := processedImage.UniqueFileName
 
-	// 6. 确定存储目标：优先使用 TGChannelID，否则使用 TGReceivers
+	// 5. 确定存储目标：优先使用 TGChannelID，否则使用 TGReceivers
 	storageTarget := setting.TGChannelID
 	if storageTarget == "" {
 		storageTarget = setting.TGReceivers
@@ -420,7 +412,7 @@ func (u *TelegramUploader) Upload(c *gin.Context, cfg *config.Config, setting *m
 		return nil, fmt.Errorf("Telegram上传图片失败: %v", err)
 	}
 
-	// 7. 上传缩略图（如果开启）
+	// 6. 上传缩略图（如果开启）
 	thumbnailURL := ""
 	thumbFileIDURL := ""
 	thumbFileMessageID := 0
@@ -469,6 +461,8 @@ func (u *TelegramUploader) Upload(c *gin.Context, cfg *config.Config, setting *m
 		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
 		Width:        processedImage.Width,
 		Height:       processedImage.Height,
+		ContentHash:  processedImage.ContentHash,
+		ProcessKey:   processedImage.ProcessKey,
 	}, nil
 }
 
@@ -504,6 +498,12 @@ func (u *CustomApiUploader) Upload(c *gin.Context, cfg *config.Config, setting *
 		log.Printf("Failed to decode image config: %v", err)
 	}
 
+	// 相同内容已存在时直接引用已有对象（自定义API上传原图，不区分处理设置）
+	contentHash := images.ContentHash(fileBytes)
+	if existing := findExistingObject(contentHash, "", "custom", setting.StorageProfileId); existing != nil {
+		return existing, nil
+	}
+
 	// 4. 调用Custom API上传
 	apiClient := customapi.NewCustomApiUploader(setting.CustomApiUrl, setting.CustomApiKey, setting.CustomApiDelUrl)
 
@@ -541,6 +541,7 @@ func (u *CustomApiUploader) Upload(c *gin.Context, cfg *config.Config, setting *
 		Width:        width,
 		Height:       height,
 		CreatedAt:    time.Now().Format("2006-01-02 15:04:05"),
+		ContentHash:  contentHash,
 	}, nil
 }
 
@@ -145,6 +145,16 @@ func ParseWatermarkParams(c *gin.Context) WatermarkConfig {
 	return cfg
 }
 
+// CacheKey 水印参数的规范化表示，用于衍生图片缓存
+func (cfg WatermarkConfig) CacheKey() string {
+	if !cfg.Enable {
+		return "wm:off"
+	}
+	return fmt.Sprintf("wm:%q|%s|%d|%g|%d|%d|%s|%g|%s|%t",
+		cfg.Text, cfg.Position, cfg.FontSize, cfg.FontSizeRatio, cfg.MinFontSize, cfg.MaxFontSize,
+		cfg.FontColor, cfg.Opacity, cfg.FontPath, cfg.EnableDynamicSize)
+}
+
 // WatermarkSetting 设置水印设置参数
 func WatermarkSetting(setting models.Settings) WatermarkConfig {
 	var (
@@ -240,6 +240,12 @@ func (c *WebDAVClient) WebDAVDelete(ctx context.Context, path string) error {
 
 // WebDAVGetFile 获取文件流
 func (c *WebDAVClient) WebDAVGetFile(ctx context.Context, path string) (*http.Response, error) {
+	return c.WebDAVGetFileRange(ctx, path, "")
+}
+
+// WebDAVGetFileRange 获取文件流，rangeHeader 非空时作为 Range 请求头转发给服务端
+// 服务端不支持分段时会返回200和完整内容，调用方需根据状态码判断
+func (c *WebDAVClient) WebDAVGetFileRange(ctx context.Context, path string, rangeHeader string) (*http.Response, error) {
 	cleanPath := c.NormalizePath(path)
 	fullURL := c.config.BaseURL + cleanPath
 
@@ -252,6 +258,9 @@ func (c *WebDAVClient) WebDAVGetFile(ctx context.Context, path string) (*http.Re
 		req.SetBasicAuth(c.config.Username, c.config.Password)
 	}
 	req.Header.Set("User-Agent", "OneIMG-Proxy/1.0")
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
 
 	client := &http.Client{Timeout: c.config.Timeout}
 	resp, err := client.Do(req)
@@ -0,0 +1,225 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/utils/jobs"
+)
+
+const (
+	// requestTimeout 单次投递的超时时间
+	requestTimeout = 10 * time.Second
+	// maxResponseLog 投递记录中保存的响应内容长度
+	maxResponseLog = 1024
+	// retention 投递记录保留时间
+	retention = 30 * 24 * time.Hour
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-OneImg-Event"
+	HeaderEventId   = "X-OneImg-Event-Id"
+	HeaderTimestamp = "X-OneImg-Timestamp"
+	HeaderSignature = "X-OneImg-Signature"
+)
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// Envelope 投递的JSON内容
+type Envelope struct {
+	Id        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// delivery 投递任务参数
+type delivery struct {
+	WebhookId int    `json:"webhook_id"`
+	EventId   string `json:"event_id"`
+	Event     string `json:"event"`
+	Body      string `json:"body"`
+}
+
+// Init 注册投递任务处理函数（需在 jobs.Init 之前调用），并定期清理过期的投递记录
+func Init() {
+	jobs.Register(models.JobTypeWebhook, deliver)
+	go cleanup()
+}
+
+// Dispatch 向订阅了该事件的所有已启用 Webhook 投递事件（异步，失败按任务队列的退避策略重试）
+func Dispatch(event string, data any) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+
+	var hooks []models.Webhook
+	if err := db.DB.Where("enabled = ?", true).Find(&hooks).Error; err != nil {
+		log.Printf("查询Webhook失败：%v", err)
+		return
+	}
+
+	var envelope *Envelope
+	var body []byte
+	for _, hook := range hooks {
+		if !hook.Subscribes(event) {
+			continue
+		}
+		// 同一事件的所有投递使用相同的事件ID和内容
+		if envelope == nil {
+			var err error
+			if envelope, body, err = newEnvelope(event, data); err != nil {
+				log.Printf("生成Webhook内容失败：%v", err)
+				return
+			}
+		}
+		enqueue(hook, envelope, body)
+	}
+}
+
+// Ping 向指定 Webhook 发送测试事件
+func Ping(hook models.Webhook) (*models.Job, error) {
+	envelope, body, err := newEnvelope(models.EventPing, map[string]any{"webhook_id": hook.Id, "name": hook.Name})
+	if err != nil {
+		return nil, err
+	}
+	return enqueue(hook, envelope, body)
+}
+
+// GenerateSecret 生成签名密钥
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成签名密钥失败：%v", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign 计算签名：HMAC-SHA256(secret, 时间戳 + "." + 请求体)，接收方可据此校验内容和防重放
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newEnvelope(event string, data any) (*Envelope, []byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+	envelope := &Envelope{
+		Id:        "evt_" + hex.EncodeToString(id),
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	body, err := json.Marshal(envelope)
+	return envelope, body, err
+}
+
+// enqueue 创建投递任务（不关联图片，只有管理员可见）
+func enqueue(hook models.Webhook, envelope *Envelope, body []byte) (*models.Job, error) {
+	job, err := jobs.Enqueue(models.JobTypeWebhook, 0, 0, delivery{
+		WebhookId: hook.Id,
+		EventId:   envelope.Id,
+		Event:     envelope.Event,
+		Body:      string(body),
+	})
+	if err != nil {
+		log.Printf("创建Webhook投递任务失败：%v", err)
+	}
+	return job, err
+}
+
+// deliver 发送一次投递并记录结果，非2xx响应返回错误以触发重试
+func deliver(ctx context.Context, job *models.Job) error {
+	var d delivery
+	if err := jobs.DecodePayload(job, &d); err != nil {
+		return err
+	}
+
+	db := database.GetDB().DB
+	var hook models.Webhook
+	if err := db.First(&hook, d.WebhookId).Error; err != nil {
+		// Webhook 已删除
+		return nil
+	}
+	if !hook.Enabled && d.Event != models.EventPing {
+		return nil
+	}
+
+	record := models.WebhookDelivery{
+		WebhookId: hook.Id,
+		JobId:     job.Id,
+		EventId:   d.EventId,
+		Event:     d.Event,
+		Attempt:   job.Attempts,
+	}
+	err := send(ctx, hook, d, &record)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	db.Create(&record)
+	return err
+}
+
+func send(ctx context.Context, hook models.Webhook, d delivery, record *models.WebhookDelivery) error {
+	body := []byte(d.Body)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OneImg-Webhook")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderEventId, d.EventId)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	record.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		return fmt.Errorf("请求失败：%v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	record.StatusCode = resp.StatusCode
+	record.Response = string(respBody)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("响应状态码：%d", resp.StatusCode)
+	}
+	record.Success = true
+	return nil
+}
+
+// cleanup 定期删除过期的投递记录
+func cleanup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		database.GetDB().DB.
+			Where("created_at < ?", time.Now().Add(-retention)).
+			Delete(&models.WebhookDelivery{})
+	}
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"embed"
 	"log"
+	"os"
 
 	"oneimg/backend/app"
 	"oneimg/backend/routes"
@@ -24,6 +25,11 @@ var fs embed.FS
 var fontFs embed.FS
 
 func main() {
+	// 命令行子命令（backup / restore）
+	if app.RunCommand(os.Args[1:]) {
+		return
+	}
+
 	system := app.Init()
 	r := routes.SetupRoutes(fs)
 	watermark.Init(fontFs)